@@ -103,6 +103,138 @@ func SetupRoutes(authMiddleware mux.MiddlewareFunc) *mux.Router {
 		handlers.UserMatches(w, r)
 	}).Methods("GET")
 
+	// GET /users/{id}/series?page={page_num}&limit={limit}
+	// Returns the finished best-of-N series a user has played, most recent first.
+	// Query Parameters:
+	// - page_num: The page number for pagination (default 1)
+	// - limit: Maximum number of results per page (default 10, max 50)
+	// Response: []models.Series
+	accountRouter.HandleFunc("/{id}/series", func(w http.ResponseWriter, r *http.Request) {
+		handlers.UserSeries(w, r)
+	}).Methods("GET")
+
+	// GET /users/{id}/rating-history?from={from}&to={to}
+	// Returns a user's rating after each of their rated matches, oldest first.
+	// Empty for users still in placement, unless they are asking for their own.
+	// Query Parameters:
+	// - from: Only include matches that ended at or after this RFC 3339 timestamp (optional)
+	// - to: Only include matches that ended at or before this RFC 3339 timestamp (optional)
+	// Response: []models.RatingHistoryEntry
+	accountRouter.HandleFunc("/{id}/rating-history", func(w http.ResponseWriter, r *http.Request) {
+		handlers.UserRatingHistory(w, r)
+	}).Methods("GET")
+
+	// ----------------------
+	// Leaderboard Routes
+	// ----------------------
+	leaderboardRouter := api.PathPrefix("/v1/leaderboard").Subrouter()
+	leaderboardRouter.Use(authMiddleware)
+
+	// GET /leaderboard?page={page_num}&limit={limit}&min_games={min_games}&active_days={days}
+	// Returns users ranked by rating, along with the current user's own rank.
+	// Query Parameters:
+	// - page_num: The page number for pagination (default 1)
+	// - limit: Maximum number of results per page (default 25, max 100)
+	// - min_games: Only rank users with at least this many rated matches (optional)
+	// - active_days: Only rank users who finished a match in the last N days (optional)
+	// Response: models.LeaderboardResponse
+	leaderboardRouter.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
+		handlers.GetLeaderboard(w, r)
+	}).Methods("GET")
+
+	// ----------------------
+	// Season Routes
+	// ----------------------
+	seasonRouter := api.PathPrefix("/v1/seasons").Subrouter()
+	seasonRouter.Use(authMiddleware)
+
+	// GET /seasons/{id}/standings?page={page_num}&limit={limit}
+	// Returns the final standings of a season. Empty until the season has ended.
+	// Query Parameters:
+	// - page_num: The page number for pagination (default 1)
+	// - limit: Maximum number of results per page (default 25, max 100)
+	// Response: models.SeasonStandingsResponse
+	seasonRouter.HandleFunc("/{id}/standings", func(w http.ResponseWriter, r *http.Request) {
+		handlers.SeasonStandings(w, r)
+	}).Methods("GET")
+
+	// ----------------------
+	// Tournament Routes
+	// ----------------------
+	tournamentRouter := api.PathPrefix("/v1/tournaments").Subrouter()
+	tournamentRouter.Use(authMiddleware)
+
+	// POST /tournaments
+	// Creates a tournament open for registration. The creator starts it once players have registered.
+	// Request: models.CreateTournamentRequest
+	// Response: models.Tournament
+	tournamentRouter.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
+		handlers.CreateTournament(w, r)
+	}).Methods("POST")
+
+	// GET /tournaments/{id}
+	// Returns a tournament with its registered players and the current state of its bracket.
+	// Response: models.Tournament
+	tournamentRouter.HandleFunc("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.GetTournament(w, r)
+	}).Methods("GET")
+
+	// POST /tournaments/{id}/register
+	// Registers the current user for a tournament that hasn't started yet.
+	// Response: models.Tournament
+	tournamentRouter.HandleFunc("/{id}/register", func(w http.ResponseWriter, r *http.Request) {
+		handlers.RegisterForTournament(w, r)
+	}).Methods("POST")
+
+	// POST /tournaments/{id}/start
+	// Creator or admin only. Seeds the players by rating, generates the bracket and starts the first round.
+	// Response: models.Tournament
+	tournamentRouter.HandleFunc("/{id}/start", func(w http.ResponseWriter, r *http.Request) {
+		handlers.StartTournament(w, r)
+	}).Methods("POST")
+
+	// ----------------------
+	// League Routes
+	// ----------------------
+	leagueRouter := api.PathPrefix("/v1/leagues").Subrouter()
+	leagueRouter.Use(authMiddleware)
+
+	// POST /leagues
+	// Creates a round robin or Swiss league open for registration. The creator starts it once players have registered.
+	// Request: models.CreateLeagueRequest
+	// Response: models.League
+	leagueRouter.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
+		handlers.CreateLeague(w, r)
+	}).Methods("POST")
+
+	// GET /leagues/{id}
+	// Returns a league with its registered players and every fixture paired so far.
+	// Response: models.League
+	leagueRouter.HandleFunc("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.GetLeague(w, r)
+	}).Methods("GET")
+
+	// GET /leagues/{id}/standings
+	// Returns the league table, ranked by match points, then Buchholz, then wins.
+	// Response: models.LeagueStandingsResponse
+	leagueRouter.HandleFunc("/{id}/standings", func(w http.ResponseWriter, r *http.Request) {
+		handlers.GetLeagueStandings(w, r)
+	}).Methods("GET")
+
+	// POST /leagues/{id}/register
+	// Registers the current user for a league that hasn't started yet.
+	// Response: models.League
+	leagueRouter.HandleFunc("/{id}/register", func(w http.ResponseWriter, r *http.Request) {
+		handlers.RegisterForLeague(w, r)
+	}).Methods("POST")
+
+	// POST /leagues/{id}/start
+	// Creator or admin only. Pairs the first round; each later round is paired when the one before closes.
+	// Response: models.League
+	leagueRouter.HandleFunc("/{id}/start", func(w http.ResponseWriter, r *http.Request) {
+		handlers.StartLeague(w, r)
+	}).Methods("POST")
+
 	// ----------------------
 	// Match Invite Routes
 	// ----------------------
@@ -163,6 +295,14 @@ func SetupRoutes(authMiddleware mux.MiddlewareFunc) *mux.Router {
 		handlers.MatchSubmissions(w, r)
 	}).Methods("GET")
 
+	// POST /matches/{id}/revert
+	// Admin only. Marks a finished match as Reverted and undoes the rating changes it caused.
+	// Request: models.RevertMatchRequest
+	// Response: models.Session
+	matchRouter.HandleFunc("/{id}/revert", func(w http.ResponseWriter, r *http.Request) {
+		handlers.MatchRevert(w, r)
+	}).Methods("POST")
+
 	// --------------------
 	// Problems Routes
 	// --------------------
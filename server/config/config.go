@@ -2,7 +2,12 @@ package config
 
 // Package used to load configuration from environment variables
 
-import "os"
+import (
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
 
 type Config struct {
 	GITHUB_CLIENT_ID      string
@@ -13,6 +18,20 @@ type Config struct {
 	JWT_SECRET            string
 	LOG_LEVEL             string // "debug", "info", "warn", "error", "fatal", "panic", "trace"
 	SUBMISSION_VALIDATION bool
+	MM_BASE_WINDOW        int     // Rating difference a newly queued player accepts
+	MM_WINDOW_GROWTH      int     // Rating points added to the window per second spent waiting
+	MM_MAX_WINDOW         int     // Upper bound on the acceptable rating difference
+	ELO_K_FACTOR          int     // Maximum rating change from a single rated match
+	RATING_SYSTEM         string  // "elo" or "glicko2"
+	RATING_PERIOD_DAYS    int     // Days of inactivity before a player's rating deviation grows
+	SEASON_RESET_PERCENT  int     // How far ratings move toward the mean when a season starts
+	PLACEMENT_GAMES       int     // Rated matches a new player plays before their rating is public
+	PLACEMENT_K_FACTOR    int     // Elo K factor used during placement matches
+	ADMIN_USER_IDS        []int64 // Users allowed to perform admin operations such as match reverts
+	TIME_LIMIT_EASY       int     // Default minutes allowed for a match on an Easy problem
+	TIME_LIMIT_MEDIUM     int     // Default minutes allowed for a match on a Medium problem
+	TIME_LIMIT_HARD       int     // Default minutes allowed for a match on a Hard problem
+	SUBMISSION_PENALTY    int     // Minutes added for each rejected submission in penalty matches
 }
 
 var appConfig *Config = nil
@@ -48,6 +67,20 @@ func loadConfig() (*Config, error) {
 		JWT_SECRET:            os.Getenv("JWT_SECRET"),
 		LOG_LEVEL:             getEnv("LOG_LEVEL", "debug"),
 		SUBMISSION_VALIDATION: getEnv("SUBMISSION_VALIDATION", "enable") != "disable", // only disable if "disable"
+		MM_BASE_WINDOW:        getEnvInt("MM_BASE_WINDOW", 100),
+		MM_WINDOW_GROWTH:      getEnvInt("MM_WINDOW_GROWTH", 10),
+		MM_MAX_WINDOW:         getEnvInt("MM_MAX_WINDOW", 600),
+		ELO_K_FACTOR:          getEnvInt("ELO_K_FACTOR", 32),
+		RATING_SYSTEM:         getEnv("RATING_SYSTEM", "elo"),
+		RATING_PERIOD_DAYS:    getEnvInt("RATING_PERIOD_DAYS", 7),
+		SEASON_RESET_PERCENT:  getEnvInt("SEASON_RESET_PERCENT", 50),
+		PLACEMENT_GAMES:       getEnvInt("PLACEMENT_GAMES", 5),
+		PLACEMENT_K_FACTOR:    getEnvInt("PLACEMENT_K_FACTOR", 64),
+		ADMIN_USER_IDS:        getEnvInt64List("ADMIN_USER_IDS"),
+		TIME_LIMIT_EASY:       getEnvInt("TIME_LIMIT_EASY", 20),
+		TIME_LIMIT_MEDIUM:     getEnvInt("TIME_LIMIT_MEDIUM", 40),
+		TIME_LIMIT_HARD:       getEnvInt("TIME_LIMIT_HARD", 60),
+		SUBMISSION_PENALTY:    getEnvInt("SUBMISSION_PENALTY", 5),
 	}, nil
 }
 
@@ -57,3 +90,31 @@ func getEnv(key, defaultVal string) string {
 	}
 	return defaultVal
 }
+
+func getEnvInt(key string, defaultVal int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultVal
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return defaultVal
+	}
+	return parsed
+}
+
+// Parses a comma separated list of IDs, skipping any that are malformed.
+func getEnvInt64List(key string) []int64 {
+	var ids []int64
+	for _, part := range strings.Split(os.Getenv(key), ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (c *Config) IsAdmin(userID int64) bool {
+	return slices.Contains(c.ADMIN_USER_IDS, userID)
+}
@@ -242,6 +242,9 @@ func exchangeCodeForUser(code string) (*models.User, error) {
 		if err != nil {
 			return nil, err
 		}
+		if err := services.Leaderboard.Sync(created.ID); err != nil {
+			return nil, err
+		}
 		user = *created
 	}
 
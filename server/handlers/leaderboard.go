@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"leetcodeduels/models"
+	"leetcodeduels/services"
+	"leetcodeduels/store"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func GetLeaderboard(w http.ResponseWriter, r *http.Request) {
+	l := log.Ctx(r.Context())
+
+	claims, err := services.GetClaimsFromRequest(r)
+	if err != nil {
+		l.Warn().Msg("Attempted to call GetLeaderboard without valid claims")
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	query := r.URL.Query()
+	pageStr := query.Get("page")
+	limitStr := query.Get("limit")
+	minGamesStr := query.Get("min_games")
+	activeDaysStr := query.Get("active_days")
+
+	l.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Int64("user_id", claims.UserID).Str("page", pageStr).Str("limit", limitStr).
+			Str("min_games", minGamesStr).Str("active_days", activeDaysStr)
+	})
+	l.Info().Msg("Received request for GetLeaderboard")
+
+	// page is optional param, defaults to 1
+	// limit is optional param, defaults to 25, max 100
+	page := 1
+	limit := 25
+	if pageStr != "" {
+		page, err = strconv.Atoi(pageStr)
+		if err != nil || page < 1 {
+			l.Warn().Msg("GetLeaderboard called with invalid page")
+			writeError(w, http.StatusBadRequest, "Invalid page parameter. Must be a positive integer.")
+			return
+		}
+	}
+	if limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > 100 {
+			l.Warn().Msg("GetLeaderboard called with invalid limit")
+			writeError(w, http.StatusBadRequest, "Invalid limit parameter. Must be between 1 and 100 (inclusive).")
+			return
+		}
+	}
+
+	var filter models.LeaderboardFilter
+	if minGamesStr != "" {
+		filter.MinGames, err = strconv.Atoi(minGamesStr)
+		if err != nil || filter.MinGames < 0 {
+			l.Warn().Msg("GetLeaderboard called with invalid min_games")
+			writeError(w, http.StatusBadRequest, "Invalid min_games parameter. Must be a non-negative integer.")
+			return
+		}
+	}
+	if activeDaysStr != "" {
+		days, err := strconv.Atoi(activeDaysStr)
+		if err != nil || days < 1 {
+			l.Warn().Msg("GetLeaderboard called with invalid active_days")
+			writeError(w, http.StatusBadRequest, "Invalid active_days parameter. Must be a positive integer.")
+			return
+		}
+		filter.ActiveSince = time.Now().AddDate(0, 0, -days)
+	}
+
+	ranked, total, err := services.Leaderboard.Page(filter, (page-1)*limit, limit)
+	if err != nil {
+		l.Error().Err(err).Msg("Failed to get leaderboard page")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+
+	ids := make([]int64, len(ranked))
+	for i, entry := range ranked {
+		ids[i] = entry.UserID
+	}
+	users, err := store.DataStore.GetUsersByIDs(ids)
+	if err != nil {
+		l.Error().Err(err).Msg("Failed to get leaderboard users")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+	byID := make(map[int64]*models.User, len(users))
+	for i := range users {
+		byID[users[i].ID] = &users[i]
+	}
+
+	res := models.LeaderboardResponse{
+		Entries: []models.LeaderboardEntry{},
+		Total:   total,
+		Page:    page,
+		Limit:   limit,
+	}
+	for _, entry := range ranked {
+		user, ok := byID[entry.UserID]
+		if !ok {
+			continue // Deleted since the leaderboard was read
+		}
+		res.Entries = append(res.Entries, models.LeaderboardEntry{Rank: entry.Rank, User: userInfo(user)})
+	}
+
+	rank, onBoard, err := services.Leaderboard.Rank(filter, claims.UserID)
+	if err != nil {
+		l.Error().Err(err).Msg("Failed to get caller's leaderboard rank")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+	if onBoard {
+		res.MyRank = &rank
+	}
+
+	writeSuccess(w, res)
+}
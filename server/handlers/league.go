@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"leetcodeduels/config"
+	"leetcodeduels/models"
+	"leetcodeduels/services"
+	"leetcodeduels/store"
+	"leetcodeduels/ws"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const maxLeagueNameLength = 100
+
+func CreateLeague(w http.ResponseWriter, r *http.Request) {
+	l := log.Ctx(r.Context())
+
+	claims, err := services.GetClaimsFromRequest(r)
+	if err != nil {
+		l.Warn().Msg("Attempted to call CreateLeague without valid claims")
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	l.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Int64("user_id", claims.UserID)
+	})
+	l.Info().Msg("Received request for CreateLeague")
+
+	var req models.CreateLeagueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		l.Warn().Err(err).Msg("Failed to decode create league request body")
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxLeagueNameLength {
+		writeError(w, http.StatusBadRequest, "A name of at most 100 characters is required")
+		return
+	}
+	format, err := models.ParseLeagueFormat(string(req.Format))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Format must be round_robin or swiss")
+		return
+	}
+	if format == models.RoundRobin && req.Rounds != 0 {
+		writeError(w, http.StatusBadRequest, "A round robin has a round for every opponent")
+		return
+	}
+	if req.Rounds < 0 || req.Rounds > services.MaxLeagueRounds {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Swiss leagues can have at most %d rounds", services.MaxLeagueRounds))
+		return
+	}
+	if req.RoundHours == 0 {
+		req.RoundHours = services.DefaultLeagueRoundHours
+	}
+	if req.RoundHours < 1 || req.RoundHours > services.MaxLeagueRoundHours {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Rounds must last between 1 and %d hours", services.MaxLeagueRoundHours))
+		return
+	}
+	if req.MatchDetails.SeriesTarget > 1 {
+		writeError(w, http.StatusBadRequest, "League fixtures are single games")
+		return
+	}
+	if clientErr := ws.ValidateMatchDetails(req.MatchDetails); clientErr != nil {
+		writeError(w, http.StatusBadRequest, clientErr.Message)
+		return
+	}
+
+	league := models.League{
+		Name:         req.Name,
+		Format:       format,
+		MatchDetails: req.MatchDetails,
+		CreatedBy:    claims.UserID,
+		Rounds:       req.Rounds,
+		RoundHours:   req.RoundHours,
+		Players:      []models.LeaguePlayer{},
+		Fixtures:     []models.LeagueFixture{},
+	}
+	if err := store.DataStore.CreateLeague(&league); err != nil {
+		l.Error().Err(err).Msg("Failed to create league")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+	l.Info().Int("league_id", league.ID).Msg("League created")
+
+	writeJSON(w, http.StatusCreated, league)
+}
+
+func GetLeague(w http.ResponseWriter, r *http.Request) {
+	l := log.Ctx(r.Context())
+
+	leagueIDStr := mux.Vars(r)["id"]
+	l.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("league_id", leagueIDStr)
+	})
+	l.Info().Msg("Received request for GetLeague")
+
+	leagueID, err := strconv.Atoi(leagueIDStr)
+	if err != nil {
+		l.Warn().Msg("Invalid league ID format in path parameter")
+		writeError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	league, err := store.DataStore.GetLeague(leagueID)
+	if err != nil {
+		l.Error().Err(err).Msg("Failed to get league")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+	if league == nil {
+		writeError(w, http.StatusNotFound, "League Not Found")
+		return
+	}
+
+	writeSuccess(w, league)
+}
+
+func GetLeagueStandings(w http.ResponseWriter, r *http.Request) {
+	l := log.Ctx(r.Context())
+
+	leagueIDStr := mux.Vars(r)["id"]
+	l.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("league_id", leagueIDStr)
+	})
+	l.Info().Msg("Received request for GetLeagueStandings")
+
+	leagueID, err := strconv.Atoi(leagueIDStr)
+	if err != nil {
+		l.Warn().Msg("Invalid league ID format in path parameter")
+		writeError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	league, err := store.DataStore.GetLeague(leagueID)
+	if err != nil {
+		l.Error().Err(err).Msg("Failed to get league")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+	if league == nil {
+		writeError(w, http.StatusNotFound, "League Not Found")
+		return
+	}
+
+	writeSuccess(w, models.LeagueStandingsResponse{
+		League:    *league,
+		Standings: services.LeagueStandings(league),
+	})
+}
+
+func RegisterForLeague(w http.ResponseWriter, r *http.Request) {
+	l := log.Ctx(r.Context())
+
+	claims, err := services.GetClaimsFromRequest(r)
+	if err != nil {
+		l.Warn().Msg("Attempted to call RegisterForLeague without valid claims")
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	leagueIDStr := mux.Vars(r)["id"]
+	l.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("league_id", leagueIDStr).Int64("user_id", claims.UserID)
+	})
+	l.Info().Msg("Received request for RegisterForLeague")
+
+	leagueID, err := strconv.Atoi(leagueIDStr)
+	if err != nil {
+		l.Warn().Msg("Invalid league ID format in path parameter")
+		writeError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	league, err := store.DataStore.GetLeague(leagueID)
+	if err != nil {
+		l.Error().Err(err).Msg("Failed to get league")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+	if league == nil {
+		writeError(w, http.StatusNotFound, "League Not Found")
+		return
+	}
+	if len(league.Players) >= services.MaxLeaguePlayers {
+		writeError(w, http.StatusConflict, "League is full")
+		return
+	}
+
+	err = store.DataStore.RegisterLeaguePlayer(leagueID, claims.UserID)
+	switch {
+	case errors.Is(err, store.ErrLeagueNotFound):
+		writeError(w, http.StatusNotFound, "League Not Found")
+		return
+	case errors.Is(err, store.ErrLeagueNotOpen):
+		writeError(w, http.StatusConflict, "Registration has closed")
+		return
+	case errors.Is(err, store.ErrAlreadyRegistered):
+		writeError(w, http.StatusConflict, "Already registered")
+		return
+	case err != nil:
+		l.Error().Err(err).Msg("Failed to register for league")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+	l.Info().Msg("User registered for league")
+
+	league, err = store.DataStore.GetLeague(leagueID)
+	if err != nil {
+		l.Error().Err(err).Msg("Failed to get league")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+	writeSuccess(w, league)
+}
+
+// Only the league's creator or an admin can start it.
+func StartLeague(w http.ResponseWriter, r *http.Request) {
+	l := log.Ctx(r.Context())
+
+	claims, err := services.GetClaimsFromRequest(r)
+	if err != nil {
+		l.Warn().Msg("Attempted to call StartLeague without valid claims")
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	leagueIDStr := mux.Vars(r)["id"]
+	l.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("league_id", leagueIDStr).Int64("user_id", claims.UserID)
+	})
+	l.Info().Msg("Received request for StartLeague")
+
+	leagueID, err := strconv.Atoi(leagueIDStr)
+	if err != nil {
+		l.Warn().Msg("Invalid league ID format in path parameter")
+		writeError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	league, err := store.DataStore.GetLeague(leagueID)
+	if err != nil {
+		l.Error().Err(err).Msg("Failed to get league")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+	if league == nil {
+		writeError(w, http.StatusNotFound, "League Not Found")
+		return
+	}
+	if league.CreatedBy != claims.UserID && !config.GetConfig().IsAdmin(claims.UserID) {
+		l.Warn().Msg("Non-creator attempted to start a league")
+		writeError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	league, err = services.LeagueManager.StartLeague(leagueID)
+	switch {
+	case errors.Is(err, store.ErrLeagueNotFound):
+		writeError(w, http.StatusNotFound, "League Not Found")
+		return
+	case errors.Is(err, services.ErrLeagueStarted):
+		writeError(w, http.StatusConflict, "League has already started")
+		return
+	case errors.Is(err, services.ErrTooFewLeaguePlayers):
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		l.Error().Err(err).Msg("Failed to start league")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+
+	writeSuccess(w, league)
+}
@@ -2,9 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"leetcodeduels/config"
+	"leetcodeduels/models"
 	"leetcodeduels/services"
 	"leetcodeduels/store"
 	"net/http"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
@@ -99,3 +103,94 @@ func MatchSubmissions(w http.ResponseWriter, r *http.Request) {
 
 	writeSuccess(w, submissions)
 }
+
+// Admin-only: marks a stored match as Reverted and rolls back its rating changes.
+func MatchRevert(w http.ResponseWriter, r *http.Request) {
+	l := log.Ctx(r.Context())
+
+	claims, err := services.GetClaimsFromRequest(r)
+	if err != nil {
+		l.Warn().Msg("Attempted to call MatchRevert without valid claims")
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	vars := mux.Vars(r)
+	matchID := vars["id"]
+
+	l.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("match_id", matchID).Int64("user_id", claims.UserID)
+	})
+	l.Info().Msg("Received request for MatchRevert")
+
+	if !config.GetConfig().IsAdmin(claims.UserID) {
+		l.Warn().Msg("Non-admin attempted to revert a match")
+		writeError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	id, err := uuid.Parse(matchID)
+	if err != nil {
+		l.Warn().Err(err).Msg("Invalid match ID format in path parameter")
+		writeError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	var req models.RevertMatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		l.Warn().Err(err).Msg("Failed to decode revert match request body")
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		writeError(w, http.StatusBadRequest, "A reason is required")
+		return
+	}
+
+	active, err := services.GameManager.GetGame(matchID)
+	if err != nil {
+		l.Error().Err(err).Msg("Error checking for active game")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+	if active != nil && active.Status == models.MatchActive {
+		writeError(w, http.StatusConflict, "Match is still in progress")
+		return
+	}
+
+	reversals, err := store.DataStore.RevertMatch(id, claims.UserID, req.Reason)
+	if errors.Is(err, store.ErrMatchNotFound) {
+		writeError(w, http.StatusNotFound, "Match Not Found")
+		return
+	}
+	if errors.Is(err, store.ErrMatchAlreadyReverted) {
+		writeError(w, http.StatusConflict, "Match has already been reverted")
+		return
+	}
+	if err != nil {
+		l.Error().Err(err).Msg("Failed to revert match")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+	l.Info().Int("players_adjusted", len(reversals)).Msg("Match reverted")
+
+	if len(reversals) > 0 {
+		players := make([]int64, len(reversals))
+		for i, r := range reversals {
+			players[i] = r.PlayerID
+		}
+		// Also takes players who are back in placement off the leaderboard
+		if err := services.Leaderboard.Sync(players...); err != nil {
+			l.Error().Err(err).Msg("Failed to update leaderboard after revert")
+		}
+	}
+
+	session, err := store.DataStore.GetMatch(id)
+	if err != nil {
+		l.Error().Err(err).Msg("Failed to get reverted match from datastore")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+	writeSuccess(w, session)
+}
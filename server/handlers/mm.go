@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"leetcodeduels/models"
+	"leetcodeduels/services"
 	"net/http"
 
 	"github.com/rs/zerolog/log"
@@ -8,6 +10,14 @@ import (
 
 func QueueSize(w http.ResponseWriter, r *http.Request) {
 	l := log.Ctx(r.Context())
-	l.Warn().Msg("Unimplemented Endpoint Called")
-	http.Error(w, "Not Implemented", http.StatusNotImplemented)
+	l.Info().Msg("Received request for QueueSize")
+
+	size, err := services.QueueManager.QueueSize()
+	if err != nil {
+		l.Error().Err(err).Msg("Failed to get queue size")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+
+	writeSuccess(w, models.QueueSizeResponse{Size: int(size)})
 }
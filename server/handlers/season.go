@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"leetcodeduels/models"
+	"leetcodeduels/store"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func SeasonStandings(w http.ResponseWriter, r *http.Request) {
+	l := log.Ctx(r.Context())
+
+	vars := mux.Vars(r)
+	seasonIDStr := vars["id"]
+
+	query := r.URL.Query()
+	pageStr := query.Get("page")
+	limitStr := query.Get("limit")
+
+	l.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("season_id", seasonIDStr).Str("page", pageStr).Str("limit", limitStr)
+	})
+	l.Info().Msg("Received request for SeasonStandings")
+
+	seasonID, err := strconv.Atoi(seasonIDStr)
+	if err != nil {
+		l.Warn().Msg("Invalid season ID format in path parameter")
+		writeError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	// page is optional param, defaults to 1
+	// limit is optional param, defaults to 25, max 100
+	page := 1
+	limit := 25
+	if pageStr != "" {
+		page, err = strconv.Atoi(pageStr)
+		if err != nil || page < 1 {
+			l.Warn().Msg("SeasonStandings called with invalid page")
+			writeError(w, http.StatusBadRequest, "Invalid page parameter. Must be a positive integer.")
+			return
+		}
+	}
+	if limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > 100 {
+			l.Warn().Msg("SeasonStandings called with invalid limit")
+			writeError(w, http.StatusBadRequest, "Invalid limit parameter. Must be between 1 and 100 (inclusive).")
+			return
+		}
+	}
+
+	season, err := store.DataStore.GetSeason(seasonID)
+	if err != nil {
+		l.Error().Err(err).Msg("Failed to get season")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+	if season == nil {
+		writeError(w, http.StatusNotFound, "Season Not Found")
+		return
+	}
+
+	standings, total, err := store.DataStore.GetSeasonStandings(seasonID, page, limit)
+	if err != nil {
+		l.Error().Err(err).Msg("Failed to get season standings")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+
+	writeSuccess(w, models.SeasonStandingsResponse{
+		Season:    *season,
+		Standings: standings,
+		Total:     total,
+		Page:      page,
+		Limit:     limit,
+	})
+}
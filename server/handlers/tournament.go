@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"leetcodeduels/config"
+	"leetcodeduels/models"
+	"leetcodeduels/services"
+	"leetcodeduels/store"
+	"leetcodeduels/ws"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const maxTournamentNameLength = 100
+
+func CreateTournament(w http.ResponseWriter, r *http.Request) {
+	l := log.Ctx(r.Context())
+
+	claims, err := services.GetClaimsFromRequest(r)
+	if err != nil {
+		l.Warn().Msg("Attempted to call CreateTournament without valid claims")
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	l.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Int64("user_id", claims.UserID)
+	})
+	l.Info().Msg("Received request for CreateTournament")
+
+	var req models.CreateTournamentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		l.Warn().Err(err).Msg("Failed to decode create tournament request body")
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxTournamentNameLength {
+		writeError(w, http.StatusBadRequest, "A name of at most 100 characters is required")
+		return
+	}
+	format, err := models.ParseTournamentFormat(string(req.Format))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Format must be single_elimination or double_elimination")
+		return
+	}
+	if req.MatchDetails.SeriesTarget > 1 {
+		writeError(w, http.StatusBadRequest, "Tournament matches are single games")
+		return
+	}
+	if clientErr := ws.ValidateMatchDetails(req.MatchDetails); clientErr != nil {
+		writeError(w, http.StatusBadRequest, clientErr.Message)
+		return
+	}
+
+	tournament := models.Tournament{
+		Name:         req.Name,
+		Format:       format,
+		MatchDetails: req.MatchDetails,
+		CreatedBy:    claims.UserID,
+		Players:      []models.TournamentPlayer{},
+		Matches:      []models.TournamentMatch{},
+	}
+	if err := store.DataStore.CreateTournament(&tournament); err != nil {
+		l.Error().Err(err).Msg("Failed to create tournament")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+	l.Info().Int("tournament_id", tournament.ID).Msg("Tournament created")
+
+	writeJSON(w, http.StatusCreated, tournament)
+}
+
+func GetTournament(w http.ResponseWriter, r *http.Request) {
+	l := log.Ctx(r.Context())
+
+	tournamentIDStr := mux.Vars(r)["id"]
+	l.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("tournament_id", tournamentIDStr)
+	})
+	l.Info().Msg("Received request for GetTournament")
+
+	tournamentID, err := strconv.Atoi(tournamentIDStr)
+	if err != nil {
+		l.Warn().Msg("Invalid tournament ID format in path parameter")
+		writeError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	tournament, err := store.DataStore.GetTournament(tournamentID)
+	if err != nil {
+		l.Error().Err(err).Msg("Failed to get tournament")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+	if tournament == nil {
+		writeError(w, http.StatusNotFound, "Tournament Not Found")
+		return
+	}
+
+	writeSuccess(w, tournament)
+}
+
+func RegisterForTournament(w http.ResponseWriter, r *http.Request) {
+	l := log.Ctx(r.Context())
+
+	claims, err := services.GetClaimsFromRequest(r)
+	if err != nil {
+		l.Warn().Msg("Attempted to call RegisterForTournament without valid claims")
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	tournamentIDStr := mux.Vars(r)["id"]
+	l.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("tournament_id", tournamentIDStr).Int64("user_id", claims.UserID)
+	})
+	l.Info().Msg("Received request for RegisterForTournament")
+
+	tournamentID, err := strconv.Atoi(tournamentIDStr)
+	if err != nil {
+		l.Warn().Msg("Invalid tournament ID format in path parameter")
+		writeError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	tournament, err := store.DataStore.GetTournament(tournamentID)
+	if err != nil {
+		l.Error().Err(err).Msg("Failed to get tournament")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+	if tournament == nil {
+		writeError(w, http.StatusNotFound, "Tournament Not Found")
+		return
+	}
+	if len(tournament.Players) >= services.MaxTournamentPlayers {
+		writeError(w, http.StatusConflict, "Tournament is full")
+		return
+	}
+
+	err = store.DataStore.RegisterTournamentPlayer(tournamentID, claims.UserID)
+	switch {
+	case errors.Is(err, store.ErrTournamentNotFound):
+		writeError(w, http.StatusNotFound, "Tournament Not Found")
+		return
+	case errors.Is(err, store.ErrTournamentNotOpen):
+		writeError(w, http.StatusConflict, "Registration has closed")
+		return
+	case errors.Is(err, store.ErrAlreadyRegistered):
+		writeError(w, http.StatusConflict, "Already registered")
+		return
+	case err != nil:
+		l.Error().Err(err).Msg("Failed to register for tournament")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+	l.Info().Msg("User registered for tournament")
+
+	tournament, err = store.DataStore.GetTournament(tournamentID)
+	if err != nil {
+		l.Error().Err(err).Msg("Failed to get tournament")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+	writeSuccess(w, tournament)
+}
+
+// Only the tournament's creator or an admin can start it.
+func StartTournament(w http.ResponseWriter, r *http.Request) {
+	l := log.Ctx(r.Context())
+
+	claims, err := services.GetClaimsFromRequest(r)
+	if err != nil {
+		l.Warn().Msg("Attempted to call StartTournament without valid claims")
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	tournamentIDStr := mux.Vars(r)["id"]
+	l.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("tournament_id", tournamentIDStr).Int64("user_id", claims.UserID)
+	})
+	l.Info().Msg("Received request for StartTournament")
+
+	tournamentID, err := strconv.Atoi(tournamentIDStr)
+	if err != nil {
+		l.Warn().Msg("Invalid tournament ID format in path parameter")
+		writeError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	tournament, err := store.DataStore.GetTournament(tournamentID)
+	if err != nil {
+		l.Error().Err(err).Msg("Failed to get tournament")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+	if tournament == nil {
+		writeError(w, http.StatusNotFound, "Tournament Not Found")
+		return
+	}
+	if tournament.CreatedBy != claims.UserID && !config.GetConfig().IsAdmin(claims.UserID) {
+		l.Warn().Msg("Non-creator attempted to start a tournament")
+		writeError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	tournament, err = services.TournamentManager.StartTournament(tournamentID)
+	switch {
+	case errors.Is(err, store.ErrTournamentNotFound):
+		writeError(w, http.StatusNotFound, "Tournament Not Found")
+		return
+	case errors.Is(err, services.ErrTournamentStarted):
+		writeError(w, http.StatusConflict, "Tournament has already started")
+		return
+	case errors.Is(err, services.ErrTooFewPlayers):
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		l.Error().Err(err).Msg("Failed to start tournament")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+
+	writeSuccess(w, tournament)
+}
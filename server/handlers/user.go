@@ -8,6 +8,7 @@ import (
 	"leetcodeduels/ws"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/zerolog"
@@ -69,14 +70,7 @@ func SearchUsers(w http.ResponseWriter, r *http.Request) {
 
 		var res []models.UserInfoResponse
 		if user != nil {
-			res = append(res, models.UserInfoResponse{
-				ID:            user.ID,
-				Username:      user.Username,
-				Discriminator: user.Discriminator,
-				LCUsername:    user.LeetCodeUsername,
-				AvatarURL:     user.AvatarURL,
-				Rating:        user.Rating,
-			})
+			res = append(res, userInfo(user))
 		}
 		writeSuccess(w, res)
 		return
@@ -100,7 +94,11 @@ func SearchUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeSuccess(w, users)
+	var res []models.UserInfoResponse
+	for i := range users {
+		res = append(res, userInfo(&users[i]))
+	}
+	writeSuccess(w, res)
 }
 
 func GetProfile(w http.ResponseWriter, r *http.Request) {
@@ -133,13 +131,15 @@ func GetProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var res models.UserInfoResponse = models.UserInfoResponse{
-		ID:            profile.ID,
-		Username:      profile.Username,
-		Discriminator: profile.Discriminator,
-		LCUsername:    profile.LeetCodeUsername,
-		AvatarURL:     profile.AvatarURL,
-		Rating:        profile.Rating,
+	res := userInfo(profile)
+	// Skill ratings would give away the rating hidden during placement
+	if !res.Provisional {
+		res.SkillRatings, err = store.DataStore.GetSkillRatings(profile.ID)
+		if err != nil {
+			l.Error().Err(err).Msg("Failed to get skill ratings")
+			writeError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
 	}
 
 	writeSuccess(w, res)
@@ -224,13 +224,15 @@ func MyProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var res models.UserInfoResponse = models.UserInfoResponse{
-		ID:            profile.ID,
-		Username:      profile.Username,
-		Discriminator: profile.Discriminator,
-		LCUsername:    profile.LeetCodeUsername,
-		AvatarURL:     profile.AvatarURL,
-		Rating:        profile.Rating,
+	res := userInfo(profile)
+	// Players can always see their own rating, even during placement
+	res.Rating = profile.Rating
+	res.RatingDeviation = services.EffectiveDeviation(profile.RatingDeviation, profile.Volatility, profile.LastRatedAt)
+	res.SkillRatings, err = store.DataStore.GetSkillRatings(profile.ID)
+	if err != nil {
+		l.Error().Err(err).Msg("Failed to get skill ratings")
+		writeError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
 	}
 
 	writeSuccess(w, res)
@@ -258,6 +260,10 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := services.Leaderboard.Remove(claims.UserID); err != nil {
+		l.Error().Err(err).Msg("Failed to remove deleted user from leaderboard")
+	}
+
 	writeSuccess(w, nil)
 }
 
@@ -376,6 +382,137 @@ func UserMatches(w http.ResponseWriter, r *http.Request) {
 	writeSuccess(w, sessions)
 }
 
+func UserSeries(w http.ResponseWriter, r *http.Request) {
+	l := log.Ctx(r.Context())
+
+	vars := mux.Vars(r)
+	userIDStr := vars["id"]
+
+	query := r.URL.Query()
+	pageStr := query.Get("page")
+	limitStr := query.Get("limit")
+
+	// page is optional param, defaults to 1
+	// limit is optional param, defaults to 10, max 50
+	page := 1
+	limit := 10
+	var err error
+	if pageStr != "" {
+		page, err = strconv.Atoi(pageStr)
+		if err != nil || page < 1 {
+			l.Warn().Msg("UserSeries called with invalid page")
+			writeError(w, http.StatusBadRequest, "Invalid page parameter. Must be a positive integer.")
+			return
+		}
+	}
+	if limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > 50 {
+			l.Warn().Msg("UserSeries called with invalid limit")
+			writeError(w, http.StatusBadRequest, "Invalid limit parameter. Must be between 1 and 50 (inclusive).")
+			return
+		}
+	}
+
+	l.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("user_id", userIDStr).Str("page", pageStr).Str("limit", limitStr)
+	})
+	l.Info().Msg("Received request for UserSeries")
+
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		l.Warn().Msg("Invalid user ID format in path parameter")
+		writeError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	series, err := store.DataStore.GetPlayerSeries(userID, page, limit)
+	if err != nil {
+		l.Error().Err(err).Msg("Failed to get series history")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+
+	writeSuccess(w, series)
+}
+
+func UserRatingHistory(w http.ResponseWriter, r *http.Request) {
+	l := log.Ctx(r.Context())
+
+	claims, err := services.GetClaimsFromRequest(r)
+	if err != nil {
+		l.Warn().Msg("Attempted to call UserRatingHistory without valid claims")
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	vars := mux.Vars(r)
+	userIDStr := vars["id"]
+
+	query := r.URL.Query()
+	fromStr := query.Get("from")
+	toStr := query.Get("to")
+
+	l.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("user_id", userIDStr).Str("from", fromStr).Str("to", toStr)
+	})
+	l.Info().Msg("Received request for UserRatingHistory")
+
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		l.Warn().Msg("Invalid user ID format in path parameter")
+		writeError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	// from and to are optional RFC 3339 timestamps
+	var from, to time.Time
+	if fromStr != "" {
+		from, err = time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			l.Warn().Msg("UserRatingHistory called with invalid from")
+			writeError(w, http.StatusBadRequest, "Invalid from parameter. Must be an RFC 3339 timestamp.")
+			return
+		}
+	}
+	if toStr != "" {
+		to, err = time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			l.Warn().Msg("UserRatingHistory called with invalid to")
+			writeError(w, http.StatusBadRequest, "Invalid to parameter. Must be an RFC 3339 timestamp.")
+			return
+		}
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		l.Warn().Msg("UserRatingHistory called with to before from")
+		writeError(w, http.StatusBadRequest, "Invalid range. to must not be before from.")
+		return
+	}
+
+	// Like their rating, a provisional user's history is only shown to themselves
+	if userID != claims.UserID {
+		profile, err := store.DataStore.GetUserProfile(userID)
+		if err != nil {
+			l.Error().Err(err).Msg("Error fetching user profile")
+			writeError(w, http.StatusInternalServerError, "Internal Error")
+			return
+		}
+		if profile != nil && services.IsProvisional(profile.GamesPlayed) {
+			writeSuccess(w, []models.RatingHistoryEntry{})
+			return
+		}
+	}
+
+	history, err := store.DataStore.GetRatingHistory(userID, from, to)
+	if err != nil {
+		l.Error().Err(err).Msg("Failed to get rating history")
+		writeError(w, http.StatusInternalServerError, "Internal Error")
+		return
+	}
+
+	writeSuccess(w, history)
+}
+
 func MyNotifications(w http.ResponseWriter, r *http.Request) {
 	l := log.Ctx(r.Context())
 
@@ -411,14 +548,7 @@ func MyNotifications(w http.ResponseWriter, r *http.Request) {
 		}
 
 		inviteNotification := models.InviteNotification{
-			FromUser: models.UserInfoResponse{
-				ID:            fromUser.ID,
-				Username:      fromUser.Username,
-				Discriminator: fromUser.Discriminator,
-				LCUsername:    fromUser.LeetCodeUsername,
-				AvatarURL:     fromUser.AvatarURL,
-				Rating:        fromUser.Rating,
-			},
+			FromUser:     userInfo(fromUser),
 			MatchDetails: invite.MatchDetails,
 			CreatedAt:    invite.CreatedAt,
 		}
@@ -431,3 +561,24 @@ func MyNotifications(w http.ResponseWriter, r *http.Request) {
 
 	writeSuccess(w, response)
 }
+
+// Builds the public view of a user, reporting their rating deviation as of now.
+// Ratings of provisional users are hidden until they finish placement.
+func userInfo(u *models.User) models.UserInfoResponse {
+	res := models.UserInfoResponse{
+		ID:              u.ID,
+		Username:        u.Username,
+		Discriminator:   u.Discriminator,
+		LCUsername:      u.LeetCodeUsername,
+		AvatarURL:       u.AvatarURL,
+		Rating:          u.Rating,
+		RatingDeviation: services.EffectiveDeviation(u.RatingDeviation, u.Volatility, u.LastRatedAt),
+		GamesPlayed:     u.GamesPlayed,
+		Provisional:     services.IsProvisional(u.GamesPlayed),
+	}
+	if res.Provisional {
+		res.Rating = 0
+		res.RatingDeviation = 0
+	}
+	return res
+}
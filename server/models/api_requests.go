@@ -5,3 +5,21 @@ type UpdateUserRequest struct {
 	Username         string `json:"username,omitempty"`
 	LeetCodeUsername string `json:"lc_username,omitempty"`
 }
+
+type RevertMatchRequest struct {
+	Reason string `json:"reason"`
+}
+
+type CreateTournamentRequest struct {
+	Name         string           `json:"name"`
+	Format       TournamentFormat `json:"format"`
+	MatchDetails MatchDetails     `json:"matchDetails"`
+}
+
+type CreateLeagueRequest struct {
+	Name         string       `json:"name"`
+	Format       LeagueFormat `json:"format"`
+	MatchDetails MatchDetails `json:"matchDetails"`
+	Rounds       int          `json:"rounds"`     // Swiss only; 0 picks enough rounds to separate the leaders
+	RoundHours   int          `json:"roundHours"` // 0 gives players a week per round
+}
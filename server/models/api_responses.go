@@ -9,12 +9,16 @@ type TokenExchangeResponse struct {
 }
 
 type UserInfoResponse struct {
-	ID            int64  `json:"id"`
-	Username      string `json:"username"`
-	Discriminator string `json:"discriminator"`
-	LCUsername    string `json:"lc_username"`
-	AvatarURL     string `json:"avatar_url"`
-	Rating        int    `json:"rating"`
+	ID              int64         `json:"id"`
+	Username        string        `json:"username"`
+	Discriminator   string        `json:"discriminator"`
+	LCUsername      string        `json:"lc_username"`
+	AvatarURL       string        `json:"avatar_url"`
+	Rating          int           `json:"rating"` // 0 while provisional, except on the user's own profile
+	RatingDeviation float64       `json:"rating_deviation"`
+	GamesPlayed     int           `json:"games_played"`
+	Provisional     bool          `json:"provisional"`             // Still playing placement matches
+	SkillRatings    *SkillRatings `json:"skill_ratings,omitempty"` // Only included on full profiles
 }
 
 type UpdateUserResponse struct {
@@ -47,3 +51,29 @@ type QueueSizeResponse struct {
 type CanSendInviteResponse struct {
 	CanSend bool `json:"can_send"`
 }
+
+type LeaderboardEntry struct {
+	Rank int              `json:"rank"`
+	User UserInfoResponse `json:"user"`
+}
+
+type LeaderboardResponse struct {
+	Entries []LeaderboardEntry `json:"entries"`
+	Total   int                `json:"total"`
+	Page    int                `json:"page"`
+	Limit   int                `json:"limit"`
+	MyRank  *int               `json:"my_rank"` // Nil if the caller is not on the leaderboard
+}
+
+type SeasonStandingsResponse struct {
+	Season    Season           `json:"season"`
+	Standings []SeasonStanding `json:"standings"`
+	Total     int              `json:"total"`
+	Page      int              `json:"page"`
+	Limit     int              `json:"limit"`
+}
+
+type LeagueStandingsResponse struct {
+	League    League           `json:"league"`
+	Standings []LeagueStanding `json:"standings"`
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// How a league pairs its players each round
+type LeagueFormat string
+
+const (
+	RoundRobin LeagueFormat = "round_robin" // Every player meets every other player once
+	Swiss      LeagueFormat = "swiss"       // Players on similar points meet, without rematches
+)
+
+func ParseLeagueFormat(format string) (LeagueFormat, error) {
+	switch format {
+	case "round_robin":
+		return RoundRobin, nil
+	case "swiss":
+		return Swiss, nil
+	default:
+		return "", errors.New("invalid LeagueFormat value")
+	}
+}
+
+type LeagueStatus string
+
+const (
+	LeagueRegistration LeagueStatus = "registration" // Players can still register
+	LeagueInProgress   LeagueStatus = "in_progress"
+	LeagueFinished     LeagueStatus = "finished"
+)
+
+type FixtureStatus string
+
+const (
+	FixtureScheduled FixtureStatus = "scheduled" // Still to be played before its deadline
+	FixturePlayed    FixtureStatus = "played"
+	FixtureForfeited FixtureStatus = "forfeited" // Not played by the deadline
+	FixtureBye       FixtureStatus = "bye"       // The player had nobody to play this round
+)
+
+type League struct {
+	ID           int             `json:"id"`
+	Name         string          `json:"name"`
+	Format       LeagueFormat    `json:"format"`
+	Status       LeagueStatus    `json:"status"`
+	MatchDetails MatchDetails    `json:"matchDetails"` // Every fixture of the league is played with these
+	CreatedBy    int64           `json:"createdBy"`
+	Rounds       int             `json:"rounds"`       // Chosen for Swiss leagues; set when a round robin starts
+	RoundHours   int             `json:"roundHours"`   // How long players have to play each round's fixtures
+	CurrentRound int             `json:"currentRound"` // 0 until the league starts
+	NextRoundAt  *time.Time      `json:"nextRoundAt,omitempty"`
+	Players      []LeaguePlayer  `json:"players"`
+	Fixtures     []LeagueFixture `json:"fixtures"` // Every fixture paired so far, in round order
+	CreatedAt    time.Time       `json:"createdAt"`
+	StartTime    *time.Time      `json:"startTime,omitempty"`
+	EndTime      *time.Time      `json:"endTime,omitempty"`
+}
+
+type LeaguePlayer struct {
+	UserID        int64  `json:"userID"`
+	Username      string `json:"username"`
+	Discriminator string `json:"discriminator"`
+	Rating        int    `json:"rating"` // When the league started, or the current rating before it starts
+}
+
+// A pairing of two players in one round of a league, played through a normal invite
+type LeagueFixture struct {
+	Number    int           `json:"number"` // From 1 across the whole league
+	Round     int           `json:"round"`
+	Players   [2]int64      `json:"players"` // The second player is 0 for a bye
+	Status    FixtureStatus `json:"status"`
+	Winner    int64         `json:"winner"`    // 0 for a draw, a double forfeit or while scheduled
+	SessionID string        `json:"sessionID"` // The session currently deciding the fixture, if any
+	Requested [2]bool       `json:"requested"` // Which players have invited their opponent to play it
+	Deadline  time.Time     `json:"deadline"`
+}
+
+// A player's place in a league's table
+type LeagueStanding struct {
+	Rank          int    `json:"rank"`
+	UserID        int64  `json:"userID"`
+	Username      string `json:"username"`
+	Discriminator string `json:"discriminator"`
+	Played        int    `json:"played"` // Fixtures decided, byes included
+	Wins          int    `json:"wins"`
+	Draws         int    `json:"draws"`
+	Losses        int    `json:"losses"`
+	Points        int    `json:"points"`
+	Buchholz      int    `json:"buchholz"` // Sum of the points of every opponent faced
+}
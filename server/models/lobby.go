@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// A private room players join with a short code instead of being invited by ID. The host picks
+// the match details and starts the game once everyone is in.
+type Lobby struct {
+	Code         string        `json:"code"`
+	HostID       int64         `json:"hostID"`
+	Members      []LobbyMember `json:"members"` // In the order they joined, host included
+	MatchDetails MatchDetails  `json:"matchDetails"`
+	CreatedAt    time.Time     `json:"createdAt"`
+}
+
+type LobbyMember struct {
+	UserID int64 `json:"userID"`
+	Away   bool  `json:"away"` // Disconnected, and removed unless they reconnect in time
+}
+
+// IDs of every member, in the order they joined.
+func (l Lobby) MemberIDs() []int64 {
+	ids := make([]int64, len(l.Members))
+	for i, m := range l.Members {
+		ids[i] = m.UserID
+	}
+	return ids
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"time"
 )
 
@@ -80,6 +81,12 @@ const (
 	Elixir     LanguageType = "elixir"
 )
 
+// Every language a match can be restricted to.
+var Languages = []LanguageType{
+	C, Cpp, Csharp, Java, Python, Python3, Javascript, Typescript, Php, Swift,
+	Kotlin, Dart, Golang, Ruby, Scala, Rust, Racket, Erlang, Elixir,
+}
+
 func ParseLang(lang string) (LanguageType, error) {
 	switch lang {
 	case "c":
@@ -150,11 +157,12 @@ const (
 	MatchWon      MatchStatus = "Won"
 	MatchCanceled MatchStatus = "Canceled"
 	MatchReverted MatchStatus = "Reverted"
+	MatchDraw     MatchStatus = "Draw"
 )
 
 func ParseMatchStatus(status string) (MatchStatus, error) {
 	switch status {
-	case "Accepted":
+	case "Active":
 		return MatchActive, nil
 	case "Won":
 		return MatchWon, nil
@@ -162,6 +170,8 @@ func ParseMatchStatus(status string) (MatchStatus, error) {
 		return MatchCanceled, nil
 	case "Reverted":
 		return MatchReverted, nil
+	case "Draw":
+		return MatchDraw, nil
 	default:
 		return "", errors.New("invalid MatchStatus value")
 	}
@@ -175,7 +185,7 @@ func (s *MatchStatus) UnmarshalJSON(data []byte) error {
 	}
 
 	switch statusStr {
-	case "Active", "Won", "Canceled", "Reverted":
+	case "Active", "Won", "Canceled", "Reverted", "Draw":
 		*s = MatchStatus(statusStr)
 		return nil
 	default:
@@ -183,10 +193,57 @@ func (s *MatchStatus) UnmarshalJSON(data []byte) error {
 	}
 }
 
+// How the winner of a match is decided
+type ScoringMode string
+
+const (
+	ScoringStandard ScoringMode = "standard" // First Accepted submission wins
+	ScoringPartial  ScoringMode = "partial"  // On timeout, the best share of passed test cases wins
+	ScoringOptimize ScoringMode = "optimize" // Accepted solutions are ranked by percentile until the time limit
+	ScoringPenalty  ScoringMode = "penalty"  // Rejected submissions add a time penalty; the lowest adjusted time wins
+)
+
+// An empty mode is the standard one
+func ParseScoringMode(mode string) (ScoringMode, error) {
+	switch mode {
+	case "", "standard":
+		return ScoringStandard, nil
+	case "partial":
+		return ScoringPartial, nil
+	case "optimize":
+		return ScoringOptimize, nil
+	case "penalty":
+		return ScoringPenalty, nil
+	default:
+		return "", errors.New("invalid ScoringMode value")
+	}
+}
+
+// The percentile optimization duels are ranked by
+type OptimizationMetric string
+
+const (
+	OptimizeRuntime OptimizationMetric = "runtime"
+	OptimizeMemory  OptimizationMetric = "memory"
+)
+
+// An empty metric optimizes runtime
+func ParseOptimizationMetric(metric string) (OptimizationMetric, error) {
+	switch metric {
+	case "", "runtime":
+		return OptimizeRuntime, nil
+	case "memory":
+		return OptimizeMemory, nil
+	default:
+		return "", errors.New("invalid OptimizationMetric value")
+	}
+}
+
 // Submission attached to Game Session
 type PlayerSubmission struct {
 	ID                int64            `json:"submissionID"`
 	PlayerID          int64            `json:"playerID"`
+	ProblemID         int              `json:"problemID,omitempty"` // Tells apart the problems of a relay
 	PassedTestCases   int              `json:"passedTestCases"`
 	TotalTestCases    int              `json:"totalTestCases"`
 	Status            SubmissionStatus `json:"status"`
@@ -198,27 +255,187 @@ type PlayerSubmission struct {
 	Time              time.Time        `json:"time"`
 }
 
+// How far a player has got through a relay's problems
+type RelayProgress struct {
+	PlayerID int64 `json:"playerID"`
+	Solved   int   `json:"solved"` // Problems solved so far, in order
+}
+
+// A player's score in a match that is not decided by the first Accepted submission
+type PlayerScore struct {
+	PlayerID        int64      `json:"playerID"`
+	Score           float64    `json:"score"` // Percentage of test cases passed, or the percentile in optimization duels
+	PassedTestCases int        `json:"passedTestCases"`
+	TotalTestCases  int        `json:"totalTestCases"`
+	Runtime         *int32     `json:"runtime,omitempty"`
+	Memory          *int32     `json:"memory,omitempty"`
+	Penalties       int        `json:"penalties,omitempty"`    // Rejected submissions before the first Accepted one
+	PenaltyTime     int64      `json:"penaltyTime,omitempty"`  // Seconds added by the penalties
+	AdjustedTime    int64      `json:"adjustedTime,omitempty"` // Seconds to the first Accepted submission plus penalties
+	SubmissionID    int64      `json:"submissionID,omitempty"` // The submission that was scored, if any
+	SubmittedAt     *time.Time `json:"submittedAt,omitempty"`  // Breaks ties between equal scores
+}
+
+// Rating adjustment a player received from a rated match
+type RatingChange struct {
+	PlayerID       int64   `json:"playerID"`
+	OldRating      int     `json:"oldRating"`
+	NewRating      int     `json:"newRating"`
+	Change         int     `json:"change"`
+	OpponentRating int     `json:"opponentRating"` // Average pre-match rating of the opponents
+	Deviation      float64 `json:"deviation"`      // Rating deviation after the match
+	Volatility     float64 `json:"volatility"`     // Volatility after the match
+	Provisional    bool    `json:"provisional"`    // Still in placement after the match
+}
+
+// Change to one of a player's per-difficulty or per-tag ratings after a rated match.
+// Exactly one of Difficulty and TagID is set.
+type SkillRatingChange struct {
+	PlayerID   int64      `json:"playerID"`
+	Difficulty Difficulty `json:"difficulty,omitempty"`
+	TagID      int        `json:"tagID,omitempty"`
+	OldRating  int        `json:"oldRating"`
+	NewRating  int        `json:"newRating"`
+}
+
+// Who reverted a stored match and why
+type MatchRevert struct {
+	RevertedBy int64     `json:"revertedBy"`
+	RevertedAt time.Time `json:"revertedAt"`
+	Reason     string    `json:"reason"`
+}
+
+// What moved a player's rating
+type RatingHistoryReason string
+
+const (
+	RatingHistoryMatch       RatingHistoryReason = "match"
+	RatingHistorySeasonReset RatingHistoryReason = "season_reset" // Ratings move toward the mean when a season starts
+)
+
+// A single point on a player's rating chart
+type RatingHistoryEntry struct {
+	Reason         RatingHistoryReason `json:"reason"`
+	MatchID        string              `json:"matchID,omitempty"`  // Set for matches
+	SeasonID       int                 `json:"seasonID,omitempty"` // Set for season resets
+	OldRating      int                 `json:"oldRating"`
+	NewRating      int                 `json:"newRating"`
+	OpponentRating int                 `json:"opponentRating,omitempty"`
+	Time           time.Time           `json:"time"`
+}
+
 type Session struct {
-	ID          string             `json:"sessionID"`
-	Status      MatchStatus        `json:"status"`
-	IsRated     bool               `json:"rated"`
-	Problem     Problem            `json:"problem"`
-	Players     []int64            `json:"players"`
-	Submissions []PlayerSubmission `json:"submissions"`
-	Winner      int64              `json:"winner"` // <= 0 if no winner
-	StartTime   time.Time          `json:"startTime"`
-	EndTime     time.Time          `json:"endTime"`
+	ID            string              `json:"sessionID"`
+	Status        MatchStatus         `json:"status"`
+	IsRated       bool                `json:"rated"`
+	Problem       Problem             `json:"problem"`            // The first problem of a relay
+	Problems      []Problem           `json:"problems,omitempty"` // Every problem of a relay, in the order they are solved
+	Progress      []RelayProgress     `json:"progress,omitempty"` // How far each player has got through a relay
+	Players       []int64             `json:"players"`
+	Submissions   []PlayerSubmission  `json:"submissions"`
+	Winner        int64               `json:"winner"`               // <= 0 if no winner
+	Placements    []int64             `json:"placements,omitempty"` // Finishing order, winner first
+	RatingChanges []RatingChange      `json:"ratingChanges,omitempty"`
+	SkillChanges  []SkillRatingChange `json:"skillChanges,omitempty"`
+	Revert        *MatchRevert        `json:"revert,omitempty"`     // Set once an admin reverts the match
+	SeriesID      string              `json:"seriesID,omitempty"`   // Set when the session is part of a series
+	Tournament    *TournamentLink     `json:"tournament,omitempty"` // Set when the session decides a tournament match
+	League        *LeagueLink         `json:"league,omitempty"`     // Set when the session decides a league fixture
+	Ghost         *GhostLink          `json:"ghost,omitempty"`      // Set when the player races a recorded opponent
+	ScoringMode   ScoringMode         `json:"scoringMode"`
+	OptimizeFor   OptimizationMetric  `json:"optimizeFor,omitempty"` // Set for optimization duels
+	Penalty       int                 `json:"penalty,omitempty"`     // Minutes each rejected submission costs in penalty sessions
+	Languages     []LanguageType      `json:"languages,omitempty"`   // Languages submissions may use; empty allows any
+	MatchDetails  MatchDetails        `json:"matchDetails"`          // What the players chose the session to be played with
+	Scores        []PlayerScore       `json:"scores,omitempty"`      // In placement order; only set for scored modes
+	StartTime     time.Time           `json:"startTime"`
+	Deadline      time.Time           `json:"deadline"` // When the game ends if nobody has won yet
+	EndTime       time.Time           `json:"endTime"`
+}
+
+// What a session is played as part of, besides being a game on its own
+type GameLink struct {
+	SeriesID   string
+	Tournament *TournamentLink
+	League     *LeagueLink
+	Ghost      *GhostLink
+}
+
+type TournamentLink struct {
+	TournamentID int `json:"tournamentID"`
+	Match        int `json:"match"` // Number of the match in the bracket
+}
+
+type LeagueLink struct {
+	LeagueID int `json:"leagueID"`
+	Fixture  int `json:"fixture"` // Number of the fixture in the league
+}
+
+// The stored match and player whose submissions a ghost race replays
+type GhostLink struct {
+	MatchID  string `json:"matchID"`
+	PlayerID int64  `json:"playerID"`
+	Finish   int    `json:"finish"` // Index of the replayed submission the ghost finishes with, or -1 if it never does
+}
+
+// The problem the player has to solve next, which outside relays is always the session's only problem.
+// False once they have solved every problem of a relay.
+func (s *Session) CurrentProblem(playerID int64) (Problem, bool) {
+	if len(s.Problems) == 0 {
+		return s.Problem, true
+	}
+	var solved int
+	for _, p := range s.Progress {
+		if p.PlayerID == playerID {
+			solved = p.Solved
+		}
+	}
+	if solved >= len(s.Problems) {
+		return Problem{}, false
+	}
+	return s.Problems[solved], true
+}
+
+// Whether submissions in the given language count in this session
+func (s *Session) AllowsLanguage(lang LanguageType) bool {
+	return len(s.Languages) == 0 || slices.Contains(s.Languages, lang)
 }
 
 type MatchDetails struct {
-	IsRated      bool         `json:"isRated"`
-	Difficulties []Difficulty `json:"difficulties"`
-	Tags         []int        `json:"tags"`
+	IsRated      bool               `json:"isRated"`
+	Difficulties []Difficulty       `json:"difficulties"`
+	Tags         []int              `json:"tags"`
+	SeriesTarget int                `json:"seriesTarget,omitempty"` // Play a first-to-N series instead of a single game
+	TimeLimit    int                `json:"timeLimit,omitempty"`    // Minutes per game; 0 uses the default for the problem's difficulty
+	ScoringMode  ScoringMode        `json:"scoringMode,omitempty"`  // Empty for standard scoring
+	OptimizeFor  OptimizationMetric `json:"optimizeFor,omitempty"`  // Percentile optimization duels are ranked by; empty for runtime
+	Languages    []LanguageType     `json:"languages,omitempty"`    // Languages submissions may use; empty allows any
+	Relay        bool               `json:"relay,omitempty"`        // Solve an Easy, a Medium and a Hard problem in order; Difficulties are ignored
 }
 
 type Invite struct {
 	InviterID    int64        `json:"inviterID"`
-	InviteeID    int64        `json:"inviteeID"`
+	InviteeID    int64        `json:"inviteeID"`            // First invitee, kept for one-on-one clients
+	InviteeIDs   []int64      `json:"inviteeIDs,omitempty"` // Every invitee of a free-for-all invite
 	MatchDetails MatchDetails `json:"matchDetails"`
+	League       *LeagueLink  `json:"league,omitempty"` // Set when the invite is to play a league fixture
 	CreatedAt    time.Time    `json:"createdAt"`
 }
+
+// Returns every invited player.
+func (i Invite) Invitees() []int64 {
+	if len(i.InviteeIDs) > 0 {
+		return i.InviteeIDs
+	}
+	return []int64{i.InviteeID}
+}
+
+type QueueEntry struct {
+	UserID       int64          `json:"userID"`
+	Difficulties []Difficulty   `json:"difficulties"`
+	Tags         []int          `json:"tags"`
+	Languages    []LanguageType `json:"languages,omitempty"`
+	Rating       int            `json:"rating"`
+	TagRating    int            `json:"tagRating,omitempty"` // Rating for the tag when exactly one is queued for
+	JoinedAt     time.Time      `json:"joinedAt"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+type Season struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	Archived  bool      `json:"archived"` // True once final standings have been saved
+}
+
+// A player's final placing in a season
+type SeasonStanding struct {
+	Rank          int    `json:"rank"`
+	UserID        int64  `json:"userID"`
+	Username      string `json:"username"`
+	Discriminator string `json:"discriminator"`
+	Rating        int    `json:"rating"`
+	GamesPlayed   int    `json:"gamesPlayed"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Several sessions between the same two players, played until one of them wins Target games
+type Series struct {
+	ID        string        `json:"seriesID"`
+	Players   []int64       `json:"players"`
+	Target    int           `json:"target"` // Wins needed to take the series
+	IsRated   bool          `json:"rated"`
+	Scores    []SeriesScore `json:"scores"`
+	MatchIDs  []string      `json:"matchIDs"`
+	Winner    int64         `json:"winner"` // <= 0 while the series is still being played
+	StartTime time.Time     `json:"startTime"`
+	EndTime   time.Time     `json:"endTime"`
+}
+
+type SeriesScore struct {
+	PlayerID int64 `json:"playerID"`
+	Wins     int   `json:"wins"`
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// How players are knocked out of a tournament
+type TournamentFormat string
+
+const (
+	SingleElimination TournamentFormat = "single_elimination" // One loss and a player is out
+	DoubleElimination TournamentFormat = "double_elimination" // Players drop to a losers bracket after their first loss
+)
+
+func ParseTournamentFormat(format string) (TournamentFormat, error) {
+	switch format {
+	case "single_elimination":
+		return SingleElimination, nil
+	case "double_elimination":
+		return DoubleElimination, nil
+	default:
+		return "", errors.New("invalid TournamentFormat value")
+	}
+}
+
+type TournamentStatus string
+
+const (
+	TournamentRegistration TournamentStatus = "registration" // Players can still register
+	TournamentInProgress   TournamentStatus = "in_progress"
+	TournamentFinished     TournamentStatus = "finished"
+)
+
+// Which part of a bracket a match belongs to
+type BracketSide string
+
+const (
+	WinnersBracket BracketSide = "winners"
+	LosersBracket  BracketSide = "losers" // Only in double elimination
+	GrandFinal     BracketSide = "final"  // The winners bracket champion against the losers bracket champion
+)
+
+type Tournament struct {
+	ID           int                `json:"id"`
+	Name         string             `json:"name"`
+	Format       TournamentFormat   `json:"format"`
+	Status       TournamentStatus   `json:"status"`
+	MatchDetails MatchDetails       `json:"matchDetails"` // Every match of the tournament is played with these
+	CreatedBy    int64              `json:"createdBy"`
+	Players      []TournamentPlayer `json:"players"` // In seed order once the tournament has started
+	Matches      []TournamentMatch  `json:"matches"` // Empty until the tournament has started
+	Winner       int64              `json:"winner"`  // <= 0 until the tournament is finished
+	CreatedAt    time.Time          `json:"createdAt"`
+	StartTime    *time.Time         `json:"startTime,omitempty"`
+	EndTime      *time.Time         `json:"endTime,omitempty"`
+}
+
+type TournamentPlayer struct {
+	UserID        int64  `json:"userID"`
+	Username      string `json:"username"`
+	Discriminator string `json:"discriminator"`
+	Rating        int    `json:"rating"` // When seeded, or the current rating before the tournament starts
+	Seed          int    `json:"seed"`   // 1 for the highest rated player; 0 before the tournament starts
+}
+
+// A match in a tournament bracket. Players are filled in as the matches feeding it are decided.
+type TournamentMatch struct {
+	Number    int          `json:"number"` // Position in the bracket, from 1
+	Bracket   BracketSide  `json:"bracket"`
+	Round     int          `json:"round"`     // From 1 within its bracket
+	Players   [2]int64     `json:"players"`   // 0 for a slot still to be decided or a bye
+	Winner    int64        `json:"winner"`    // 0 until decided, or if both slots were byes
+	Decided   bool         `json:"decided"`   // Played, or settled by a bye
+	SessionID string       `json:"sessionID"` // The session currently deciding the match, if any
+	WinnerTo  *BracketSlot `json:"winnerTo,omitempty"`
+	LoserTo   *BracketSlot `json:"loserTo,omitempty"` // Set in the winners bracket of a double elimination
+}
+
+// The slot of a later match a player moves to
+type BracketSlot struct {
+	Match int `json:"match"`
+	Slot  int `json:"slot"` // 0 or 1
+}
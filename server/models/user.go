@@ -3,13 +3,61 @@ package models
 import "time"
 
 type User struct {
-	ID               int64     `json:"userID"`
-	AccessToken      string    `json:"token"` // GitHub OAuth Token (SERVER SIDE ONLY)
-	Username         string    `json:"username"`
-	Discriminator    string    `json:"discriminator"`
-	LeetCodeUsername string    `json:"lcUsername"`
-	AvatarURL        string    `json:"avatarUrl"`
-	CreatedAt        time.Time `json:"startDate"`
-	UpdatedAt        time.Time `json:"lastOnline"`
-	Rating           int       `json:"rating"`
+	ID               int64      `json:"userID"`
+	AccessToken      string     `json:"token"` // GitHub OAuth Token (SERVER SIDE ONLY)
+	Username         string     `json:"username"`
+	Discriminator    string     `json:"discriminator"`
+	LeetCodeUsername string     `json:"lcUsername"`
+	AvatarURL        string     `json:"avatarUrl"`
+	CreatedAt        time.Time  `json:"startDate"`
+	UpdatedAt        time.Time  `json:"lastOnline"`
+	Rating           int        `json:"rating"`
+	RatingDeviation  float64    `json:"ratingDeviation"`
+	Volatility       float64    `json:"volatility"`
+	LastRatedAt      *time.Time `json:"lastRatedAt,omitempty"`
+	GamesPlayed      int        `json:"gamesPlayed"` // Number of rated matches finished
+}
+
+// Rating state used to calculate the outcome of a rated match
+type PlayerRating struct {
+	PlayerID    int64
+	Rating      int
+	Deviation   float64
+	Volatility  float64
+	LastRatedAt *time.Time
+	GamesPlayed int
+}
+
+// Restricts the leaderboard to users who meet every set field
+type LeaderboardFilter struct {
+	MinGames    int       // Minimum number of rated matches played
+	ActiveSince time.Time // Must have finished a match at or after this time
+}
+
+func (f LeaderboardFilter) IsSet() bool {
+	return f.MinGames > 0 || !f.ActiveSince.IsZero()
+}
+
+// A user's position on the leaderboard
+type RankedUser struct {
+	UserID int64
+	Rating int
+	Rank   int
+}
+
+// A user's ratings on each difficulty and tag they have played rated matches on
+type SkillRatings struct {
+	Difficulties []DifficultyRating `json:"difficulties"`
+	Tags         []TagRating        `json:"tags"`
+}
+
+type DifficultyRating struct {
+	Difficulty Difficulty `json:"difficulty"`
+	Rating     int        `json:"rating"`
+}
+
+type TagRating struct {
+	TagID   int    `json:"tag_id"`
+	TagName string `json:"tag_name"`
+	Rating  int    `json:"rating"`
 }
@@ -20,6 +20,16 @@ func New(cfg *config.Config) (*http.Server, error) {
 		return nil, fmt.Errorf("failed to initialize data store: %w", err)
 	}
 
+	err = services.InitLeaderboard(cfg.RDB_URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize leaderboard: %w", err)
+	}
+
+	err = services.InitSeasonManager(cfg.RDB_URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize season manager: %w", err)
+	}
+
 	err = services.InitInviteManager(cfg.RDB_URL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize invite manager: %w", err)
@@ -30,6 +40,31 @@ func New(cfg *config.Config) (*http.Server, error) {
 		return nil, fmt.Errorf("failed to initialize game manager: %w", err)
 	}
 
+	err = services.InitSeriesManager(cfg.RDB_URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize series manager: %w", err)
+	}
+
+	err = services.InitTournamentManager(cfg.RDB_URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize tournament manager: %w", err)
+	}
+
+	err = services.InitLeagueManager(cfg.RDB_URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize league manager: %w", err)
+	}
+
+	err = services.InitLobbyManager(cfg.RDB_URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize lobby manager: %w", err)
+	}
+
+	err = services.InitQueueManager(cfg.RDB_URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize queue manager: %w", err)
+	}
+
 	err = ws.InitConnManager(cfg.RDB_URL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize connection manager: %w", err)
@@ -62,7 +97,14 @@ func Cleanup(srv *http.Server) error {
 
 	services.InviteManager.Close()
 	services.GameManager.Close()
+	services.SeriesManager.Close()
+	services.TournamentManager.Close()
+	services.LeagueManager.Close()
 	ws.ConnManager.Close()
+	services.LobbyManager.Close()
+	services.QueueManager.Close()
+	services.SeasonManager.Close()
+	services.Leaderboard.Close()
 
 	return nil
 }
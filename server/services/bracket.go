@@ -0,0 +1,184 @@
+package services
+
+import (
+	"cmp"
+	"leetcodeduels/models"
+	"slices"
+)
+
+// Orders players by rating, highest first, and numbers them from seed 1. Players with equal
+// ratings keep the order they registered in.
+func seedPlayers(players []models.TournamentPlayer) {
+	slices.SortStableFunc(players, func(a, b models.TournamentPlayer) int {
+		return cmp.Compare(b.Rating, a.Rating)
+	})
+	for i := range players {
+		players[i].Seed = i + 1
+	}
+}
+
+// Seeds in the order they fill the first round of a bracket of the given size (a power of two), so
+// that seed 1 meets the lowest seed and the top two seeds can only meet in the final.
+func seedOrder(size int) []int {
+	order := []int{1}
+	for len(order) < size {
+		next := make([]int, 0, len(order)*2)
+		for _, seed := range order {
+			next = append(next, seed, len(order)*2+1-seed)
+		}
+		order = next
+	}
+	return order
+}
+
+// Builds the matches of a bracket for players given in seed order. The bracket is padded to a
+// power of two with byes, which go to the top seeds.
+func generateBracket(format models.TournamentFormat, seeded []int64) []models.TournamentMatch {
+	size := 2
+	for size < len(seeded) {
+		size *= 2
+	}
+
+	var matches []models.TournamentMatch
+	add := func(bracket models.BracketSide, round, count int) []int {
+		numbers := make([]int, count)
+		for i := range numbers {
+			matches = append(matches, models.TournamentMatch{Number: len(matches) + 1, Bracket: bracket, Round: round})
+			numbers[i] = len(matches)
+		}
+		return numbers
+	}
+	match := func(number int) *models.TournamentMatch {
+		return &matches[number-1]
+	}
+
+	// Winners bracket
+	order := seedOrder(size)
+	var winnersRounds [][]int
+	for round, count := 1, size/2; count >= 1; round, count = round+1, count/2 {
+		numbers := add(models.WinnersBracket, round, count)
+		if round == 1 {
+			for i, number := range numbers {
+				for slot := range 2 {
+					if seed := order[i*2+slot]; seed <= len(seeded) {
+						match(number).Players[slot] = seeded[seed-1]
+					}
+				}
+			}
+		} else {
+			for i, number := range winnersRounds[round-2] {
+				match(number).WinnerTo = &models.BracketSlot{Match: numbers[i/2], Slot: i % 2}
+			}
+		}
+		winnersRounds = append(winnersRounds, numbers)
+	}
+	if format == models.SingleElimination {
+		return matches
+	}
+
+	// Losers bracket. Odd rounds pair off the survivors, and even rounds bring in the players who
+	// just lost in the winners bracket, crossed over to put off rematches.
+	var previous []int
+	for round := 1; round <= 2*(len(winnersRounds)-1); round++ {
+		if round == 1 {
+			previous = add(models.LosersBracket, round, size/4)
+			for i, number := range winnersRounds[0] {
+				match(number).LoserTo = &models.BracketSlot{Match: previous[i/2], Slot: i % 2}
+			}
+			continue
+		}
+
+		if round%2 == 0 {
+			numbers := add(models.LosersBracket, round, len(previous))
+			dropping := winnersRounds[round/2]
+			for i, number := range previous {
+				match(number).WinnerTo = &models.BracketSlot{Match: numbers[i], Slot: 0}
+				match(dropping[len(dropping)-1-i]).LoserTo = &models.BracketSlot{Match: numbers[i], Slot: 1}
+			}
+			previous = numbers
+		} else {
+			numbers := add(models.LosersBracket, round, len(previous)/2)
+			for i, number := range previous {
+				match(number).WinnerTo = &models.BracketSlot{Match: numbers[i/2], Slot: i % 2}
+			}
+			previous = numbers
+		}
+	}
+
+	// The grand final is a single match, without a reset if the winners bracket champion loses
+	final := add(models.GrandFinal, 1, 1)[0]
+	winnersFinal := winnersRounds[len(winnersRounds)-1][0]
+	match(winnersFinal).WinnerTo = &models.BracketSlot{Match: final, Slot: 0}
+	if len(previous) > 0 {
+		match(previous[0]).WinnerTo = &models.BracketSlot{Match: final, Slot: 1}
+	} else {
+		match(winnersFinal).LoserTo = &models.BracketSlot{Match: final, Slot: 1}
+	}
+	return matches
+}
+
+// Records the winner of a match and moves both players on to their next matches.
+func decideMatch(matches []models.TournamentMatch, number int, winner int64) {
+	m := &matches[number-1]
+	m.Decided = true
+	m.Winner = winner
+
+	loser := m.Players[0]
+	if loser == winner {
+		loser = m.Players[1]
+	}
+	if m.WinnerTo != nil {
+		matches[m.WinnerTo.Match-1].Players[m.WinnerTo.Slot] = winner
+	}
+	if m.LoserTo != nil {
+		matches[m.LoserTo.Match-1].Players[m.LoserTo.Slot] = loser
+	}
+}
+
+// Settles every match a bye decides, then returns the numbers of the matches that have both
+// players and still need a session to be played.
+func resolveBracket(matches []models.TournamentMatch) []int {
+	// A slot is settled once every match feeding it is decided; slots nothing feeds hold a seed or a bye
+	settled := func(number, slot int) bool {
+		for _, m := range matches {
+			feeds := func(to *models.BracketSlot) bool { return to != nil && to.Match == number && to.Slot == slot }
+			if (feeds(m.WinnerTo) || feeds(m.LoserTo)) && !m.Decided {
+				return false
+			}
+		}
+		return true
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i := range matches {
+			m := &matches[i]
+			if m.Decided || !settled(m.Number, 0) || !settled(m.Number, 1) {
+				continue
+			}
+			if m.Players[0] == 0 || m.Players[1] == 0 {
+				// Whoever is there goes through; a match of two byes sends a bye on
+				winner := m.Players[0]
+				if winner == 0 {
+					winner = m.Players[1]
+				}
+				decideMatch(matches, m.Number, winner)
+				changed = true
+			}
+		}
+	}
+
+	var ready []int
+	for _, m := range matches {
+		if !m.Decided && m.SessionID == "" && m.Players[0] != 0 && m.Players[1] != 0 {
+			ready = append(ready, m.Number)
+		}
+	}
+	return ready
+}
+
+// The champion once the last match of the bracket is decided.
+func bracketWinner(matches []models.TournamentMatch) (int64, bool) {
+	final := matches[len(matches)-1]
+	return final.Winner, final.Decided
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"leetcodeduels/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeedPlayers(t *testing.T) {
+	players := []models.TournamentPlayer{
+		{UserID: 1, Rating: 1200},
+		{UserID: 2, Rating: 1500},
+		{UserID: 3, Rating: 1200},
+		{UserID: 4, Rating: 1800},
+	}
+	seedPlayers(players)
+
+	var order []int64
+	for i, p := range players {
+		assert.Equal(t, i+1, p.Seed)
+		order = append(order, p.UserID)
+	}
+	assert.Equal(t, []int64{4, 2, 1, 3}, order, "equal ratings keep registration order")
+	assert.Equal(t, []int{1, 8, 4, 5, 2, 7, 3, 6}, seedOrder(8))
+}
+
+func TestSingleEliminationBracket(t *testing.T) {
+	matches := generateBracket(models.SingleElimination, []int64{10, 20, 30, 40, 50})
+	require.Len(t, matches, 7)
+
+	// Seeds 1-3 get byes, leaving 4 against 5 and the second round's 2 against 3
+	assert.Equal(t, []int{2, 6}, resolveBracket(matches))
+	assert.Equal(t, [2]int64{40, 50}, matches[1].Players)
+	assert.Equal(t, [2]int64{20, 30}, matches[5].Players)
+	assert.Equal(t, [2]int64{10, 0}, matches[4].Players)
+
+	decideMatch(matches, 2, 50)
+	decideMatch(matches, 6, 20)
+	assert.Equal(t, []int{5}, resolveBracket(matches))
+	assert.Equal(t, [2]int64{10, 50}, matches[4].Players)
+
+	decideMatch(matches, 5, 50)
+	assert.Equal(t, []int{7}, resolveBracket(matches))
+	_, finished := bracketWinner(matches)
+	assert.False(t, finished)
+
+	decideMatch(matches, 7, 20)
+	assert.Empty(t, resolveBracket(matches))
+	winner, finished := bracketWinner(matches)
+	assert.True(t, finished)
+	assert.Equal(t, int64(20), winner)
+}
+
+func TestDoubleEliminationBracket(t *testing.T) {
+	t.Run("losers drop into the losers bracket", func(t *testing.T) {
+		matches := generateBracket(models.DoubleElimination, []int64{1, 2, 3, 4})
+		require.Len(t, matches, 6)
+		assert.Equal(t, models.LosersBracket, matches[3].Bracket)
+		assert.Equal(t, models.GrandFinal, matches[5].Bracket)
+
+		assert.Equal(t, []int{1, 2}, resolveBracket(matches))
+		decideMatch(matches, 1, 1)
+		decideMatch(matches, 2, 3)
+		assert.Equal(t, []int{3, 4}, resolveBracket(matches))
+		assert.Equal(t, [2]int64{4, 2}, matches[3].Players)
+
+		decideMatch(matches, 3, 1)
+		decideMatch(matches, 4, 2)
+		assert.Equal(t, []int{5}, resolveBracket(matches))
+		assert.Equal(t, [2]int64{2, 3}, matches[4].Players)
+
+		decideMatch(matches, 5, 3)
+		assert.Equal(t, []int{6}, resolveBracket(matches))
+		assert.Equal(t, [2]int64{1, 3}, matches[5].Players)
+
+		decideMatch(matches, 6, 3)
+		winner, finished := bracketWinner(matches)
+		assert.True(t, finished)
+		assert.Equal(t, int64(3), winner)
+	})
+
+	t.Run("byes carry through the losers bracket", func(t *testing.T) {
+		matches := generateBracket(models.DoubleElimination, []int64{1, 2, 3})
+		assert.Equal(t, []int{2}, resolveBracket(matches))
+
+		decideMatch(matches, 2, 2)
+		assert.Equal(t, []int{3}, resolveBracket(matches))
+		assert.True(t, matches[3].Decided, "the loser of 2 against 3 has nobody to play")
+		assert.Equal(t, [2]int64{3, 0}, matches[4].Players)
+
+		decideMatch(matches, 3, 1)
+		assert.Equal(t, []int{5}, resolveBracket(matches))
+		assert.Equal(t, [2]int64{3, 2}, matches[4].Players)
+	})
+
+	t.Run("two players meet again in the grand final", func(t *testing.T) {
+		matches := generateBracket(models.DoubleElimination, []int64{1, 2})
+		require.Len(t, matches, 2)
+		decideMatch(matches, 1, 2)
+		assert.Equal(t, []int{2}, resolveBracket(matches))
+		assert.Equal(t, [2]int64{2, 1}, matches[1].Players)
+	})
+}
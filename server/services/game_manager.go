@@ -5,13 +5,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"leetcodeduels/config"
 	"leetcodeduels/models"
 	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
 )
 
 var GameManager *gameManager
@@ -22,28 +25,218 @@ type gameManager struct {
 }
 
 type gameSession struct {
-	ID        string `redis:"id"`
-	Status    string `redis:"status"`
-	IsRated   bool   `redis:"isRated"`
-	Problem   string `redis:"problem"`
-	Players   string `redis:"players"`
-	Winner    int64  `redis:"winner"`
-	StartTime string `redis:"startTime"`
-	EndTime   string `redis:"endTime"`
+	ID         string `redis:"id"`
+	Status     string `redis:"status"`
+	IsRated    bool   `redis:"isRated"`
+	Problem    string `redis:"problem"`
+	Problems   string `redis:"problems"`
+	Players    string `redis:"players"`
+	Winner     int64  `redis:"winner"`
+	Placements string `redis:"placements"`
+	Ratings    string `redis:"ratingChanges"`
+	SeriesID   string `redis:"seriesID"`
+	Tournament string `redis:"tournament"`
+	League     string `redis:"league"`
+	Ghost      string `redis:"ghost"`
+	Scoring    string `redis:"scoringMode"`
+	Optimize   string `redis:"optimizeFor"`
+	Penalty    int    `redis:"penalty"`
+	Languages  string `redis:"languages"`
+	Details    string `redis:"details"`
+	Scores     string `redis:"scores"`
+	StartTime  string `redis:"startTime"`
+	Deadline   string `redis:"deadline"`
+	EndTime    string `redis:"endTime"`
 }
 
 const (
 	gameKeyPrefix       = "game:"        // Hash containing session metadata
 	playerGameKeyPrefix = "player_game:" // String mapping playerID -> sessionID
 	submissionsSuffix   = ":submissions" // List appended to gameKey
+	finishedSuffix      = ":finished"    // List of playerIDs in the order they solved the problem
+	eliminatedSuffix    = ":eliminated"  // List of playerIDs in the order they forfeited
+	drawOffersSuffix    = ":draw_offers" // Set of playerIDs who have offered a draw
+	spectatorsSuffix    = ":spectators"  // Set of userIDs watching the session
+	spectatingKeyPrefix = "spectating:"  // String mapping userID -> sessionID they are watching
+	relaySolvedPrefix   = "solved:"      // Hash field prefix counting a player's solved relay problems
+	gameTimersKey       = "game:timers"  // Sorted set of active sessionIDs scored by deadline
+	rematchSuffix       = ":rematch"     // Hash of playerIDs who want a rematch to whether they asked for a new problem
+	ghostSuffix         = ":ghost"       // List of the submissions a ghost race replays
+	ghostReplaysKey     = "game:ghosts"  // Sorted set of "sessionID:index" scored by when, in ms, to replay the submission
+
+	gameTimerInterval   = time.Second
+	ghostReplayInterval = 250 * time.Millisecond
+
+	MaxTimeLimit = 180 // Longest time limit, in minutes, a player can choose
+
+	RematchWindow = time.Minute // How long after a game ends its players can agree to play again
+)
+
+var (
+	ErrRematchUnavailable  = errors.New("series, tournament, league and ghost games can't be rematched")
+	ErrRematchExpired      = errors.New("the time to ask for a rematch has passed")
+	ErrRematchNotRequested = errors.New("nobody has asked for a rematch")
 )
 
+// Difficulties of a relay's problems, in the order they are solved
+var RelayDifficulties = []models.Difficulty{models.Easy, models.Medium, models.Hard}
+
+// Counts a relay problem as solved if the player had solved exactly ARGV[2] problems before it, so a
+// repeated Accepted submission can't skip ahead. Returns the new count, or -1 if nothing changed.
+var advanceRelayScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "status") ~= "Active" then
+	return -1
+end
+local solved = tonumber(redis.call("HGET", KEYS[1], ARGV[1]) or "0")
+if solved ~= tonumber(ARGV[2]) then
+	return -1
+end
+return redis.call("HINCRBY", KEYS[1], ARGV[1], 1)`)
+
+// Moves a user from the session they were watching, if any, to an active session. Returns 1 if
+// the session is active.
+var addSpectatorScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "status") ~= "Active" then
+	return 0
+end
+local previous = redis.call("GET", KEYS[3])
+if previous then
+	redis.call("SREM", ARGV[2] .. previous .. ARGV[3], ARGV[1])
+end
+redis.call("SADD", KEYS[2], ARGV[1])
+redis.call("SET", KEYS[3], ARGV[4])
+return 1`)
+
+// Marks an active session as won so that no further results are recorded. Returns 1 if it was active.
+var claimTimeoutScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "status") == "Active" then
+	redis.call("HSET", KEYS[1], "status", ARGV[1])
+	return 1
+end
+return 0`)
+
+// Records a player's draw offer while nobody has been placed yet. Once every player has offered,
+// the session is marked as a draw. Ghost races can't be drawn. Returns 0 if the offer was not
+// allowed, 1 if it was recorded and 2 if it completed the agreement.
+var offerDrawScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "status") ~= "Active" then
+	return 0
+end
+local ghost = redis.call("HGET", KEYS[1], "ghost")
+if ghost and ghost ~= "" then
+	return 0
+end
+if redis.call("LLEN", KEYS[3]) + redis.call("LLEN", KEYS[4]) > 0 then
+	return 0
+end
+local players = cjson.decode(redis.call("HGET", KEYS[1], "players"))
+local found = false
+for _, pid in ipairs(players) do
+	if tostring(pid) == ARGV[1] then
+		found = true
+	end
+end
+if not found then
+	return 0
+end
+redis.call("SADD", KEYS[2], ARGV[1])
+if redis.call("SCARD", KEYS[2]) >= #players then
+	redis.call("HSET", KEYS[1], "status", ARGV[2])
+	return 2
+end
+return 1`)
+
+// Appends a player to the finished or eliminated list if they are in the session and not placed yet.
+// Once every player but one is placed, the session is marked won so no later result is recorded.
+// Returns the player's position in the list (0 if nothing was recorded) and 1 if the game is over.
+var recordResultScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "status") ~= "Active" then
+	return {0, 0}
+end
+local players = cjson.decode(redis.call("HGET", KEYS[1], "players"))
+local found = false
+for _, pid in ipairs(players) do
+	if tostring(pid) == ARGV[1] then
+		found = true
+	end
+end
+if not found then
+	return {0, 0}
+end
+for _, key in ipairs({KEYS[3], KEYS[4]}) do
+	for _, pid in ipairs(redis.call("LRANGE", key, 0, -1)) do
+		if pid == ARGV[1] then
+			return {0, 0}
+		end
+	end
+end
+local position = redis.call("RPUSH", KEYS[2], ARGV[1])
+if redis.call("LLEN", KEYS[3]) + redis.call("LLEN", KEYS[4]) >= #players - 1 then
+	redis.call("HSET", KEYS[1], "status", ARGV[2])
+	return {position, 1}
+end
+return {position, 0}`)
+
+// Records that a player wants a rematch and whether they want a new problem. With ARGV[5] set the
+// player can only agree to a rematch someone else asked for. Once every player has agreed the
+// request is used up. Returns -2 if there was nothing to agree to, -1 while players have yet to
+// agree, and otherwise 1 if anyone asked for a new problem or 0 if not.
+var rematchScript = redis.NewScript(`
+if ARGV[5] == "1" and redis.call("EXISTS", KEYS[1]) == 0 then
+	return -2
+end
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+redis.call("PEXPIRE", KEYS[1], ARGV[3])
+if redis.call("HLEN", KEYS[1]) < tonumber(ARGV[4]) then
+	return -1
+end
+local wants = redis.call("HVALS", KEYS[1])
+redis.call("DEL", KEYS[1])
+for _, newProblem in ipairs(wants) do
+	if newProblem == "1" then
+		return 1
+	end
+end
+return 0`)
+
+// Clears a player's current session only if it is still the given one, since they may have
+// moved on to another session already.
+var leaveGameScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
 func gameKey(sessionID string) string {
 	return gameKeyPrefix + sessionID
 }
 func submissionsKey(sessionID string) string {
 	return gameKeyPrefix + sessionID + submissionsSuffix
 }
+func finishedKey(sessionID string) string {
+	return gameKeyPrefix + sessionID + finishedSuffix
+}
+func eliminatedKey(sessionID string) string {
+	return gameKeyPrefix + sessionID + eliminatedSuffix
+}
+func drawOffersKey(sessionID string) string {
+	return gameKeyPrefix + sessionID + drawOffersSuffix
+}
+func ghostKey(sessionID string) string {
+	return gameKeyPrefix + sessionID + ghostSuffix
+}
+func rematchKey(sessionID string) string {
+	return gameKeyPrefix + sessionID + rematchSuffix
+}
+func spectatorsKey(sessionID string) string {
+	return gameKeyPrefix + sessionID + spectatorsSuffix
+}
+func spectatingKey(userID int64) string {
+	return spectatingKeyPrefix + strconv.FormatInt(userID, 10)
+}
+func relaySolvedField(playerID int64) string {
+	return relaySolvedPrefix + strconv.FormatInt(playerID, 10)
+}
 func playerGameKey(playerID int64) string {
 	return playerGameKeyPrefix + strconv.FormatInt(playerID, 10)
 }
@@ -70,7 +263,8 @@ func (gm *gameManager) GetGame(sessionID string) (*models.Session, error) {
 	subKey := submissionsKey(sessionID)
 
 	var gs gameSession
-	if err := gm.client.HGetAll(gm.ctx, key).Scan(&gs); err != nil {
+	res := gm.client.HGetAll(gm.ctx, key)
+	if err := res.Scan(&gs); err != nil {
 		return nil, fmt.Errorf("redis hgetall/scan failed: %w", err)
 	}
 	if gs.ID == "" {
@@ -82,7 +276,15 @@ func (gm *gameManager) GetGame(sessionID string) (*models.Session, error) {
 		return nil, fmt.Errorf("redis lrange failed: %w", err)
 	}
 
-	return gm.assembleSession(&gs, submissionsData)
+	session, err := gm.assembleSession(&gs, submissionsData)
+	if err != nil || len(session.Problems) == 0 {
+		return session, err
+	}
+	for _, pid := range session.Players {
+		solved, _ := strconv.Atoi(res.Val()[relaySolvedField(pid)])
+		session.Progress = append(session.Progress, models.RelayProgress{PlayerID: pid, Solved: solved})
+	}
+	return session, nil
 }
 
 // Returns sessionID associated with playerID, or empty string if no associated session.
@@ -103,58 +305,149 @@ func (gm *gameManager) IsPlayerInGame(playerID int64) (bool, error) {
 	return sid != "", err
 }
 
-// Finds the opponent of a player in a given session.
-func (gm *gameManager) GetOpponent(sessionID string, userID int64) (int64, error) {
+// Finds every other player in a given session.
+func (gm *gameManager) GetOpponents(sessionID string, userID int64) ([]int64, error) {
 	key := gameKey(sessionID)
 	playersData, err := gm.client.HGet(gm.ctx, key, "players").Result()
 	if err == redis.Nil {
-		return 0, errors.New("no session associated with provided sessionID")
+		return nil, errors.New("no session associated with provided sessionID")
 	} else if err != nil {
-		return 0, fmt.Errorf("redis hget failed: %w", err)
+		return nil, fmt.Errorf("redis hget failed: %w", err)
 	}
 
 	var players []int64
 	if err := json.Unmarshal([]byte(playersData), &players); err != nil {
-		return 0, fmt.Errorf("failed to unmarshal players: %w", err)
+		return nil, fmt.Errorf("failed to unmarshal players: %w", err)
 	}
 
+	opponents := make([]int64, 0, len(players)-1)
 	for _, pid := range players {
 		if pid != userID {
-			return pid, nil
+			opponents = append(opponents, pid)
 		}
 	}
+	if len(opponents) == 0 {
+		return nil, errors.New("unknown error retrieving opponents")
+	}
+	return opponents, nil
+}
 
-	return 0, errors.New("unknown error retrieving opponent")
+// Returns how long players have to solve the problems, either as chosen in the details
+// or the configured default for each problem's difficulty added up.
+func TimeLimit(details models.MatchDetails, problems []models.Problem) time.Duration {
+	if details.TimeLimit > 0 {
+		return time.Duration(details.TimeLimit) * time.Minute
+	}
+	cfg := config.GetConfig()
+	var limit time.Duration
+	for _, problem := range problems {
+		switch problem.Difficulty {
+		case models.Easy:
+			limit += time.Duration(cfg.TIME_LIMIT_EASY) * time.Minute
+		case models.Hard:
+			limit += time.Duration(cfg.TIME_LIMIT_HARD) * time.Minute
+		default:
+			limit += time.Duration(cfg.TIME_LIMIT_MEDIUM) * time.Minute
+		}
+	}
+	return limit
 }
 
-// Creates a new session, stores it in Redis, and returns its ID.
-func (gm *gameManager) StartGame(players []int64, problem models.Problem) (string, error) {
+// Creates a new session, stores it in Redis, and returns its ID. Relays are given all of their
+// problems in order; other games have just one. The link ties the session to a series, a
+// tournament match or a league fixture, and is empty for a standalone game.
+func (gm *gameManager) StartGame(players []int64, problems []models.Problem, details models.MatchDetails, link models.GameLink) (string, error) {
 	sessionID := uuid.NewString()
 	key := gameKey(sessionID)
 
-	problemData, err := json.Marshal(problem)
+	problemData, err := json.Marshal(problems[0])
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal problem: %w", err)
 	}
+	var relayData []byte
+	if len(problems) > 1 {
+		if relayData, err = json.Marshal(problems); err != nil {
+			return "", fmt.Errorf("failed to marshal problems: %w", err)
+		}
+	}
+	var tournamentData []byte
+	if link.Tournament != nil {
+		if tournamentData, err = json.Marshal(link.Tournament); err != nil {
+			return "", fmt.Errorf("failed to marshal tournament link: %w", err)
+		}
+	}
+	var leagueData []byte
+	if link.League != nil {
+		if leagueData, err = json.Marshal(link.League); err != nil {
+			return "", fmt.Errorf("failed to marshal league link: %w", err)
+		}
+	}
+	var ghostData []byte
+	if link.Ghost != nil {
+		if ghostData, err = json.Marshal(link.Ghost); err != nil {
+			return "", fmt.Errorf("failed to marshal ghost link: %w", err)
+		}
+	}
 	playersData, err := json.Marshal(players)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal players: %w", err)
 	}
+	languagesData, err := json.Marshal(details.Languages)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal languages: %w", err)
+	}
+	detailsData, err := json.Marshal(details)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal match details: %w", err)
+	}
+
+	scoringMode, err := models.ParseScoringMode(string(details.ScoringMode))
+	if err != nil {
+		return "", err
+	}
+	var optimizeFor models.OptimizationMetric
+	var penalty int
+	if scoringMode == models.ScoringPenalty {
+		penalty = config.GetConfig().SUBMISSION_PENALTY
+	}
+	if scoringMode == models.ScoringOptimize {
+		if optimizeFor, err = models.ParseOptimizationMetric(string(details.OptimizeFor)); err != nil {
+			return "", err
+		}
+	}
+
+	startTime := time.Now()
+	deadline := startTime.Add(TimeLimit(details, problems))
 
 	sessionMap := map[string]interface{}{
-		"id":        sessionID,
-		"status":    string(models.MatchActive),
-		"isRated":   false,
-		"problem":   string(problemData),
-		"players":   string(playersData),
-		"winner":    0,
-		"startTime": time.Now().Format(time.RFC3339Nano),
-		"endTime":   "",
+		"id":          sessionID,
+		"status":      string(models.MatchActive),
+		"isRated":     details.IsRated,
+		"problem":     string(problemData),
+		"problems":    string(relayData),
+		"players":     string(playersData),
+		"winner":      0,
+		"seriesID":    link.SeriesID,
+		"tournament":  string(tournamentData),
+		"league":      string(leagueData),
+		"ghost":       string(ghostData),
+		"scoringMode": string(scoringMode),
+		"optimizeFor": string(optimizeFor),
+		"penalty":     penalty,
+		"languages":   string(languagesData),
+		"details":     string(detailsData),
+		"startTime":   startTime.Format(time.RFC3339Nano),
+		"deadline":    deadline.Format(time.RFC3339Nano),
+		"endTime":     "",
 	}
 
 	if err := gm.client.HSet(gm.ctx, key, sessionMap).Err(); err != nil {
 		return "", fmt.Errorf("failed to store session hash: %w", err)
 	}
+	timer := &redis.Z{Score: float64(deadline.Unix()), Member: sessionID}
+	if err := gm.client.ZAdd(gm.ctx, gameTimersKey, timer).Err(); err != nil {
+		return "", fmt.Errorf("failed to schedule session deadline: %w", err)
+	}
 
 	for _, pid := range players {
 		if err := gm.client.Set(gm.ctx, playerGameKey(pid), sessionID, 0).Err(); err != nil {
@@ -189,14 +482,555 @@ func (gm *gameManager) AddSubmission(sessionID string, submission models.PlayerS
 	return gm.client.RPush(gm.ctx, subKey, data).Err()
 }
 
-// Mark session as completed and sets a 3-minute expiry.
-func (gm *gameManager) CompleteGame(sessionID string, winnerID int64) (*models.Session, error) {
-	return gm.finalizeGame(sessionID, models.MatchWon, winnerID, 3*time.Minute)
+// Counts the next problem of a relay as solved by the player, who had solved the given number
+// of problems before it. Returns how many they have solved now, and false if the submission
+// was a repeat or the game is over.
+func (gm *gameManager) AdvanceRelay(sessionID string, playerID int64, solvedBefore int) (int, bool, error) {
+	solved, err := advanceRelayScript.Run(gm.ctx, gm.client, []string{gameKey(sessionID)},
+		relaySolvedField(playerID), solvedBefore).Int()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to advance relay: %w", err)
+	}
+	if solved < 0 {
+		return 0, false, nil
+	}
+	return solved, true, nil
+}
+
+// Subscribes a user to an active session's events, replacing any session they were already
+// watching. Returns false if the session is not active.
+func (gm *gameManager) AddSpectator(sessionID string, userID int64) (bool, error) {
+	keys := []string{gameKey(sessionID), spectatorsKey(sessionID), spectatingKey(userID)}
+	added, err := addSpectatorScript.Run(gm.ctx, gm.client, keys,
+		userID, gameKeyPrefix, spectatorsSuffix, sessionID).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to add spectator: %w", err)
+	}
+	return added == 1, nil
+}
+
+// Stops a user watching the session they were spectating, if any, and returns its ID.
+func (gm *gameManager) RemoveSpectator(userID int64) (string, error) {
+	key := spectatingKey(userID)
+	pipe := gm.client.TxPipeline()
+	getResult := pipe.Get(gm.ctx, key)
+	pipe.Del(gm.ctx, key)
+	if _, err := pipe.Exec(gm.ctx); err != nil && err != redis.Nil {
+		return "", fmt.Errorf("redis transaction failed: %w", err)
+	}
+
+	sessionID, err := getResult.Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("redis get failed: %w", err)
+	}
+	if err := gm.client.SRem(gm.ctx, spectatorsKey(sessionID), userID).Err(); err != nil {
+		return "", fmt.Errorf("redis srem failed: %w", err)
+	}
+	return sessionID, nil
+}
+
+// Returns every user watching a session. They are still listed for a short while after it
+// ends so that they can be told the result.
+func (gm *gameManager) GetSpectators(sessionID string) ([]int64, error) {
+	members, err := gm.client.SMembers(gm.ctx, spectatorsKey(sessionID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis smembers failed: %w", err)
+	}
+	spectators := make([]int64, 0, len(members))
+	for _, m := range members {
+		id, err := strconv.ParseInt(m, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid spectator ID %q: %w", m, err)
+		}
+		spectators = append(spectators, id)
+	}
+	return spectators, nil
+}
+
+// Records that a player solved the problem. Returns their finishing position, which is 0 if
+// they were already placed or the game is over, and whether every other player is now placed.
+func (gm *gameManager) RecordFinish(sessionID string, playerID int64) (int, bool, error) {
+	return gm.recordResult(sessionID, finishedKey(sessionID), playerID)
+}
+
+// In penalty sessions solving the problem doesn't end the game, since a player who solves it later
+// with fewer penalties can still win. Once the best adjusted time has passed nobody can beat it, so
+// the session's deadline is brought forward to that point. Returns true if the session is decided
+// already, either because that point has passed or because every remaining player has solved it.
+func (gm *gameManager) RecordPenaltySolve(sessionID string) (bool, error) {
+	session, err := gm.GetGame(sessionID)
+	if err != nil || session == nil || session.Status != models.MatchActive {
+		return false, err
+	}
+	eliminated, err := gm.playerList(eliminatedKey(sessionID))
+	if err != nil {
+		return false, err
+	}
+
+	allSolved := true
+	var best *models.PlayerScore
+	for _, pid := range session.Players {
+		if slices.Contains(eliminated, pid) {
+			continue
+		}
+		score := ScorePlayer(session, pid)
+		if score.SubmittedAt == nil {
+			allSolved = false
+		} else if best == nil || compareScores(session.ScoringMode, score, *best) < 0 {
+			best = &score
+		}
+	}
+	if best == nil {
+		return false, nil
+	}
+
+	decidedAt := session.StartTime.Add(time.Duration(best.AdjustedTime) * time.Second)
+	if allSolved || !decidedAt.After(time.Now()) {
+		return true, nil
+	}
+	if decidedAt.Before(session.Deadline) {
+		// XX so a session whose timer was already claimed isn't scheduled again
+		timer := &redis.Z{Score: float64(decidedAt.Unix()), Member: sessionID}
+		if err := gm.client.ZAddXX(gm.ctx, gameTimersKey, timer).Err(); err != nil {
+			return false, fmt.Errorf("failed to reschedule session deadline: %w", err)
+		}
+	}
+	return false, nil
+}
+
+// Records that a player forfeited, returning the same values as RecordFinish.
+func (gm *gameManager) RecordElimination(sessionID string, playerID int64) (int, bool, error) {
+	return gm.recordResult(sessionID, eliminatedKey(sessionID), playerID)
+}
+
+func (gm *gameManager) recordResult(sessionID, listKey string, playerID int64) (int, bool, error) {
+	keys := []string{gameKey(sessionID), listKey, finishedKey(sessionID), eliminatedKey(sessionID)}
+	res, err := recordResultScript.Run(gm.ctx, gm.client, keys, playerID, string(models.MatchWon)).Int64Slice()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to record result: %w", err)
+	}
+	return int(res[0]), res[1] == 1, nil
+}
+
+// Records that a player would accept a draw. Draws can only be agreed before anyone has finished
+// or forfeited. Returns whether the offer was recorded and whether every player has now agreed,
+// in which case the caller should end the game with DrawGame.
+func (gm *gameManager) OfferDraw(sessionID string, playerID int64) (bool, bool, error) {
+	keys := []string{gameKey(sessionID), drawOffersKey(sessionID), finishedKey(sessionID), eliminatedKey(sessionID)}
+	res, err := offerDrawScript.Run(gm.ctx, gm.client, keys, playerID, string(models.MatchDraw)).Int()
+	if err != nil {
+		return false, false, fmt.Errorf("failed to record draw offer: %w", err)
+	}
+	return res > 0, res == 2, nil
+}
+
+// Ends a session that every player agreed to draw.
+func (gm *gameManager) DrawGame(sessionID string) (*models.Session, error) {
+	return gm.completeGame(sessionID, nil)
+}
+
+// Mark session as completed and sets a 3-minute expiry. Players are placed in the order they
+// finished, then anyone still playing, then those who forfeited with the last to give up first.
+// Rated sessions also get their players' rating changes calculated.
+func (gm *gameManager) CompleteGame(sessionID string) (*models.Session, error) {
+	players, finished, eliminated, err := gm.results(sessionID)
+	if err != nil || players == nil {
+		return nil, err
+	}
+	ghost, err := gm.ghostLink(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if ghost != nil {
+		return gm.completeGame(sessionID, ghostRacePlacements(players[0], ghost.PlayerID, finished, eliminated, false))
+	}
+
+	placements := slices.Clone(finished)
+	for _, pid := range players {
+		if !slices.Contains(finished, pid) && !slices.Contains(eliminated, pid) {
+			placements = append(placements, pid)
+		}
+	}
+	placements = append(placements, reversed(eliminated)...)
+	return gm.completeGame(sessionID, placements)
+}
+
+// Ends a session whose deadline has passed, or a penalty session that has been decided. Players
+// who finished keep their places; everyone still playing is ranked under the session's scoring
+// mode. Returns nil if the session already ended some other way.
+func (gm *gameManager) TimeoutGame(sessionID string) (*models.Session, error) {
+	claimed, err := claimTimeoutScript.Run(gm.ctx, gm.client, []string{gameKey(sessionID)}, string(models.MatchWon)).Int()
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim timed out game: %w", err)
+	}
+	if claimed == 0 {
+		return nil, nil
+	}
+
+	_, finished, eliminated, err := gm.results(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	session, err := gm.GetGame(sessionID)
+	if err != nil || session == nil {
+		return nil, err
+	}
+
+	placements := timeoutPlacements(session, finished, eliminated)
+	if session.Ghost != nil {
+		placements = ghostRacePlacements(session.Players[0], session.Ghost.PlayerID, finished, eliminated, false)
+	}
+	return gm.completeGame(sessionID, placements)
+}
+
+// Ends a ghost race the ghost has finished while the player is still racing. Returns nil if the
+// race already ended some other way.
+func (gm *gameManager) GhostFinished(sessionID string) (*models.Session, error) {
+	claimed, err := claimTimeoutScript.Run(gm.ctx, gm.client, []string{gameKey(sessionID)}, string(models.MatchWon)).Int()
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim ghost race: %w", err)
+	}
+	if claimed == 0 {
+		return nil, nil
+	}
+	session, err := gm.GetGame(sessionID)
+	if err != nil || session == nil || session.Ghost == nil {
+		return nil, err
+	}
+	return gm.completeGame(sessionID, ghostRacePlacements(session.Players[0], session.Ghost.PlayerID, nil, nil, true))
+}
+
+// Finalizes a session with the given standings and calculates rating changes for rated sessions.
+// A session without placements is a draw, which rates every player as tied. Once the session is
+// finalized it is always returned so the caller can announce and store the result; a rated session
+// whose ratings can't be calculated is stored unrated instead.
+func (gm *gameManager) completeGame(sessionID string, placements []int64) (*models.Session, error) {
+	status := models.MatchWon
+	if len(placements) == 0 {
+		status = models.MatchDraw
+	}
+	session, err := gm.finalizeGame(sessionID, status, placements, 3*time.Minute)
+	if err != nil || session == nil {
+		return session, err
+	}
+
+	if session.Scores = sessionScores(session); session.Scores != nil {
+		data, err := json.Marshal(session.Scores)
+		if err == nil {
+			err = gm.client.HSet(gm.ctx, gameKey(sessionID), "scores", data).Err()
+		}
+		if err != nil {
+			log.Error().Err(err).Str("session_id", sessionID).Msg("Failed to store scores")
+		}
+	}
+	if !session.IsRated {
+		return session, nil
+	}
+
+	if err := gm.rateSession(session); err != nil {
+		log.Error().Err(err).Str("session_id", sessionID).Msg("Failed to rate session, storing it unrated")
+		session.IsRated = false
+		_ = gm.client.HSet(gm.ctx, gameKey(sessionID), "isRated", false).Err()
+	}
+	return session, nil
+}
+
+// Calculates a finished session's rating and skill rating changes, setting them only if both
+// succeed.
+func (gm *gameManager) rateSession(session *models.Session) error {
+	changes, err := CalculateRatingChanges(session)
+	if err != nil {
+		return fmt.Errorf("failed to calculate rating changes: %w", err)
+	}
+	// Skill changes are only needed until the match is stored, so they are not kept in Redis
+	skillChanges, err := CalculateSkillChanges(session)
+	if err != nil {
+		return fmt.Errorf("failed to calculate skill rating changes: %w", err)
+	}
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return fmt.Errorf("failed to marshal rating changes: %w", err)
+	}
+	if err := gm.client.HSet(gm.ctx, gameKey(session.ID), "ratingChanges", data).Err(); err != nil {
+		return fmt.Errorf("failed to store rating changes: %w", err)
+	}
+
+	session.RatingChanges = changes
+	session.SkillChanges = skillChanges
+	return nil
 }
 
 // Mark session as canceled and sets a 3-minute expiry.
 func (gm *gameManager) CancelGame(sessionID string) (*models.Session, error) {
-	return gm.finalizeGame(sessionID, models.MatchCanceled, 0, 3*time.Minute)
+	return gm.finalizeGame(sessionID, models.MatchCanceled, nil, 3*time.Minute)
+}
+
+// Returns a session's players along with those who finished and those who forfeited, in order.
+// All are nil if the session does not exist.
+func (gm *gameManager) results(sessionID string) (players, finished, eliminated []int64, err error) {
+	playersData, err := gm.client.HGet(gm.ctx, gameKey(sessionID), "players").Result()
+	if err == redis.Nil {
+		return nil, nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("redis hget failed: %w", err)
+	}
+	if err := json.Unmarshal([]byte(playersData), &players); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to unmarshal players: %w", err)
+	}
+
+	if finished, err = gm.playerList(finishedKey(sessionID)); err != nil {
+		return nil, nil, nil, err
+	}
+	if eliminated, err = gm.playerList(eliminatedKey(sessionID)); err != nil {
+		return nil, nil, nil, err
+	}
+	return players, finished, eliminated, nil
+}
+
+func (gm *gameManager) playerList(key string) ([]int64, error) {
+	ids, err := gm.client.LRange(gm.ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis lrange failed: %w", err)
+	}
+	players := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		pid, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid player ID %q: %w", id, err)
+		}
+		players = append(players, pid)
+	}
+	return players, nil
+}
+
+// Standings for a session that ran out of time. Players still playing are ordered by the most
+// test cases they passed in any submission (in relays, by problems solved and then test cases
+// passed on the next one), or in scored modes by their best score with earlier submissions
+// ahead. If nobody finished and the leaders are tied the game is a draw, so no placements
+// are returned.
+func timeoutPlacements(session *models.Session, finished, eliminated []int64) []int64 {
+	var compare func(a, b int64) int
+	if session.ScoringMode == models.ScoringStandard {
+		solved := make(map[int64]int, len(session.Progress))
+		for _, p := range session.Progress {
+			solved[p.PlayerID] = p.Solved
+		}
+		best := make(map[int64]int, len(session.Players))
+		for _, sub := range session.Submissions {
+			// In relays only the problem a player is stuck on counts
+			if current, _ := session.CurrentProblem(sub.PlayerID); sub.ProblemID != 0 && sub.ProblemID != current.ID {
+				continue
+			}
+			best[sub.PlayerID] = max(best[sub.PlayerID], sub.PassedTestCases)
+		}
+		compare = func(a, b int64) int {
+			if solved[a] != solved[b] {
+				return solved[b] - solved[a]
+			}
+			return best[b] - best[a]
+		}
+	} else {
+		scores := make(map[int64]models.PlayerScore, len(session.Players))
+		for _, pid := range session.Players {
+			scores[pid] = ScorePlayer(session, pid)
+		}
+		compare = func(a, b int64) int {
+			return compareScores(session.ScoringMode, scores[a], scores[b])
+		}
+	}
+
+	var playing []int64
+	for _, pid := range session.Players {
+		if !slices.Contains(finished, pid) && !slices.Contains(eliminated, pid) {
+			playing = append(playing, pid)
+		}
+	}
+	slices.SortStableFunc(playing, compare)
+
+	if len(finished) == 0 && len(playing) > 1 && compare(playing[0], playing[1]) == 0 {
+		return nil
+	}
+
+	placements := append(slices.Clone(finished), playing...)
+	return append(placements, reversed(eliminated)...)
+}
+
+func reversed(ids []int64) []int64 {
+	out := slices.Clone(ids)
+	slices.Reverse(out)
+	return out
+}
+
+// Ends sessions as their deadlines pass until ctx is canceled, calling onExpire for each one.
+// Every node runs this loop; removing a session from the timer set claims it for one node.
+func (gm *gameManager) RunTimers(ctx context.Context, onExpire func(sessionID string)) {
+	ticker := time.NewTicker(gameTimerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, err := gm.client.ZRangeByScore(gm.ctx, gameTimersKey, &redis.ZRangeBy{
+				Min: "-inf",
+				Max: strconv.FormatInt(time.Now().Unix(), 10),
+			}).Result()
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to read game timers")
+				continue
+			}
+			for _, sessionID := range expired {
+				removed, err := gm.client.ZRem(gm.ctx, gameTimersKey, sessionID).Result()
+				if err != nil {
+					log.Error().Err(err).Str("session_id", sessionID).Msg("Failed to claim game timer")
+					continue
+				}
+				if removed == 1 {
+					go onExpire(sessionID)
+				}
+			}
+		}
+	}
+}
+
+// Records that a player of a finished session wants to play the same players again, and whether
+// they want a different problem. Returns true once every player has asked or agreed, which uses
+// up the request, along with whether any of them wanted a new problem.
+func (gm *gameManager) RequestRematch(session *models.Session, playerID int64, newProblem bool) (bool, bool, error) {
+	return gm.rematch(session, playerID, newProblem, false)
+}
+
+// Agrees to a rematch another player of the session asked for. Returns the same as RequestRematch.
+func (gm *gameManager) AcceptRematch(session *models.Session, playerID int64) (bool, bool, error) {
+	return gm.rematch(session, playerID, false, true)
+}
+
+func (gm *gameManager) rematch(session *models.Session, playerID int64, newProblem, accepting bool) (bool, bool, error) {
+	if session.SeriesID != "" || session.Tournament != nil || session.League != nil || session.Ghost != nil {
+		return false, false, ErrRematchUnavailable
+	}
+	remaining := time.Until(session.EndTime.Add(RematchWindow))
+	if session.EndTime.IsZero() || remaining <= 0 {
+		return false, false, ErrRematchExpired
+	}
+
+	res, err := rematchScript.Run(gm.ctx, gm.client, []string{rematchKey(session.ID)},
+		playerID, newProblem, remaining.Milliseconds(), len(session.Players), accepting).Int()
+	if err != nil {
+		return false, false, fmt.Errorf("failed to record rematch: %w", err)
+	}
+	switch res {
+	case -2:
+		return false, false, ErrRematchNotRequested
+	case -1:
+		return false, false, nil
+	}
+	return true, res == 1, nil
+}
+
+// Schedules a ghost race's recorded submissions to be replayed at the same offsets from the
+// race's start as they were made at from the recorded match's start.
+func (gm *gameManager) ScheduleGhostReplay(sessionID string, recordedStart time.Time, timeline []models.PlayerSubmission) error {
+	if len(timeline) == 0 {
+		return nil
+	}
+	startData, err := gm.client.HGet(gm.ctx, gameKey(sessionID), "startTime").Result()
+	if err != nil {
+		return fmt.Errorf("failed to get ghost race start: %w", err)
+	}
+	start, err := time.Parse(time.RFC3339Nano, startData)
+	if err != nil {
+		return fmt.Errorf("failed to parse ghost race start: %w", err)
+	}
+
+	subs := make([]interface{}, len(timeline))
+	replays := make([]*redis.Z, len(timeline))
+	for i, sub := range timeline {
+		sub.Time = start.Add(max(sub.Time.Sub(recordedStart), 0))
+		data, err := json.Marshal(sub)
+		if err != nil {
+			return fmt.Errorf("failed to marshal ghost submission: %w", err)
+		}
+		subs[i] = data
+		replays[i] = &redis.Z{Score: float64(sub.Time.UnixMilli()), Member: sessionID + ":" + strconv.Itoa(i)}
+	}
+
+	pipe := gm.client.TxPipeline()
+	pipe.RPush(gm.ctx, ghostKey(sessionID), subs...)
+	pipe.ZAdd(gm.ctx, ghostReplaysKey, replays...)
+	if _, err := pipe.Exec(gm.ctx); err != nil {
+		return fmt.Errorf("failed to schedule ghost replay: %w", err)
+	}
+	return nil
+}
+
+// Returns the ghost race submission at the index, with its time moved into the race.
+func (gm *gameManager) GhostSubmission(sessionID string, index int) (*models.PlayerSubmission, error) {
+	data, err := gm.client.LIndex(gm.ctx, ghostKey(sessionID), int64(index)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("redis lindex failed: %w", err)
+	}
+	var sub models.PlayerSubmission
+	if err := json.Unmarshal([]byte(data), &sub); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal ghost submission: %w", err)
+	}
+	return &sub, nil
+}
+
+// Calls onReplay with each ghost race submission as its time comes. Each is claimed by a single node.
+func (gm *gameManager) RunGhostReplays(ctx context.Context, onReplay func(sessionID string, index int)) {
+	ticker := time.NewTicker(ghostReplayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			due, err := gm.client.ZRangeByScore(gm.ctx, ghostReplaysKey, &redis.ZRangeBy{
+				Min: "-inf",
+				Max: strconv.FormatInt(time.Now().UnixMilli(), 10),
+			}).Result()
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to read ghost replays")
+				continue
+			}
+			for _, entry := range due {
+				removed, err := gm.client.ZRem(gm.ctx, ghostReplaysKey, entry).Result()
+				if err != nil {
+					log.Error().Err(err).Str("entry", entry).Msg("Failed to claim ghost replay")
+					continue
+				}
+				sessionID, i, _ := strings.Cut(entry, ":")
+				index, err := strconv.Atoi(i)
+				if removed == 1 && err == nil {
+					go onReplay(sessionID, index)
+				}
+			}
+		}
+	}
+}
+
+// The recorded opponent of a ghost race, or nil for any other session.
+func (gm *gameManager) ghostLink(sessionID string) (*models.GhostLink, error) {
+	data, err := gm.client.HGet(gm.ctx, gameKey(sessionID), "ghost").Result()
+	if err == redis.Nil || data == "" {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("redis hget failed: %w", err)
+	}
+	var ghost models.GhostLink
+	if err := json.Unmarshal([]byte(data), &ghost); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal ghost link: %w", err)
+	}
+	return &ghost, nil
 }
 
 func (gm *gameManager) Close() error {
@@ -204,7 +1038,8 @@ func (gm *gameManager) Close() error {
 }
 
 // finalizeGame is a common helper for completing or canceling a game.
-func (gm *gameManager) finalizeGame(sessionID string, status models.MatchStatus, winnerID int64, expiry time.Duration) (*models.Session, error) {
+// The winner is the first of the placements, if any.
+func (gm *gameManager) finalizeGame(sessionID string, status models.MatchStatus, placements []int64, expiry time.Duration) (*models.Session, error) {
 	key := gameKey(sessionID)
 	subKey := submissionsKey(sessionID)
 
@@ -214,10 +1049,20 @@ func (gm *gameManager) finalizeGame(sessionID string, status models.MatchStatus,
 		// Proceed with finalization anyway
 	}
 
+	var winnerID int64
+	if len(placements) > 0 {
+		winnerID = placements[0]
+	}
+	placementsData, err := json.Marshal(placements)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal placements: %w", err)
+	}
+
 	updates := map[string]interface{}{
-		"status":  string(status),
-		"winner":  winnerID,
-		"endTime": time.Now().Format(time.RFC3339Nano),
+		"status":     string(status),
+		"winner":     winnerID,
+		"placements": string(placementsData),
+		"endTime":    time.Now().Format(time.RFC3339Nano),
 	}
 	if err := gm.client.HSet(gm.ctx, key, updates).Err(); err != nil {
 		return nil, fmt.Errorf("failed to finalize game hash: %w", err)
@@ -225,12 +1070,27 @@ func (gm *gameManager) finalizeGame(sessionID string, status models.MatchStatus,
 
 	_ = gm.client.Expire(gm.ctx, key, expiry).Err()
 	_ = gm.client.Expire(gm.ctx, subKey, expiry).Err()
+	_ = gm.client.Expire(gm.ctx, finishedKey(sessionID), expiry).Err()
+	_ = gm.client.Expire(gm.ctx, eliminatedKey(sessionID), expiry).Err()
+	_ = gm.client.Expire(gm.ctx, drawOffersKey(sessionID), expiry).Err()
+	_ = gm.client.Expire(gm.ctx, spectatorsKey(sessionID), expiry).Err()
+	_ = gm.client.Expire(gm.ctx, ghostKey(sessionID), expiry).Err()
+	_ = gm.client.ZRem(gm.ctx, gameTimersKey, sessionID).Err()
 
 	if playersData != "" {
 		var players []int64
 		if json.Unmarshal([]byte(playersData), &players) == nil {
 			for _, pid := range players {
-				_ = gm.client.Del(gm.ctx, playerGameKey(pid)).Err()
+				_ = leaveGameScript.Run(gm.ctx, gm.client, []string{playerGameKey(pid)}, sessionID).Err()
+			}
+		}
+	}
+
+	// Spectators stay in the set to hear the result but are no longer watching anything
+	if spectators, err := gm.GetSpectators(sessionID); err == nil {
+		for _, uid := range spectators {
+			if watching, _ := gm.client.Get(gm.ctx, spectatingKey(uid)).Result(); watching == sessionID {
+				_ = gm.client.Del(gm.ctx, spectatingKey(uid)).Err()
 			}
 		}
 	}
@@ -247,10 +1107,32 @@ func (gm *gameManager) assembleSession(gs *gameSession, submissionsData []string
 	session.Status, _ = models.ParseMatchStatus(gs.Status)
 	session.IsRated = gs.IsRated
 	session.Winner = gs.Winner
+	session.SeriesID = gs.SeriesID
+	if gs.Tournament != "" {
+		if err = json.Unmarshal([]byte(gs.Tournament), &session.Tournament); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal tournament link: %w", err)
+		}
+	}
+	if gs.League != "" {
+		if err = json.Unmarshal([]byte(gs.League), &session.League); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal league link: %w", err)
+		}
+	}
+	if gs.Ghost != "" {
+		if err = json.Unmarshal([]byte(gs.Ghost), &session.Ghost); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal ghost link: %w", err)
+		}
+	}
+	session.ScoringMode, _ = models.ParseScoringMode(gs.Scoring)
+	session.OptimizeFor = models.OptimizationMetric(gs.Optimize)
+	session.Penalty = gs.Penalty
 
 	if gs.StartTime != "" {
 		session.StartTime, _ = time.Parse(time.RFC3339Nano, gs.StartTime)
 	}
+	if gs.Deadline != "" {
+		session.Deadline, _ = time.Parse(time.RFC3339Nano, gs.Deadline)
+	}
 	if gs.EndTime != "" {
 		session.EndTime, _ = time.Parse(time.RFC3339Nano, gs.EndTime)
 	}
@@ -261,6 +1143,36 @@ func (gm *gameManager) assembleSession(gs *gameSession, submissionsData []string
 	if err = json.Unmarshal([]byte(gs.Players), &session.Players); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal players: %w", err)
 	}
+	if gs.Problems != "" {
+		if err = json.Unmarshal([]byte(gs.Problems), &session.Problems); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal problems: %w", err)
+		}
+	}
+	if gs.Placements != "" {
+		if err = json.Unmarshal([]byte(gs.Placements), &session.Placements); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal placements: %w", err)
+		}
+	}
+	if gs.Languages != "" {
+		if err = json.Unmarshal([]byte(gs.Languages), &session.Languages); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal languages: %w", err)
+		}
+	}
+	if gs.Details != "" {
+		if err = json.Unmarshal([]byte(gs.Details), &session.MatchDetails); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal match details: %w", err)
+		}
+	}
+	if gs.Scores != "" {
+		if err = json.Unmarshal([]byte(gs.Scores), &session.Scores); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal scores: %w", err)
+		}
+	}
+	if gs.Ratings != "" {
+		if err = json.Unmarshal([]byte(gs.Ratings), &session.RatingChanges); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal rating changes: %w", err)
+		}
+	}
 
 	session.Submissions = make([]models.PlayerSubmission, 0, len(submissionsData))
 	for _, subData := range submissionsData {
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"leetcodeduels/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeoutPlacements(t *testing.T) {
+	subs := []models.PlayerSubmission{
+		{PlayerID: 1, PassedTestCases: 10},
+		{PlayerID: 2, PassedTestCases: 40},
+		{PlayerID: 1, PassedTestCases: 30},
+	}
+	standard := func(players []int64, subs []models.PlayerSubmission) *models.Session {
+		return &models.Session{ScoringMode: models.ScoringStandard, Players: players, Submissions: subs}
+	}
+
+	t.Run("most passed test cases wins", func(t *testing.T) {
+		assert.Equal(t, []int64{2, 1}, timeoutPlacements(standard([]int64{1, 2}, subs), nil, nil))
+	})
+
+	t.Run("tied leaders draw", func(t *testing.T) {
+		assert.Nil(t, timeoutPlacements(standard([]int64{1, 2}, nil), nil, nil))
+		tied := append(subs, models.PlayerSubmission{PlayerID: 1, PassedTestCases: 40})
+		assert.Nil(t, timeoutPlacements(standard([]int64{1, 2}, tied), nil, nil))
+	})
+
+	t.Run("finished and eliminated players keep their places", func(t *testing.T) {
+		placements := timeoutPlacements(standard([]int64{1, 2, 3, 4, 5}, subs), []int64{3}, []int64{4, 5})
+		assert.Equal(t, []int64{3, 2, 1, 5, 4}, placements)
+	})
+
+	t.Run("partial scoring ranks by share of test cases then submission time", func(t *testing.T) {
+		start := time.Now()
+		session := &models.Session{
+			ScoringMode: models.ScoringPartial,
+			Players:     []int64{3, 2, 1, 4},
+			Submissions: []models.PlayerSubmission{
+				{PlayerID: 1, PassedTestCases: 30, TotalTestCases: 40, Time: start.Add(time.Minute)},
+				{PlayerID: 2, PassedTestCases: 15, TotalTestCases: 20, Time: start.Add(2 * time.Minute)},
+				{PlayerID: 3, PassedTestCases: 5, TotalTestCases: 40, Time: start},
+			},
+		}
+		assert.Equal(t, []int64{1, 2, 3, 4}, timeoutPlacements(session, nil, nil))
+
+		session.Submissions = nil
+		assert.Nil(t, timeoutPlacements(session, nil, nil))
+	})
+
+	t.Run("optimization duels rank accepted solutions by percentile", func(t *testing.T) {
+		start := time.Now()
+		fast, slow, lean := 92.5, 40.0, 99.0
+		session := &models.Session{
+			ScoringMode: models.ScoringOptimize,
+			OptimizeFor: models.OptimizeRuntime,
+			Players:     []int64{1, 2, 3},
+			Submissions: []models.PlayerSubmission{
+				{PlayerID: 1, Status: models.Accepted, RuntimePercentile: &slow, MemoryPercentile: &lean, Time: start},
+				{PlayerID: 2, Status: models.Accepted, RuntimePercentile: &fast, MemoryPercentile: &slow, Time: start.Add(time.Minute)},
+				{PlayerID: 3, Status: models.WrongAnswer, PassedTestCases: 9, TotalTestCases: 10, Time: start},
+			},
+		}
+		assert.Equal(t, []int64{2, 1, 3}, timeoutPlacements(session, nil, nil))
+
+		session.OptimizeFor = models.OptimizeMemory
+		assert.Equal(t, []int64{1, 2, 3}, timeoutPlacements(session, nil, nil))
+	})
+
+	t.Run("penalty sessions rank solvers by adjusted time", func(t *testing.T) {
+		start := time.Now()
+		session := &models.Session{
+			ScoringMode: models.ScoringPenalty,
+			Penalty:     5,
+			StartTime:   start,
+			Players:     []int64{1, 2, 3},
+			Submissions: []models.PlayerSubmission{
+				{PlayerID: 3, Status: models.WrongAnswer, PassedTestCases: 9, Time: start},
+				{PlayerID: 1, Status: models.WrongAnswer, Time: start},
+				{PlayerID: 1, Status: models.Accepted, Time: start.Add(time.Minute)},
+				{PlayerID: 2, Status: models.Accepted, Time: start.Add(4 * time.Minute)},
+			},
+		}
+		assert.Equal(t, []int64{2, 1, 3}, timeoutPlacements(session, nil, nil))
+	})
+
+	t.Run("relays rank by problems solved then test cases passed on the next one", func(t *testing.T) {
+		problems := []models.Problem{{ID: 11}, {ID: 12}, {ID: 13}}
+		session := standard([]int64{1, 2, 3}, []models.PlayerSubmission{
+			{PlayerID: 1, ProblemID: 11, PassedTestCases: 50, Status: models.Accepted},
+			{PlayerID: 1, ProblemID: 12, PassedTestCases: 5},
+			{PlayerID: 2, ProblemID: 11, PassedTestCases: 50, Status: models.Accepted},
+			{PlayerID: 2, ProblemID: 12, PassedTestCases: 20},
+			{PlayerID: 3, ProblemID: 11, PassedTestCases: 40},
+		})
+		session.Problems = problems
+		session.Progress = []models.RelayProgress{{PlayerID: 1, Solved: 1}, {PlayerID: 2, Solved: 1}, {PlayerID: 3, Solved: 0}}
+		assert.Equal(t, []int64{2, 1, 3}, timeoutPlacements(session, nil, nil))
+	})
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"errors"
+	"leetcodeduels/models"
+	"slices"
+)
+
+var (
+	ErrGhostNotFound    = errors.New("the match has no player with that ID")
+	ErrGhostUnsupported = errors.New("only standard matches that were played to the end can be raced")
+)
+
+// A race against the recorded submissions of one player of a stored match
+type GhostRace struct {
+	Problems []models.Problem
+	Details  models.MatchDetails
+	Link     models.GhostLink
+	Timeline []models.PlayerSubmission // The ghost's submissions in the order they were made
+}
+
+// Sets up a race on the same problems as a stored match, against one of its players. The race
+// is unrated and allows any language.
+func NewGhostRace(match *models.Session, ghostID int64) (*GhostRace, error) {
+	if !slices.Contains(match.Players, ghostID) {
+		return nil, ErrGhostNotFound
+	}
+	if match.ScoringMode != models.ScoringStandard || match.Status == models.MatchCanceled {
+		return nil, ErrGhostUnsupported
+	}
+
+	race := &GhostRace{
+		Problems: []models.Problem{match.Problem},
+		Details: models.MatchDetails{
+			Difficulties: []models.Difficulty{match.Problem.Difficulty},
+			ScoringMode:  models.ScoringStandard,
+		},
+	}
+	if len(match.Problems) > 0 {
+		race.Problems = match.Problems
+		race.Details.Relay = true
+	}
+	race.Timeline, race.Link.Finish = ghostTimeline(match.Submissions, ghostID, len(match.Problems))
+	race.Link.MatchID = match.ID
+	race.Link.PlayerID = ghostID
+	return race, nil
+}
+
+// The player's submissions in the order they were made, and the index of the one they finished
+// with: their first Accepted submission, or in a relay the one that solved its last problem.
+// The index is -1 if they never finished.
+func ghostTimeline(submissions []models.PlayerSubmission, playerID int64, relayProblems int) ([]models.PlayerSubmission, int) {
+	var timeline []models.PlayerSubmission
+	for _, sub := range submissions {
+		if sub.PlayerID == playerID {
+			timeline = append(timeline, sub)
+		}
+	}
+	slices.SortStableFunc(timeline, func(a, b models.PlayerSubmission) int {
+		return a.Time.Compare(b.Time)
+	})
+
+	solved := map[int]bool{}
+	for i, sub := range timeline {
+		if sub.Status != models.Accepted {
+			continue
+		}
+		solved[sub.ProblemID] = true
+		if len(solved) >= max(relayProblems, 1) {
+			return timeline, i
+		}
+	}
+	return timeline, -1
+}
+
+// Standings of a ghost race once it ends. The player wins if they finished before the ghost, the
+// ghost if it finished first or the player gave up, and otherwise it is a draw.
+func ghostRacePlacements(playerID, ghostID int64, finished, eliminated []int64, ghostFinished bool) []int64 {
+	switch {
+	case len(finished) > 0:
+		return []int64{playerID, ghostID}
+	case ghostFinished || len(eliminated) > 0:
+		return []int64{ghostID, playerID}
+	}
+	return nil
+}
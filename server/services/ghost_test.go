@@ -0,0 +1,52 @@
+package services
+
+import (
+	"leetcodeduels/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGhostTimeline(t *testing.T) {
+	start := time.Now()
+	sub := func(playerID int64, problemID, seconds int, status models.SubmissionStatus) models.PlayerSubmission {
+		return models.PlayerSubmission{PlayerID: playerID, ProblemID: problemID, Status: status, Time: start.Add(time.Duration(seconds) * time.Second)}
+	}
+
+	t.Run("the first accepted submission finishes", func(t *testing.T) {
+		subs := []models.PlayerSubmission{
+			sub(1, 7, 30, models.Accepted),
+			sub(2, 7, 5, models.Accepted),
+			sub(1, 7, 10, models.WrongAnswer),
+			sub(1, 7, 40, models.Accepted),
+		}
+		timeline, finish := ghostTimeline(subs, 1, 0)
+		assert.Equal(t, []models.PlayerSubmission{subs[2], subs[0], subs[3]}, timeline)
+		assert.Equal(t, 1, finish)
+	})
+
+	t.Run("a relay finishes once every problem is solved", func(t *testing.T) {
+		subs := []models.PlayerSubmission{
+			sub(1, 7, 10, models.Accepted),
+			sub(1, 7, 20, models.Accepted),
+			sub(1, 8, 30, models.Accepted),
+		}
+		_, finish := ghostTimeline(subs, 1, 2)
+		assert.Equal(t, 2, finish)
+	})
+
+	t.Run("a player who never finished", func(t *testing.T) {
+		subs := []models.PlayerSubmission{sub(1, 7, 10, models.WrongAnswer)}
+		timeline, finish := ghostTimeline(subs, 1, 0)
+		assert.Len(t, timeline, 1)
+		assert.Equal(t, -1, finish)
+	})
+}
+
+func TestGhostRacePlacements(t *testing.T) {
+	assert.Equal(t, []int64{1, 2}, ghostRacePlacements(1, 2, []int64{1}, nil, false))
+	assert.Equal(t, []int64{2, 1}, ghostRacePlacements(1, 2, nil, nil, true))
+	assert.Equal(t, []int64{2, 1}, ghostRacePlacements(1, 2, nil, []int64{1}, false))
+	assert.Nil(t, ghostRacePlacements(1, 2, nil, nil, false), "time ran out before either finished")
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"leetcodeduels/models"
+	"math"
+	"time"
+)
+
+// Glicko-2 as described in http://www.glicko.net/glicko/glicko2.pdf.
+// Each match is treated as its own rating period, so ratings move immediately.
+// Placement needs no special K here: new players' high deviation already moves them quickly.
+const (
+	glickoScale   = 173.7178 // Converts between the Glicko and Glicko-2 scales
+	glickoTau     = 0.5      // Constrains how fast volatility can change
+	glickoEpsilon = 0.000001 // Convergence tolerance for the volatility iteration
+)
+
+type glicko2Engine struct {
+	tau    float64
+	period time.Duration // Inactivity needed before deviation grows by one step
+}
+
+// A single result on the Glicko-2 scale.
+type glickoResult struct {
+	mu    float64
+	phi   float64
+	score float64
+}
+
+func (e glicko2Engine) rate(players []models.PlayerRating, order []int64, now time.Time) []models.RatingChange {
+	deviations := make(map[int64]float64, len(players))
+	for _, p := range players {
+		deviations[p.PlayerID] = inflateDeviation(p.Deviation, p.Volatility, p.LastRatedAt, e.period, now)
+	}
+
+	changes := make([]models.RatingChange, 0, len(players))
+	for _, p := range players {
+		results := make([]glickoResult, 0, len(players)-1)
+		for _, opp := range players {
+			if opp.PlayerID == p.PlayerID {
+				continue
+			}
+			results = append(results, glickoResult{
+				mu:    toGlickoMu(opp.Rating),
+				phi:   deviations[opp.PlayerID] / glickoScale,
+				score: pairScore(p.PlayerID, opp.PlayerID, order),
+			})
+		}
+
+		mu, phi, sigma := glicko2Update(toGlickoMu(p.Rating), deviations[p.PlayerID]/glickoScale,
+			p.Volatility, results, e.tau)
+
+		newRating := int(math.Round(mu*glickoScale + DefaultRating))
+		changes = append(changes, models.RatingChange{
+			PlayerID:   p.PlayerID,
+			OldRating:  p.Rating,
+			NewRating:  newRating,
+			Change:     newRating - p.Rating,
+			Deviation:  math.Min(phi*glickoScale, DefaultDeviation),
+			Volatility: sigma,
+		})
+	}
+	return changes
+}
+
+// Our ratings are centered on DefaultRating rather than Glicko's 1500.
+func toGlickoMu(rating int) float64 {
+	return float64(rating-DefaultRating) / glickoScale
+}
+
+// Grows a deviation by one step of volatility for each rating period of inactivity,
+// capped at the deviation of an unrated player.
+func inflateDeviation(deviation, volatility float64, lastRatedAt *time.Time, period time.Duration, now time.Time) float64 {
+	if lastRatedAt == nil || period <= 0 {
+		return deviation
+	}
+	periods := math.Floor(now.Sub(*lastRatedAt).Hours() / period.Hours())
+	if periods <= 0 {
+		return deviation
+	}
+	phi := deviation / glickoScale
+	inflated := math.Sqrt(phi*phi+periods*volatility*volatility) * glickoScale
+	return math.Min(inflated, DefaultDeviation)
+}
+
+// Runs steps 3-8 of the Glicko-2 algorithm for a player with the given results,
+// returning their new mu, phi and volatility.
+func glicko2Update(mu, phi, sigma float64, results []glickoResult, tau float64) (float64, float64, float64) {
+	if len(results) == 0 {
+		return mu, math.Sqrt(phi*phi + sigma*sigma), sigma
+	}
+
+	var vInv, improvement float64
+	for _, r := range results {
+		g := glickoG(r.phi)
+		e := 1 / (1 + math.Exp(-g*(mu-r.mu)))
+		vInv += g * g * e * (1 - e)
+		improvement += g * (r.score - e)
+	}
+	v := 1 / vInv
+	delta := v * improvement
+
+	newSigma := glickoVolatility(phi, sigma, v, delta, tau)
+	phiStar := math.Sqrt(phi*phi + newSigma*newSigma)
+	newPhi := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	newMu := mu + newPhi*newPhi*improvement
+	return newMu, newPhi, newSigma
+}
+
+func glickoG(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+// Solves for the new volatility using the Illinois algorithm (step 5).
+func glickoVolatility(phi, sigma, v, delta, tau float64) float64 {
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-phi*phi-v-ex)/(2*d*d) - (x-a)/(tau*tau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		B = a - k*tau
+	}
+
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > glickoEpsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+	return math.Exp(A / 2)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"leetcodeduels/models"
+	"slices"
 	"strconv"
 	"time"
 
@@ -22,6 +23,7 @@ const (
 	inviteKeyPrefix  = "invite:"
 	inviterSetPrefix = "invites:sent:"
 	inviteeSetPrefix = "invites:received:"
+	acceptedSuffix   = ":accepted" // Set of invitees who accepted a free-for-all invite
 )
 
 func InitInviteManager(redisURL string) error {
@@ -45,9 +47,39 @@ func generateInviteKey(inviterID, inviteeID int64) string {
 	return fmt.Sprintf("%s%d:%d", inviteKeyPrefix, inviterID, inviteeID)
 }
 
-// Stores a new invite with a 3-minute TTL, fails if one already exists
-func (im *inviteManager) CreateInvite(inviterID, inviteeID int64, matchDetails models.MatchDetails) (bool, error) {
-	inviterKey := inviterSetPrefix + strconv.FormatInt(inviterID, 10)
+// Stores a new invite with a 3-minute TTL, fails if one already exists.
+func (im *inviteManager) CreateInvite(inviterID int64, inviteeID int64, matchDetails models.MatchDetails) (bool, error) {
+	return im.CreateGroupInvite(inviterID, []int64{inviteeID}, matchDetails)
+}
+
+// Stores an invite to one or more players with a 3-minute TTL, fails if one already exists.
+// Inviting several players creates a free-for-all that starts once all of them accept.
+func (im *inviteManager) CreateGroupInvite(inviterID int64, inviteeIDs []int64, matchDetails models.MatchDetails) (bool, error) {
+	payload := models.Invite{
+		InviterID:    inviterID,
+		InviteeID:    inviteeIDs[0],
+		MatchDetails: matchDetails,
+		CreatedAt:    time.Now(),
+	}
+	if len(inviteeIDs) > 1 {
+		payload.InviteeIDs = inviteeIDs
+	}
+	return im.storeInvite(payload)
+}
+
+// Stores an invite to play a league fixture with a 3-minute TTL, fails if one already exists.
+func (im *inviteManager) CreateFixtureInvite(inviterID int64, inviteeID int64, matchDetails models.MatchDetails, link models.LeagueLink) (bool, error) {
+	return im.storeInvite(models.Invite{
+		InviterID:    inviterID,
+		InviteeID:    inviteeID,
+		MatchDetails: matchDetails,
+		League:       &link,
+		CreatedAt:    time.Now(),
+	})
+}
+
+func (im *inviteManager) storeInvite(payload models.Invite) (bool, error) {
+	inviterKey := inviterSetPrefix + strconv.FormatInt(payload.InviterID, 10)
 
 	inviterCount, err := im.client.SCard(im.ctx, inviterKey).Result()
 	if err != nil && err != redis.Nil {
@@ -58,13 +90,7 @@ func (im *inviteManager) CreateInvite(inviterID, inviteeID int64, matchDetails m
 		return false, nil // Inviter already has an outgoing invite
 	}
 
-	inviteKey := generateInviteKey(inviterID, inviteeID)
-	payload := models.Invite{
-		InviterID:    inviterID,
-		InviteeID:    inviteeID,
-		MatchDetails: matchDetails,
-		CreatedAt:    time.Now(),
-	}
+	inviteKey := generateInviteKey(payload.InviterID, payload.InviteeID)
 	data, err := json.Marshal(payload)
 	if err != nil {
 		return false, err
@@ -77,9 +103,11 @@ func (im *inviteManager) CreateInvite(inviterID, inviteeID int64, matchDetails m
 	pipe.SAdd(im.ctx, inviterKey, inviteKey)
 	pipe.Expire(im.ctx, inviterKey, 3*time.Minute)
 
-	inviteeKey := inviteeSetPrefix + strconv.FormatInt(inviteeID, 10)
-	pipe.SAdd(im.ctx, inviteeKey, inviteKey)
-	pipe.Expire(im.ctx, inviteeKey, 3*time.Minute)
+	for _, inviteeID := range payload.Invitees() {
+		inviteeKey := inviteeSetPrefix + strconv.FormatInt(inviteeID, 10)
+		pipe.SAdd(im.ctx, inviteeKey, inviteKey)
+		pipe.Expire(im.ctx, inviteeKey, 3*time.Minute)
+	}
 
 	_, err = pipe.Exec(im.ctx)
 	if err != nil {
@@ -89,6 +117,28 @@ func (im *inviteManager) CreateInvite(inviterID, inviteeID int64, matchDetails m
 	return true, nil
 }
 
+// Records that an invitee accepted the inviter's invite. Returns true once every invitee has accepted.
+func (im *inviteManager) AcceptInvite(inviterID int64, inviteeID int64) (bool, error) {
+	invite, err := im.InviteDetails(inviterID)
+	if err != nil {
+		return false, err
+	}
+	if invite == nil || !slices.Contains(invite.Invitees(), inviteeID) {
+		return false, nil
+	}
+
+	acceptedKey := generateInviteKey(inviterID, invite.InviteeID) + acceptedSuffix
+	pipe := im.client.TxPipeline()
+	pipe.SAdd(im.ctx, acceptedKey, inviteeID)
+	count := pipe.SCard(im.ctx, acceptedKey)
+	pipe.Expire(im.ctx, acceptedKey, 3*time.Minute)
+	if _, err := pipe.Exec(im.ctx); err != nil {
+		return false, fmt.Errorf("failed to record acceptance: %w", err)
+	}
+
+	return count.Val() >= int64(len(invite.Invitees())), nil
+}
+
 func (im *inviteManager) GetPendingInvites(inviteeID int64) ([]models.Invite, error) {
 	inviteeKey := inviteeSetPrefix + strconv.FormatInt(inviteeID, 10)
 
@@ -189,19 +239,21 @@ func (im *inviteManager) RemoveInvite(inviterID int64) (bool, error) {
 		return false, fmt.Errorf("failed to unmarshal invite: %w", err)
 	}
 
-	inviteeKey := inviteeSetPrefix + strconv.FormatInt(invite.InviteeID, 10)
-
-	pipe := im.client.Pipeline()
-	pipe.Del(im.ctx, inviteKey)
+	pipe := im.client.TxPipeline()
+	removed := pipe.Del(im.ctx, inviteKey)
+	pipe.Del(im.ctx, inviteKey+acceptedSuffix)
 	pipe.SRem(im.ctx, inviterKey, inviteKey)
-	pipe.SRem(im.ctx, inviteeKey, inviteKey)
+	for _, inviteeID := range invite.Invitees() {
+		pipe.SRem(im.ctx, inviteeSetPrefix+strconv.FormatInt(inviteeID, 10), inviteKey)
+	}
 
 	_, err = pipe.Exec(im.ctx)
 	if err != nil {
 		return false, fmt.Errorf("failed to remove invite: %w", err)
 	}
 
-	return true, nil
+	// Only one caller can delete the key, so concurrent accepts cannot both start a game
+	return removed.Val() > 0, nil
 }
 
 // Checks if an invite by this inviter still exists (i.e., awaiting response)
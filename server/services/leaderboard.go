@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"leetcodeduels/config"
+	"leetcodeduels/models"
+	"leetcodeduels/store"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+var Leaderboard *leaderboard
+
+type leaderboard struct {
+	client *redis.Client
+	ctx    context.Context
+}
+
+const leaderboardKey = "leaderboard:global" // Sorted set of userIDs scored by rating
+
+func InitLeaderboard(redisURL string) error {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return fmt.Errorf("invalid redis URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return fmt.Errorf("redis ping failed: %w", err)
+	}
+	Leaderboard = &leaderboard{
+		client: client,
+		ctx:    context.Background(),
+	}
+	return Leaderboard.Rebuild()
+}
+
+// Replaces the sorted set with the ratings currently stored in Postgres. Provisional players
+// are left out. The new set is built under a temporary key and renamed so readers never see it half built.
+func (lb *leaderboard) Rebuild() error {
+	ratings, err := store.DataStore.GetAllUserRatings(config.GetConfig().PLACEMENT_GAMES)
+	if err != nil {
+		return err
+	}
+	if len(ratings) == 0 {
+		return lb.client.Del(lb.ctx, leaderboardKey).Err()
+	}
+
+	tmpKey := leaderboardKey + ":rebuild:" + uuid.NewString()
+	members := make([]*redis.Z, 0, len(ratings))
+	for id, rating := range ratings {
+		members = append(members, &redis.Z{Score: float64(rating), Member: id})
+	}
+
+	pipe := lb.client.TxPipeline()
+	pipe.ZAdd(lb.ctx, tmpKey, members...)
+	pipe.Rename(lb.ctx, tmpKey, leaderboardKey)
+	if _, err := pipe.Exec(lb.ctx); err != nil {
+		return fmt.Errorf("failed to rebuild leaderboard: %w", err)
+	}
+	return nil
+}
+
+// Copies the users' ratings as stored in Postgres onto the leaderboard, removing anyone who is
+// provisional or no longer exists. Every write to a few users' ratings is followed by a call to
+// this: new accounts, stored matches, match reverts and UpdateUserRating. Writes that touch every user, such
+// as season resets, call Rebuild instead.
+func (lb *leaderboard) Sync(userIDs ...int64) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	users, err := store.DataStore.GetUsersByIDs(userIDs)
+	if err != nil {
+		return err
+	}
+
+	ranked := make(map[int64]bool, len(users))
+	var members []*redis.Z
+	for _, u := range users {
+		if !IsProvisional(u.GamesPlayed) {
+			ranked[u.ID] = true
+			members = append(members, &redis.Z{Score: float64(u.Rating), Member: u.ID})
+		}
+	}
+	var unranked []interface{}
+	for _, id := range userIDs {
+		if !ranked[id] {
+			unranked = append(unranked, id)
+		}
+	}
+
+	pipe := lb.client.TxPipeline()
+	if len(members) > 0 {
+		pipe.ZAdd(lb.ctx, leaderboardKey, members...)
+	}
+	if len(unranked) > 0 {
+		pipe.ZRem(lb.ctx, leaderboardKey, unranked...)
+	}
+	if _, err := pipe.Exec(lb.ctx); err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to sync leaderboard: %w", err)
+	}
+	return nil
+}
+
+func (lb *leaderboard) Remove(userID int64) error {
+	if err := lb.client.ZRem(lb.ctx, leaderboardKey, userID).Err(); err != nil {
+		return fmt.Errorf("redis zrem failed: %w", err)
+	}
+	return nil
+}
+
+// Returns one page of the leaderboard and the number of ranked users.
+// Unfiltered pages are served from Redis; filtered ones are ranked by Postgres.
+func (lb *leaderboard) Page(filter models.LeaderboardFilter, offset, limit int) ([]models.RankedUser, int, error) {
+	if filter.IsSet() {
+		filter.MinGames = max(filter.MinGames, config.GetConfig().PLACEMENT_GAMES)
+		return store.DataStore.GetLeaderboardPage(filter, offset, limit)
+	}
+
+	total, err := lb.client.ZCard(lb.ctx, leaderboardKey).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("redis zcard failed: %w", err)
+	}
+	members, err := lb.client.ZRevRangeWithScores(lb.ctx, leaderboardKey, int64(offset), int64(offset+limit-1)).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("redis zrevrange failed: %w", err)
+	}
+
+	ranked := make([]models.RankedUser, 0, len(members))
+	for i, m := range members {
+		id, err := strconv.ParseInt(m.Member.(string), 10, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid leaderboard member %v: %w", m.Member, err)
+		}
+
+		// Tied players share the rank of the first of them
+		var rank int
+		if i > 0 && m.Score == members[i-1].Score {
+			rank = ranked[i-1].Rank
+		} else if i > 0 {
+			rank = offset + i + 1
+		} else {
+			rank, err = lb.rankForScore(m.Score)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		ranked = append(ranked, models.RankedUser{UserID: id, Rating: int(m.Score), Rank: rank})
+	}
+	return ranked, int(total), nil
+}
+
+// Returns a user's rank, or false if they are not on the (filtered) leaderboard.
+func (lb *leaderboard) Rank(filter models.LeaderboardFilter, userID int64) (int, bool, error) {
+	if filter.IsSet() {
+		filter.MinGames = max(filter.MinGames, config.GetConfig().PLACEMENT_GAMES)
+		return store.DataStore.GetLeaderboardRank(filter, userID)
+	}
+
+	score, err := lb.client.ZScore(lb.ctx, leaderboardKey, strconv.FormatInt(userID, 10)).Result()
+	if err == redis.Nil {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("redis zscore failed: %w", err)
+	}
+	rank, err := lb.rankForScore(score)
+	if err != nil {
+		return 0, false, err
+	}
+	return rank, true, nil
+}
+
+// One more than the number of users rated strictly higher.
+func (lb *leaderboard) rankForScore(score float64) (int, error) {
+	higher, err := lb.client.ZCount(lb.ctx, leaderboardKey, "("+strconv.FormatFloat(score, 'f', -1, 64), "+inf").Result()
+	if err != nil {
+		return 0, fmt.Errorf("redis zcount failed: %w", err)
+	}
+	return int(higher) + 1, nil
+}
+
+func (lb *leaderboard) Close() error {
+	return lb.client.Close()
+}
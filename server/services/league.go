@@ -0,0 +1,258 @@
+package services
+
+import (
+	"cmp"
+	"leetcodeduels/models"
+	"math/bits"
+	"slices"
+	"time"
+)
+
+const (
+	leagueWinPoints  = 3 // Byes and forfeits count as wins
+	leagueDrawPoints = 1
+
+	swissSearchLimit = 100000 // Pairing attempts before a Swiss round allows rematches
+)
+
+// Rounds for every player to meet every other once. With an odd number of players each round
+// has a bye, so one more round is needed.
+func roundRobinRounds(players int) int {
+	if players%2 == 1 {
+		return players
+	}
+	return players - 1
+}
+
+// Enough Swiss rounds for one player to finish ahead of everyone else, but never more rounds
+// than there are opponents to meet.
+func swissRounds(players int) int {
+	return min(bits.Len(uint(players-1)), players-1)
+}
+
+// Pairs the players for a round of a round robin using the circle method: the first player
+// stays put while the rest rotate one place each round. The bye, when there is one, is the
+// second player of a pair.
+func roundRobinPairings(players []int64, round int) [][2]int64 {
+	ids := slices.Clone(players)
+	if len(ids)%2 == 1 {
+		ids = append(ids, 0)
+	}
+	n := len(ids)
+	rest := ids[1:]
+	shift := (round - 1) % (n - 1)
+	circle := append([]int64{ids[0]}, rest[len(rest)-shift:]...)
+	circle = append(circle, rest[:len(rest)-shift]...)
+
+	pairs := make([][2]int64, 0, n/2)
+	for i := range n / 2 {
+		a, b := circle[i], circle[n-1-i]
+		if a == 0 {
+			a, b = b, a
+		}
+		pairs = append(pairs, [2]int64{a, b})
+	}
+	return pairs
+}
+
+func pairKey(a, b int64) [2]int64 {
+	return [2]int64{min(a, b), max(a, b)}
+}
+
+// Pairs players given in standings order, each with the highest placed player they haven't met
+// yet. With an odd number of players, the lowest placed player who hasn't had a bye sits out.
+// Rematches are only allowed when no pairing avoids them.
+func swissPairings(order []int64, fixtures []models.LeagueFixture) [][2]int64 {
+	met := map[[2]int64]bool{}
+	hadBye := map[int64]bool{}
+	for _, f := range fixtures {
+		if f.Players[1] == 0 {
+			hadBye[f.Players[0]] = true
+		} else {
+			met[pairKey(f.Players[0], f.Players[1])] = true
+		}
+	}
+
+	// Bye candidates from the bottom of the standings up, preferring players without one
+	byes := []int64{0}
+	if len(order)%2 == 1 {
+		byes = nil
+		for i := len(order) - 1; i >= 0; i-- {
+			if !hadBye[order[i]] {
+				byes = append(byes, order[i])
+			}
+		}
+		if len(byes) == 0 {
+			byes = []int64{order[len(order)-1]}
+		}
+	}
+
+	for _, allowRematches := range []bool{false, true} {
+		steps := 0
+		for _, bye := range byes {
+			players := slices.DeleteFunc(slices.Clone(order), func(id int64) bool { return id == bye })
+			if pairs, ok := pairSwiss(players, met, allowRematches, &steps); ok {
+				if bye != 0 {
+					pairs = append(pairs, [2]int64{bye, 0})
+				}
+				return pairs
+			}
+		}
+	}
+	return nil // Unreachable: with rematches allowed any even group can be paired
+}
+
+// Pairs the first player with the highest placed opponent that still lets everyone below be paired.
+func pairSwiss(players []int64, met map[[2]int64]bool, allowRematches bool, steps *int) ([][2]int64, bool) {
+	if len(players) == 0 {
+		return nil, true
+	}
+	first := players[0]
+	for i := 1; i < len(players); i++ {
+		*steps++
+		if *steps > swissSearchLimit && !allowRematches {
+			return nil, false
+		}
+		if !allowRematches && met[pairKey(first, players[i])] {
+			continue
+		}
+		rest := append(slices.Clone(players[1:i]), players[i+1:]...)
+		if pairs, ok := pairSwiss(rest, met, allowRematches, steps); ok {
+			return append([][2]int64{{first, players[i]}}, pairs...), true
+		}
+	}
+	return nil, false
+}
+
+// Pairs the league's next round, giving its fixtures a deadline one round length from now, and
+// returns the new fixtures.
+func pairRound(l *models.League, now time.Time) []models.LeagueFixture {
+	l.CurrentRound++
+
+	var pairs [][2]int64
+	if l.Format == models.Swiss {
+		standings := LeagueStandings(l)
+		order := make([]int64, len(standings))
+		for i, s := range standings {
+			order[i] = s.UserID
+		}
+		pairs = swissPairings(order, l.Fixtures)
+	} else {
+		order := make([]int64, len(l.Players))
+		for i, p := range l.Players {
+			order[i] = p.UserID
+		}
+		pairs = roundRobinPairings(order, l.CurrentRound)
+	}
+
+	deadline := now.Add(time.Duration(l.RoundHours) * time.Hour)
+	l.NextRoundAt = &deadline
+	added := make([]models.LeagueFixture, 0, len(pairs))
+	for _, players := range pairs {
+		f := models.LeagueFixture{
+			Number:   len(l.Fixtures) + 1,
+			Round:    l.CurrentRound,
+			Players:  players,
+			Status:   models.FixtureScheduled,
+			Deadline: deadline,
+		}
+		if players[1] == 0 {
+			f.Status = models.FixtureBye
+			f.Winner = players[0]
+		}
+		l.Fixtures = append(l.Fixtures, f)
+		added = append(added, f)
+	}
+	return added
+}
+
+// Settles a fixture nobody played by its deadline. It goes to the only player who invited their
+// opponent to play it, and otherwise counts as a loss for both.
+func forfeitFixture(f *models.LeagueFixture) {
+	f.Status = models.FixtureForfeited
+	f.Winner = 0
+	if f.Requested[0] != f.Requested[1] {
+		f.Winner = f.Players[0]
+		if f.Requested[1] {
+			f.Winner = f.Players[1]
+		}
+	}
+}
+
+// The league's table from every decided fixture. Players are ranked by points, then Buchholz,
+// then wins, and otherwise keep the order of the league's players.
+func LeagueStandings(l *models.League) []models.LeagueStanding {
+	standings := make([]models.LeagueStanding, len(l.Players))
+	index := make(map[int64]int, len(l.Players))
+	for i, p := range l.Players {
+		standings[i] = models.LeagueStanding{UserID: p.UserID, Username: p.Username, Discriminator: p.Discriminator}
+		index[p.UserID] = i
+	}
+	record := func(playerID int64, points int, won, drew bool) {
+		i, ok := index[playerID]
+		if !ok {
+			return
+		}
+		s := &standings[i]
+		s.Played++
+		s.Points += points
+		switch {
+		case won:
+			s.Wins++
+		case drew:
+			s.Draws++
+		default:
+			s.Losses++
+		}
+	}
+
+	opponents := map[int64][]int64{}
+	for _, f := range l.Fixtures {
+		switch {
+		case f.Status == models.FixtureScheduled:
+			continue
+		case f.Status == models.FixtureBye:
+			record(f.Players[0], leagueWinPoints, true, false)
+			continue
+		case f.Winner > 0:
+			for _, p := range f.Players {
+				if p == f.Winner {
+					record(p, leagueWinPoints, true, false)
+				} else {
+					record(p, 0, false, false)
+				}
+			}
+		case f.Status == models.FixturePlayed:
+			for _, p := range f.Players {
+				record(p, leagueDrawPoints, false, true)
+			}
+		default:
+			// A double forfeit
+			for _, p := range f.Players {
+				record(p, 0, false, false)
+			}
+		}
+		opponents[f.Players[0]] = append(opponents[f.Players[0]], f.Players[1])
+		opponents[f.Players[1]] = append(opponents[f.Players[1]], f.Players[0])
+	}
+
+	for i := range standings {
+		for _, opp := range opponents[standings[i].UserID] {
+			if j, ok := index[opp]; ok {
+				standings[i].Buchholz += standings[j].Points
+			}
+		}
+	}
+
+	slices.SortStableFunc(standings, func(a, b models.LeagueStanding) int {
+		return cmp.Or(
+			cmp.Compare(b.Points, a.Points),
+			cmp.Compare(b.Buchholz, a.Buchholz),
+			cmp.Compare(b.Wins, a.Wins),
+		)
+	})
+	for i := range standings {
+		standings[i].Rank = i + 1
+	}
+	return standings
+}
@@ -0,0 +1,329 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"leetcodeduels/models"
+	"leetcodeduels/store"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+var LeagueManager *leagueManager
+
+// Tells both players of a fixture that it has been paired and who they play.
+type LeagueFixtureNotifier func(l *models.League, fixture models.LeagueFixture)
+
+type leagueManager struct {
+	client *redis.Client
+	ctx    context.Context
+	cancel context.CancelFunc
+	notify LeagueFixtureNotifier
+}
+
+const (
+	leagueLockPrefix = "league:lock:" // Held while a node updates a league's fixtures
+	leagueLockTTL    = 30 * time.Second
+	leagueLockWait   = 10 * time.Second // How long to wait for another node to finish updating
+
+	leagueCheckInterval = time.Minute
+
+	MinLeaguePlayers        = 2
+	MaxLeaguePlayers        = 32
+	MaxLeagueRounds         = 20
+	DefaultLeagueRoundHours = 7 * 24 // Hours players have to play a round's fixtures
+	MaxLeagueRoundHours     = 30 * 24
+)
+
+var (
+	ErrLeagueStarted       = errors.New("league has already started")
+	ErrTooFewLeaguePlayers = fmt.Errorf("a league needs at least %d players", MinLeaguePlayers)
+	ErrFixtureNotFound     = errors.New("fixture not found")
+	ErrNotFixturePlayer    = errors.New("fixture is between other players")
+	ErrFixtureClosed       = errors.New("fixture can no longer be played")
+	ErrFixtureInProgress   = errors.New("fixture is already being played")
+)
+
+func leagueLockKey(leagueID int) string {
+	return leagueLockPrefix + strconv.Itoa(leagueID)
+}
+
+// Connects to Redis and starts closing league rounds as their deadlines pass in the background.
+func InitLeagueManager(redisURL string) error {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return fmt.Errorf("invalid redis URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return fmt.Errorf("redis ping failed: %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	LeagueManager = &leagueManager{
+		client: client,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	go LeagueManager.run()
+	return nil
+}
+
+// Sets how players are told about their fixtures as each round is paired.
+func (lm *leagueManager) SetFixtureNotifier(notify LeagueFixtureNotifier) {
+	lm.notify = notify
+}
+
+// Closes registration and pairs the first round.
+func (lm *leagueManager) StartLeague(leagueID int) (*models.League, error) {
+	release, err := lm.lock(leagueID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	l, err := store.DataStore.GetLeague(leagueID)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil {
+		return nil, store.ErrLeagueNotFound
+	}
+	if l.Status != models.LeagueRegistration {
+		return nil, ErrLeagueStarted
+	}
+	if len(l.Players) < MinLeaguePlayers {
+		return nil, ErrTooFewLeaguePlayers
+	}
+
+	closed, err := store.DataStore.CloseLeagueRegistration(leagueID)
+	if err != nil {
+		return nil, err
+	}
+	if !closed {
+		return nil, ErrLeagueStarted
+	}
+	// Players can register right up until registration closes, and are now in rating order
+	if l, err = store.DataStore.GetLeague(leagueID); err != nil {
+		return nil, err
+	}
+
+	if l.Format == models.RoundRobin {
+		l.Rounds = roundRobinRounds(len(l.Players))
+	} else if l.Rounds == 0 {
+		l.Rounds = swissRounds(len(l.Players))
+	} else {
+		l.Rounds = min(l.Rounds, len(l.Players)-1)
+	}
+	added := pairRound(l, time.Now())
+
+	if err := store.DataStore.SaveLeague(l); err != nil {
+		return nil, err
+	}
+	lm.notifyFixtures(l, added)
+	log.Info().Int("league_id", l.ID).Int("players", len(l.Players)).Int("rounds", l.Rounds).Msg("League started")
+	return l, nil
+}
+
+// Records that a player has invited their opponent to play a fixture, and returns the details
+// every fixture of the league is played with.
+func (lm *leagueManager) RequestFixture(link models.LeagueLink, inviterID, inviteeID int64) (models.MatchDetails, error) {
+	release, err := lm.lock(link.LeagueID)
+	if err != nil {
+		return models.MatchDetails{}, err
+	}
+	defer release()
+
+	l, fixture, err := lm.playableFixture(link)
+	if err != nil {
+		return models.MatchDetails{}, err
+	}
+	if fixture.Players != [2]int64{inviterID, inviteeID} && fixture.Players != [2]int64{inviteeID, inviterID} {
+		return models.MatchDetails{}, ErrNotFixturePlayer
+	}
+
+	if slot := fixtureSlot(fixture, inviterID); !fixture.Requested[slot] {
+		fixture.Requested[slot] = true
+		if err := store.DataStore.SaveLeague(l); err != nil {
+			return models.MatchDetails{}, err
+		}
+	}
+	return l.MatchDetails, nil
+}
+
+// Starts the session deciding a fixture once its invite is accepted, unless the fixture can no
+// longer be played.
+func (lm *leagueManager) PlayFixture(link models.LeagueLink, start func() (string, error)) (string, error) {
+	release, err := lm.lock(link.LeagueID)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	l, fixture, err := lm.playableFixture(link)
+	if err != nil {
+		return "", err
+	}
+	sessionID, err := start()
+	if err != nil {
+		return "", err
+	}
+	fixture.SessionID = sessionID
+	if err := store.DataStore.SaveLeague(l); err != nil {
+		return "", err
+	}
+	return sessionID, nil
+}
+
+// Records the result of a finished fixture session. A canceled session leaves the fixture to be
+// played again before its deadline, or forfeits it if the deadline has passed. Returns nil if the
+// session no longer decides its fixture.
+func (lm *leagueManager) RecordResult(session *models.Session) (*models.League, error) {
+	link := session.League
+	release, err := lm.lock(link.LeagueID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	l, err := store.DataStore.GetLeague(link.LeagueID)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil || link.Fixture < 1 || link.Fixture > len(l.Fixtures) {
+		return nil, nil
+	}
+	fixture := &l.Fixtures[link.Fixture-1]
+	if fixture.Status != models.FixtureScheduled || fixture.SessionID != session.ID {
+		return nil, nil
+	}
+
+	fixture.SessionID = ""
+	if session.Status != models.MatchCanceled {
+		fixture.Status = models.FixturePlayed
+		fixture.Winner = max(session.Winner, 0)
+	} else if fixture.Round < l.CurrentRound || l.Status == models.LeagueFinished {
+		forfeitFixture(fixture) // Its round has already closed
+	}
+	if err := store.DataStore.SaveLeague(l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Loads a league and one of its fixtures, checking the fixture can be played right now.
+func (lm *leagueManager) playableFixture(link models.LeagueLink) (*models.League, *models.LeagueFixture, error) {
+	l, err := store.DataStore.GetLeague(link.LeagueID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if l == nil || link.Fixture < 1 || link.Fixture > len(l.Fixtures) {
+		return nil, nil, ErrFixtureNotFound
+	}
+	fixture := &l.Fixtures[link.Fixture-1]
+	if l.Status != models.LeagueInProgress || fixture.Status != models.FixtureScheduled || time.Now().After(fixture.Deadline) {
+		return nil, nil, ErrFixtureClosed
+	}
+	if fixture.SessionID != "" {
+		return nil, nil, ErrFixtureInProgress
+	}
+	return l, fixture, nil
+}
+
+func fixtureSlot(fixture *models.LeagueFixture, playerID int64) int {
+	if fixture.Players[1] == playerID {
+		return 1
+	}
+	return 0
+}
+
+func (lm *leagueManager) run() {
+	ticker := time.NewTicker(leagueCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		ids, err := store.DataStore.GetLeaguesDue(time.Now())
+		if err != nil {
+			log.Error().Err(err).Msg("League check failed")
+		}
+		for _, id := range ids {
+			if err := lm.closeRound(id, time.Now()); err != nil {
+				log.Error().Err(err).Int("league_id", id).Msg("Failed to close league round")
+			}
+		}
+		select {
+		case <-lm.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Forfeits the current round's unplayed fixtures, then pairs the next round or finishes the
+// league after its last. Fixtures still being played are decided by their session.
+func (lm *leagueManager) closeRound(leagueID int, now time.Time) error {
+	release, err := lm.lock(leagueID)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Another node may have closed the round while this one waited for the lock
+	l, err := store.DataStore.GetLeague(leagueID)
+	if err != nil {
+		return err
+	}
+	if l == nil || l.Status != models.LeagueInProgress || l.NextRoundAt == nil || l.NextRoundAt.After(now) {
+		return nil
+	}
+
+	for i := range l.Fixtures {
+		f := &l.Fixtures[i]
+		if f.Round == l.CurrentRound && f.Status == models.FixtureScheduled && f.SessionID == "" {
+			forfeitFixture(f)
+		}
+	}
+
+	var added []models.LeagueFixture
+	if l.CurrentRound < l.Rounds {
+		added = pairRound(l, now)
+	} else {
+		l.Status = models.LeagueFinished
+		l.NextRoundAt = nil
+		l.EndTime = &now
+	}
+	if err := store.DataStore.SaveLeague(l); err != nil {
+		return err
+	}
+
+	if l.Status == models.LeagueFinished {
+		log.Info().Int("league_id", l.ID).Msg("League finished")
+	} else {
+		log.Info().Int("league_id", l.ID).Int("round", l.CurrentRound).Msg("League round paired")
+	}
+	lm.notifyFixtures(l, added)
+	return nil
+}
+
+func (lm *leagueManager) notifyFixtures(l *models.League, fixtures []models.LeagueFixture) {
+	if lm.notify == nil {
+		return
+	}
+	for _, f := range fixtures {
+		if f.Status == models.FixtureScheduled {
+			lm.notify(l, f)
+		}
+	}
+}
+
+func (lm *leagueManager) lock(leagueID int) (func(), error) {
+	return waitForLock(lm.ctx, lm.client, leagueLockKey(leagueID), leagueLockTTL, leagueLockWait)
+}
+
+func (lm *leagueManager) Close() error {
+	lm.cancel()
+	return lm.client.Close()
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"leetcodeduels/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundRobinPairings(t *testing.T) {
+	for _, count := range []int{2, 5, 6} {
+		players := make([]int64, count)
+		for i := range players {
+			players[i] = int64(i + 1)
+		}
+
+		met := map[[2]int64]int{}
+		byes := map[int64]int{}
+		for round := 1; round <= roundRobinRounds(count); round++ {
+			seen := map[int64]bool{}
+			for _, pair := range roundRobinPairings(players, round) {
+				require.False(t, seen[pair[0]] || seen[pair[1]], "a player is paired twice in round %d", round)
+				seen[pair[0]], seen[pair[1]] = true, true
+				if pair[1] == 0 {
+					byes[pair[0]]++
+				} else {
+					met[pairKey(pair[0], pair[1])]++
+				}
+			}
+		}
+
+		assert.Len(t, met, count*(count-1)/2, "%d players meet every opponent", count)
+		for pair, times := range met {
+			assert.Equal(t, 1, times, "%v meet once", pair)
+		}
+		if count%2 == 1 {
+			assert.Len(t, byes, count, "every player sits out once")
+		} else {
+			assert.Empty(t, byes)
+		}
+	}
+}
+
+func TestSwissPairings(t *testing.T) {
+	t.Run("leaders meet and rematches are avoided", func(t *testing.T) {
+		fixtures := []models.LeagueFixture{
+			{Players: [2]int64{1, 2}},
+			{Players: [2]int64{3, 4}},
+		}
+		assert.Equal(t, [][2]int64{{1, 3}, {2, 4}}, swissPairings([]int64{1, 3, 2, 4}, fixtures))
+	})
+
+	t.Run("the lowest player without a bye sits out", func(t *testing.T) {
+		fixtures := []models.LeagueFixture{
+			{Players: [2]int64{1, 2}},
+			{Players: [2]int64{3, 0}},
+		}
+		pairs := swissPairings([]int64{1, 3, 2}, fixtures)
+		assert.Equal(t, [][2]int64{{1, 3}, {2, 0}}, pairs)
+	})
+
+	t.Run("backtracks instead of leaving a rematch at the bottom", func(t *testing.T) {
+		fixtures := []models.LeagueFixture{{Players: [2]int64{3, 4}}}
+		// Pairing 1 with 2 would leave 3 and 4 to meet again
+		assert.Equal(t, [][2]int64{{1, 3}, {2, 4}}, swissPairings([]int64{1, 2, 3, 4}, fixtures))
+	})
+
+	t.Run("rematches once everyone has met", func(t *testing.T) {
+		fixtures := []models.LeagueFixture{{Players: [2]int64{1, 2}}}
+		assert.Equal(t, [][2]int64{{1, 2}}, swissPairings([]int64{1, 2}, fixtures))
+	})
+}
+
+func TestLeagueStandings(t *testing.T) {
+	l := &models.League{
+		Players: []models.LeaguePlayer{{UserID: 6}, {UserID: 1}, {UserID: 2}, {UserID: 3}, {UserID: 4}, {UserID: 5}},
+		Fixtures: []models.LeagueFixture{
+			{Players: [2]int64{1, 2}, Status: models.FixturePlayed, Winner: 2},
+			{Players: [2]int64{3, 4}, Status: models.FixturePlayed},
+			{Players: [2]int64{5, 0}, Status: models.FixtureBye, Winner: 5},
+			{Players: [2]int64{2, 5}, Status: models.FixtureForfeited, Requested: [2]bool{false, true}},
+			{Players: [2]int64{1, 3}, Status: models.FixtureForfeited},
+			{Players: [2]int64{4, 0}, Status: models.FixtureBye, Winner: 4},
+			{Players: [2]int64{6, 0}, Status: models.FixtureBye, Winner: 6},
+			{Players: [2]int64{2, 3}, Status: models.FixtureScheduled},
+		},
+	}
+	forfeitFixture(&l.Fixtures[3])
+	forfeitFixture(&l.Fixtures[4])
+	require.Equal(t, int64(5), l.Fixtures[3].Winner, "the fixture goes to the only player who asked to play")
+	require.Zero(t, l.Fixtures[4].Winner)
+
+	standings := LeagueStandings(l)
+	var order []int64
+	for i, s := range standings {
+		assert.Equal(t, i+1, s.Rank)
+		order = append(order, s.UserID)
+	}
+	// 2 and 6 are level on points, but only 2 has faced opponents who scored any
+	assert.Equal(t, []int64{5, 4, 2, 6, 3, 1}, order)
+
+	byID := map[int64]models.LeagueStanding{}
+	for _, s := range standings {
+		byID[s.UserID] = s
+	}
+	assert.Equal(t, models.LeagueStanding{Rank: 1, UserID: 5, Played: 2, Wins: 2, Points: 6, Buchholz: 3}, byID[5])
+	assert.Equal(t, models.LeagueStanding{Rank: 3, UserID: 2, Played: 2, Wins: 1, Losses: 1, Points: 3, Buchholz: 6}, byID[2])
+	assert.Equal(t, models.LeagueStanding{Rank: 5, UserID: 3, Played: 2, Draws: 1, Losses: 1, Points: 1, Buchholz: 4}, byID[3])
+}
+
+func TestPairRound(t *testing.T) {
+	now := time.Now()
+	l := &models.League{
+		Format:     models.RoundRobin,
+		RoundHours: 24,
+		Players:    []models.LeaguePlayer{{UserID: 1}, {UserID: 2}, {UserID: 3}},
+	}
+	added := pairRound(l, now)
+	require.Len(t, added, 2)
+	assert.Equal(t, 1, l.CurrentRound)
+	assert.Equal(t, now.Add(24*time.Hour), *l.NextRoundAt)
+	assert.Equal(t, models.LeagueFixture{Number: 1, Round: 1, Players: [2]int64{1, 0}, Status: models.FixtureBye, Winner: 1, Deadline: *l.NextRoundAt}, added[0])
+	assert.Equal(t, models.LeagueFixture{Number: 2, Round: 1, Players: [2]int64{2, 3}, Status: models.FixtureScheduled, Deadline: *l.NextRoundAt}, added[1])
+
+	added = pairRound(l, now)
+	assert.Equal(t, 3, added[0].Number, "fixtures are numbered across the whole league")
+	assert.Len(t, l.Fixtures, 4)
+}
@@ -0,0 +1,506 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"leetcodeduels/models"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+var LobbyManager *lobbyManager
+
+type lobbyManager struct {
+	client *redis.Client
+	ctx    context.Context
+}
+
+const (
+	lobbyKeyPrefix       = "lobby:"        // JSON of a lobby by its join code
+	lobbyMemberKeyPrefix = "lobby:member:" // Join code of the lobby a user is in
+	lobbyLockPrefix      = "lobby:lock:"   // Held while a node updates a lobby
+	lobbyAwayKey         = "lobbies:away"  // Sorted set of "code:userID" for away members, scored by when they are removed
+	lobbyTTL             = 30 * time.Minute
+	lobbyLockTTL         = 10 * time.Second
+	lobbyLockWait        = 5 * time.Second
+	lobbyTimerInterval   = time.Second
+
+	lobbyCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // Leaves out characters that are easily mistaken for others
+	lobbyCodeLength   = 6
+	lobbyCodeAttempts = 5
+
+	LobbyAwayGrace  = time.Minute // How long a disconnected member keeps their place
+	MinLobbyMembers = 2
+	MaxLobbyMembers = 8
+)
+
+var (
+	ErrLobbyNotFound      = errors.New("lobby not found")
+	ErrLobbyFull          = fmt.Errorf("a lobby holds at most %d players", MaxLobbyMembers)
+	ErrAlreadyInLobby     = errors.New("already in a lobby")
+	ErrNotInLobby         = errors.New("not in a lobby")
+	ErrNotLobbyHost       = errors.New("only the host can do that")
+	ErrTooFewLobbyMembers = fmt.Errorf("a lobby needs at least %d connected players to start", MinLobbyMembers)
+)
+
+func lobbyKey(code string) string {
+	return lobbyKeyPrefix + code
+}
+func lobbyMemberKey(userID int64) string {
+	return lobbyMemberKeyPrefix + strconv.FormatInt(userID, 10)
+}
+func lobbyAwayEntry(code string, userID int64) string {
+	return code + ":" + strconv.FormatInt(userID, 10)
+}
+
+func InitLobbyManager(redisURL string) error {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return fmt.Errorf("invalid redis URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return fmt.Errorf("redis ping failed: %w", err)
+	}
+	LobbyManager = &lobbyManager{
+		client: client,
+		ctx:    context.Background(),
+	}
+	return nil
+}
+
+// Generates a random join code that is easy to read out and type.
+func newLobbyCode() (string, error) {
+	size := big.NewInt(int64(len(lobbyCodeAlphabet)))
+	code := make([]byte, lobbyCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", err
+		}
+		code[i] = lobbyCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// Join codes are case-insensitive and may be pasted with surrounding whitespace. Returns false
+// if the code could never have been generated.
+func normalizeLobbyCode(code string) (string, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != lobbyCodeLength {
+		return "", false
+	}
+	for _, c := range code {
+		if !strings.ContainsRune(lobbyCodeAlphabet, c) {
+			return "", false
+		}
+	}
+	return code, true
+}
+
+// Creates a lobby with the host as its only member and a join code no other open lobby has.
+func (lm *lobbyManager) CreateLobby(hostID int64, details models.MatchDetails) (*models.Lobby, error) {
+	current, err := lm.lobbyOf(hostID)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil {
+		return nil, ErrAlreadyInLobby
+	}
+
+	l := &models.Lobby{
+		HostID:       hostID,
+		Members:      []models.LobbyMember{{UserID: hostID}},
+		MatchDetails: details,
+		CreatedAt:    time.Now(),
+	}
+	for range lobbyCodeAttempts {
+		if l.Code, err = newLobbyCode(); err != nil {
+			return nil, fmt.Errorf("failed to generate lobby code: %w", err)
+		}
+		data, err := json.Marshal(l)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal lobby: %w", err)
+		}
+		created, err := lm.client.SetNX(lm.ctx, lobbyKey(l.Code), data, lobbyTTL).Result()
+		if err != nil {
+			return nil, fmt.Errorf("redis setnx failed: %w", err)
+		}
+		if created {
+			if err := lm.client.Set(lm.ctx, lobbyMemberKey(hostID), l.Code, lobbyTTL).Err(); err != nil {
+				return nil, fmt.Errorf("failed to store lobby member: %w", err)
+			}
+			return l, nil
+		}
+	}
+	return nil, errors.New("could not find a free lobby code")
+}
+
+// Adds the user to the lobby with the code. Joining a lobby the user is already in returns it.
+func (lm *lobbyManager) JoinLobby(code string, userID int64) (*models.Lobby, error) {
+	code, ok := normalizeLobbyCode(code)
+	if !ok {
+		return nil, ErrLobbyNotFound
+	}
+	current, err := lm.lobbyOf(userID)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil && current.Code != code {
+		return nil, ErrAlreadyInLobby
+	}
+
+	release, err := lm.lock(code)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	l, err := lm.load(code)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil {
+		return nil, ErrLobbyNotFound
+	}
+	if memberIndex(l, userID) >= 0 {
+		return l, nil
+	}
+	if len(l.Members) >= MaxLobbyMembers {
+		return nil, ErrLobbyFull
+	}
+	l.Members = append(l.Members, models.LobbyMember{UserID: userID})
+	if err := lm.save(l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Changes the details the lobby's game will be played with.
+func (lm *lobbyManager) UpdateLobby(userID int64, details models.MatchDetails) (*models.Lobby, error) {
+	return lm.update(userID, func(l *models.Lobby) error {
+		if l.HostID != userID {
+			return ErrNotLobbyHost
+		}
+		l.MatchDetails = details
+		return nil
+	})
+}
+
+// Takes the user out of their lobby, handing it to another member if they were its host. Returns
+// the lobby as the remaining members now see it, which has no members if it has closed.
+func (lm *lobbyManager) LeaveLobby(userID int64) (*models.Lobby, error) {
+	code, err := lm.memberCode(userID)
+	if err != nil {
+		return nil, err
+	}
+	if code == "" {
+		return nil, ErrNotInLobby
+	}
+	l, removed, err := lm.removeMember(code, userID, false)
+	if err != nil {
+		return nil, err
+	}
+	if !removed {
+		return nil, ErrNotInLobby
+	}
+	return l, nil
+}
+
+// Marks a disconnected member as away. They are removed from the lobby unless they reconnect
+// within LobbyAwayGrace. Returns nil if the user isn't in a lobby.
+func (lm *lobbyManager) SetAway(userID int64) (*models.Lobby, error) {
+	l, err := lm.update(userID, func(l *models.Lobby) error {
+		l.Members[memberIndex(l, userID)].Away = true
+		return lm.client.ZAdd(lm.ctx, lobbyAwayKey, &redis.Z{
+			Score:  float64(time.Now().Add(LobbyAwayGrace).Unix()),
+			Member: lobbyAwayEntry(l.Code, userID),
+		}).Err()
+	})
+	if errors.Is(err, ErrNotInLobby) {
+		return nil, nil
+	}
+	return l, err
+}
+
+// Marks a member who reconnected as back in their lobby. Returns nil if the user isn't in a lobby.
+func (lm *lobbyManager) SetBack(userID int64) (*models.Lobby, error) {
+	l, err := lm.update(userID, func(l *models.Lobby) error {
+		l.Members[memberIndex(l, userID)].Away = false
+		return lm.client.ZRem(lm.ctx, lobbyAwayKey, lobbyAwayEntry(l.Code, userID)).Err()
+	})
+	if errors.Is(err, ErrNotInLobby) {
+		return nil, nil
+	}
+	return l, err
+}
+
+// Starts the lobby's game between its connected members and closes the lobby. Members who are
+// away are left out. The lobby stays open if start fails.
+func (lm *lobbyManager) StartLobby(userID int64, start func(l *models.Lobby, players []int64) error) error {
+	code, err := lm.memberCode(userID)
+	if err != nil {
+		return err
+	}
+	if code == "" {
+		return ErrNotInLobby
+	}
+	release, err := lm.lock(code)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	l, err := lm.load(code)
+	if err != nil {
+		return err
+	}
+	if l == nil || memberIndex(l, userID) < 0 {
+		return ErrNotInLobby
+	}
+	if l.HostID != userID {
+		return ErrNotLobbyHost
+	}
+	var players []int64
+	for _, m := range l.Members {
+		if !m.Away {
+			players = append(players, m.UserID)
+		}
+	}
+	if len(players) < MinLobbyMembers {
+		return ErrTooFewLobbyMembers
+	}
+	if err := start(l, players); err != nil {
+		return err
+	}
+
+	pipe := lm.client.TxPipeline()
+	pipe.Del(lm.ctx, lobbyKey(code))
+	for _, m := range l.Members {
+		pipe.Del(lm.ctx, lobbyMemberKey(m.UserID))
+		pipe.ZRem(lm.ctx, lobbyAwayKey, lobbyAwayEntry(code, m.UserID))
+	}
+	if _, err := pipe.Exec(lm.ctx); err != nil {
+		return fmt.Errorf("failed to close started lobby: %w", err)
+	}
+	return nil
+}
+
+// Removes members who stayed away past their grace period, calling onDrop with each lobby that
+// still has members left in it.
+func (lm *lobbyManager) RunTimers(ctx context.Context, onDrop func(l *models.Lobby)) {
+	ticker := time.NewTicker(lobbyTimerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, err := lm.client.ZRangeByScore(lm.ctx, lobbyAwayKey, &redis.ZRangeBy{
+				Min: "-inf",
+				Max: strconv.FormatInt(time.Now().Unix(), 10),
+			}).Result()
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to read lobby timers")
+				continue
+			}
+			for _, entry := range expired {
+				removed, err := lm.client.ZRem(lm.ctx, lobbyAwayKey, entry).Result()
+				if err != nil {
+					log.Error().Err(err).Str("entry", entry).Msg("Failed to claim lobby timer")
+					continue
+				}
+				if removed == 1 {
+					go lm.dropAway(entry, onDrop)
+				}
+			}
+		}
+	}
+}
+
+func (lm *lobbyManager) dropAway(entry string, onDrop func(l *models.Lobby)) {
+	code, id, _ := strings.Cut(entry, ":")
+	userID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		log.Error().Err(err).Str("entry", entry).Msg("Invalid lobby timer")
+		return
+	}
+	l, removed, err := lm.removeMember(code, userID, true)
+	if err != nil {
+		log.Error().Err(err).Str("code", code).Int64("user_id", userID).Msg("Failed to remove away lobby member")
+		return
+	}
+	if removed && len(l.Members) > 0 {
+		onDrop(l)
+	}
+}
+
+// Removes a member, or only one who is still away if onlyAway is set, closing the lobby once it
+// is empty. Returns the lobby left behind and whether the member was removed.
+func (lm *lobbyManager) removeMember(code string, userID int64, onlyAway bool) (*models.Lobby, bool, error) {
+	release, err := lm.lock(code)
+	if err != nil {
+		return nil, false, err
+	}
+	defer release()
+
+	l, err := lm.load(code)
+	if err != nil {
+		return nil, false, err
+	}
+	if l == nil {
+		return nil, false, nil
+	}
+	i := memberIndex(l, userID)
+	if i < 0 || (onlyAway && !l.Members[i].Away) {
+		return nil, false, nil
+	}
+	l.Members = slices.Delete(l.Members, i, i+1)
+	if l.HostID == userID && len(l.Members) > 0 {
+		l.HostID = nextLobbyHost(l)
+	}
+
+	pipe := lm.client.TxPipeline()
+	pipe.Del(lm.ctx, lobbyMemberKey(userID))
+	pipe.ZRem(lm.ctx, lobbyAwayKey, lobbyAwayEntry(code, userID))
+	if len(l.Members) == 0 {
+		pipe.Del(lm.ctx, lobbyKey(code))
+	} else if err := lm.queueSave(pipe, l); err != nil {
+		return nil, false, err
+	}
+	if _, err := pipe.Exec(lm.ctx); err != nil {
+		return nil, false, fmt.Errorf("failed to remove lobby member: %w", err)
+	}
+	return l, true, nil
+}
+
+// The member who takes over from a host who left: whoever joined first among those still
+// connected, or the first to join if everyone is away.
+func nextLobbyHost(l *models.Lobby) int64 {
+	for _, m := range l.Members {
+		if !m.Away {
+			return m.UserID
+		}
+	}
+	return l.Members[0].UserID
+}
+
+func memberIndex(l *models.Lobby, userID int64) int {
+	return slices.IndexFunc(l.Members, func(m models.LobbyMember) bool { return m.UserID == userID })
+}
+
+// Runs fn on the lobby the user is in while holding its lock, then saves it.
+func (lm *lobbyManager) update(userID int64, fn func(l *models.Lobby) error) (*models.Lobby, error) {
+	code, err := lm.memberCode(userID)
+	if err != nil {
+		return nil, err
+	}
+	if code == "" {
+		return nil, ErrNotInLobby
+	}
+	release, err := lm.lock(code)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	l, err := lm.load(code)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil || memberIndex(l, userID) < 0 {
+		return nil, ErrNotInLobby
+	}
+	if err := fn(l); err != nil {
+		return nil, err
+	}
+	if err := lm.save(l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Whether the user is in a lobby that is still open.
+func (lm *lobbyManager) InLobby(userID int64) (bool, error) {
+	l, err := lm.lobbyOf(userID)
+	return l != nil, err
+}
+
+// The lobby the user is in, or nil if they aren't in one that is still open.
+func (lm *lobbyManager) lobbyOf(userID int64) (*models.Lobby, error) {
+	code, err := lm.memberCode(userID)
+	if err != nil || code == "" {
+		return nil, err
+	}
+	l, err := lm.load(code)
+	if err != nil || l == nil || memberIndex(l, userID) < 0 {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (lm *lobbyManager) memberCode(userID int64) (string, error) {
+	code, err := lm.client.Get(lm.ctx, lobbyMemberKey(userID)).Result()
+	if err == redis.Nil {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("redis get lobby member failed: %w", err)
+	}
+	return code, nil
+}
+
+func (lm *lobbyManager) load(code string) (*models.Lobby, error) {
+	data, err := lm.client.Get(lm.ctx, lobbyKey(code)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("redis get lobby failed: %w", err)
+	}
+	var l models.Lobby
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal lobby: %w", err)
+	}
+	return &l, nil
+}
+
+// Saves the lobby, keeping it and its members' keys open for another lobbyTTL.
+func (lm *lobbyManager) save(l *models.Lobby) error {
+	pipe := lm.client.TxPipeline()
+	if err := lm.queueSave(pipe, l); err != nil {
+		return err
+	}
+	if _, err := pipe.Exec(lm.ctx); err != nil {
+		return fmt.Errorf("failed to save lobby: %w", err)
+	}
+	return nil
+}
+
+func (lm *lobbyManager) queueSave(pipe redis.Pipeliner, l *models.Lobby) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return fmt.Errorf("failed to marshal lobby: %w", err)
+	}
+	pipe.Set(lm.ctx, lobbyKey(l.Code), data, lobbyTTL)
+	for _, m := range l.Members {
+		pipe.Set(lm.ctx, lobbyMemberKey(m.UserID), l.Code, lobbyTTL)
+	}
+	return nil
+}
+
+func (lm *lobbyManager) lock(code string) (func(), error) {
+	return waitForLock(lm.ctx, lm.client, lobbyLockPrefix+code, lobbyLockTTL, lobbyLockWait)
+}
+
+func (lm *lobbyManager) Close() error {
+	return lm.client.Close()
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"leetcodeduels/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLobbyCodes(t *testing.T) {
+	for range 20 {
+		code, err := newLobbyCode()
+		require.NoError(t, err)
+		normalized, ok := normalizeLobbyCode(code)
+		assert.True(t, ok, "generated code %q is accepted", code)
+		assert.Equal(t, code, normalized)
+	}
+
+	code, ok := normalizeLobbyCode(" abc234\n")
+	assert.True(t, ok)
+	assert.Equal(t, "ABC234", code)
+
+	for _, bad := range []string{"", "ABC23", "ABC2345", "ABC10O", "AB:CDE"} {
+		_, ok := normalizeLobbyCode(bad)
+		assert.False(t, ok, "%q is rejected", bad)
+	}
+}
+
+func TestNextLobbyHost(t *testing.T) {
+	l := &models.Lobby{Members: []models.LobbyMember{{UserID: 2, Away: true}, {UserID: 3}, {UserID: 4}}}
+	assert.Equal(t, int64(3), nextLobbyHost(l), "the earliest connected member takes over")
+
+	l.Members[1].Away, l.Members[2].Away = true, true
+	assert.Equal(t, int64(2), nextLobbyHost(l), "the earliest member takes over when everyone is away")
+}
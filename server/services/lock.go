@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// Deletes the lock key only if it is still owned by the caller's token.
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// Attempts to take a Redis-backed lock shared by every server node.
+// Returns a release func when the lock was acquired, or nil if another holder has it.
+func acquireLock(ctx context.Context, client *redis.Client, key string, ttl time.Duration) (func(), error) {
+	token := uuid.NewString()
+	ok, err := client.SetNX(ctx, key, token, ttl).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis setnx failed: %w", err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	return func() {
+		_ = releaseLockScript.Run(ctx, client, []string{key}, token).Err()
+	}, nil
+}
+
+const lockRetryInterval = 50 * time.Millisecond
+
+// Like acquireLock, but waits up to wait for another holder to release the lock.
+func waitForLock(ctx context.Context, client *redis.Client, key string, ttl, wait time.Duration) (func(), error) {
+	deadline := time.Now().Add(wait)
+	for {
+		release, err := acquireLock(ctx, client, key, ttl)
+		if err != nil || release != nil {
+			return release, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock %s", key)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
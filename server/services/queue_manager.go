@@ -0,0 +1,351 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"leetcodeduels/config"
+	"leetcodeduels/models"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+var QueueManager *queueManager
+
+var ErrAlreadyInQueue = errors.New("player is already in the matchmaking queue")
+
+type queueManager struct {
+	client *redis.Client
+	ctx    context.Context
+}
+
+const (
+	queuePlayersKey  = "queue:players" // Sorted set of queued playerIDs scored by join time
+	queueEntryPrefix = "queue:entry:"  // String containing a player's serialized QueueEntry
+	queueLockKey     = "queue:lock"    // Held while a node is pairing players
+	queueLockTTL     = 5 * time.Second
+
+	queueMatchInterval = time.Second
+)
+
+// Queues a player and stores their entry, unless they are queued already.
+var enterQueueScript = redis.NewScript(`
+if redis.call("ZADD", KEYS[1], "NX", ARGV[1], ARGV[2]) == 0 then
+	return 0
+end
+redis.call("SET", KEYS[2], ARGV[3])
+return 1`)
+
+// Removes both players from the queue only if neither has left or been paired already.
+var claimPairScript = redis.NewScript(`
+if redis.call("ZSCORE", KEYS[1], ARGV[1]) and redis.call("ZSCORE", KEYS[1], ARGV[2]) then
+	redis.call("ZREM", KEYS[1], ARGV[1], ARGV[2])
+	redis.call("DEL", KEYS[2], KEYS[3])
+	return 1
+end
+return 0`)
+
+func queueEntryKey(playerID int64) string {
+	return queueEntryPrefix + strconv.FormatInt(playerID, 10)
+}
+
+func InitQueueManager(redisURL string) error {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return fmt.Errorf("invalid redis URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return fmt.Errorf("redis ping failed: %w", err)
+	}
+	QueueManager = &queueManager{
+		client: client,
+		ctx:    context.Background(),
+	}
+	return nil
+}
+
+// Adds a player to the queue, or returns ErrAlreadyInQueue if they are queued already.
+// Pairing happens asynchronously in Run.
+func (qm *queueManager) EnterQueue(entry models.QueueEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal queue entry: %w", err)
+	}
+	added, err := enterQueueScript.Run(qm.ctx, qm.client,
+		[]string{queuePlayersKey, queueEntryKey(entry.UserID)},
+		entry.JoinedAt.UnixMilli(), entry.UserID, data,
+	).Int()
+	if err != nil {
+		return fmt.Errorf("failed to store queue entry: %w", err)
+	}
+	if added == 0 {
+		return ErrAlreadyInQueue
+	}
+	return nil
+}
+
+// Periodically pairs queued players until ctx is canceled, calling onMatch for each pair.
+// Every node runs this loop; the queue lock ensures only one of them pairs at a time.
+func (qm *queueManager) Run(ctx context.Context, onMatch func(a, b models.QueueEntry)) {
+	ticker := time.NewTicker(queueMatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pairs, err := qm.matchPlayers()
+			if err != nil {
+				log.Error().Err(err).Msg("Matchmaking pass failed")
+				continue
+			}
+			for _, pair := range pairs {
+				go onMatch(pair[0], pair[1])
+			}
+		}
+	}
+}
+
+// Runs a single matchmaking pass, returning the pairs that were claimed from the queue.
+func (qm *queueManager) matchPlayers() ([][2]models.QueueEntry, error) {
+	release, err := acquireLock(qm.ctx, qm.client, queueLockKey, queueLockTTL)
+	if err != nil {
+		return nil, err
+	}
+	if release == nil {
+		return nil, nil // Another node is pairing right now
+	}
+	defer release()
+
+	waiting, err := qm.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := config.GetConfig()
+	window := ratingWindow{
+		base:   cfg.MM_BASE_WINDOW,
+		growth: cfg.MM_WINDOW_GROWTH,
+		max:    cfg.MM_MAX_WINDOW,
+	}
+
+	var claimed [][2]models.QueueEntry
+	for _, pair := range pairEntries(waiting, window, time.Now()) {
+		ok, err := qm.claim(pair[0].UserID, pair[1].UserID)
+		if err != nil {
+			return claimed, err
+		}
+		if ok {
+			claimed = append(claimed, pair)
+		}
+	}
+	return claimed, nil
+}
+
+// Atomically removes both players from the queue, only if both are still queued.
+func (qm *queueManager) claim(a, b int64) (bool, error) {
+	res, err := claimPairScript.Run(qm.ctx, qm.client,
+		[]string{queuePlayersKey, queueEntryKey(a), queueEntryKey(b)},
+		a, b,
+	).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim queue pair: %w", err)
+	}
+	return res == 1, nil
+}
+
+// Removes a player from the queue; returns true if they were queued.
+func (qm *queueManager) LeaveQueue(playerID int64) (bool, error) {
+	removed, err := qm.client.ZRem(qm.ctx, queuePlayersKey, playerID).Result()
+	if err != nil {
+		return false, fmt.Errorf("redis zrem failed: %w", err)
+	}
+	if err := qm.client.Del(qm.ctx, queueEntryKey(playerID)).Err(); err != nil {
+		return false, fmt.Errorf("redis del failed: %w", err)
+	}
+	return removed > 0, nil
+}
+
+func (qm *queueManager) IsQueued(playerID int64) (bool, error) {
+	return qm.isQueued(playerID)
+}
+
+// Returns the number of players currently waiting in the queue.
+func (qm *queueManager) QueueSize() (int64, error) {
+	size, err := qm.client.ZCard(qm.ctx, queuePlayersKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("redis zcard failed: %w", err)
+	}
+	return size, nil
+}
+
+func (qm *queueManager) Close() error {
+	return qm.client.Close()
+}
+
+func (qm *queueManager) isQueued(playerID int64) (bool, error) {
+	_, err := qm.client.ZScore(qm.ctx, queuePlayersKey, strconv.FormatInt(playerID, 10)).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("redis zscore failed: %w", err)
+	}
+	return true, nil
+}
+
+// Returns every queued entry, longest waiting first.
+func (qm *queueManager) entries() ([]models.QueueEntry, error) {
+	members, err := qm.client.ZRange(qm.ctx, queuePlayersKey, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis zrange failed: %w", err)
+	}
+	if len(members) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(members))
+	for i, m := range members {
+		keys[i] = queueEntryPrefix + m
+	}
+	data, err := qm.client.MGet(qm.ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis mget failed: %w", err)
+	}
+
+	entries := make([]models.QueueEntry, 0, len(members))
+	for i, raw := range data {
+		str, ok := raw.(string)
+		if !ok {
+			// Entry is gone but the player is still in the set; drop the stale member
+			_ = qm.client.ZRem(qm.ctx, queuePlayersKey, members[i]).Err()
+			continue
+		}
+		var entry models.QueueEntry
+		if err := json.Unmarshal([]byte(str), &entry); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal queue entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Acceptable rating difference for a queued player, widening the longer they wait.
+type ratingWindow struct {
+	base   int
+	growth int
+	max    int
+}
+
+func (w ratingWindow) at(entry models.QueueEntry, now time.Time) int {
+	waited := int(now.Sub(entry.JoinedAt).Seconds())
+	if waited < 0 {
+		waited = 0
+	}
+	return min(w.base+w.growth*waited, w.max)
+}
+
+// Greedily pairs entries, oldest first, with the closest rated compatible player.
+// Entries must be ordered by join time.
+func pairEntries(entries []models.QueueEntry, window ratingWindow, now time.Time) [][2]models.QueueEntry {
+	paired := make([]bool, len(entries))
+	var pairs [][2]models.QueueEntry
+
+	for i, a := range entries {
+		if paired[i] {
+			continue
+		}
+		best := -1
+		bestDiff := 0
+		for j := i + 1; j < len(entries); j++ {
+			b := entries[j]
+			if paired[j] || !compatibleEntries(a, b) {
+				continue
+			}
+			diff := QueueRatingDiff(a, b)
+			if diff > window.at(a, now) || diff > window.at(b, now) {
+				continue
+			}
+			if best == -1 || diff < bestDiff {
+				best, bestDiff = j, diff
+			}
+		}
+		if best != -1 {
+			paired[i], paired[best] = true, true
+			pairs = append(pairs, [2]models.QueueEntry{a, entries[best]})
+		}
+	}
+	return pairs
+}
+
+// How far apart two queued players are rated. Players queueing for the same single tag are
+// compared on their rating for it, and everyone else on their overall rating.
+func QueueRatingDiff(a, b models.QueueEntry) int {
+	if len(a.Tags) == 1 && len(b.Tags) == 1 && a.Tags[0] == b.Tags[0] {
+		return abs(a.TagRating - b.TagRating)
+	}
+	return abs(a.Rating - b.Rating)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// Two entries are compatible if they share at least one difficulty, tag and language.
+// An empty list means the player accepts anything.
+func compatibleEntries(a, b models.QueueEntry) bool {
+	if a.UserID == b.UserID {
+		return false
+	}
+	_, ok := intersectPreferences(a.Difficulties, b.Difficulties)
+	if !ok {
+		return false
+	}
+	_, ok = intersectPreferences(a.Tags, b.Tags)
+	if !ok {
+		return false
+	}
+	_, ok = intersectPreferences(a.Languages, b.Languages)
+	return ok
+}
+
+// Returns the match details both queued players agreed to.
+func QueueMatchDetails(a, b models.QueueEntry) models.MatchDetails {
+	difficulties, _ := intersectPreferences(a.Difficulties, b.Difficulties)
+	tags, _ := intersectPreferences(a.Tags, b.Tags)
+	languages, _ := intersectPreferences(a.Languages, b.Languages)
+	return models.MatchDetails{
+		IsRated:      true,
+		Difficulties: difficulties,
+		Tags:         tags,
+		Languages:    languages,
+	}
+}
+
+// Returns the values acceptable to both sides, treating an empty list as "any".
+// The bool is false when both sides have preferences that do not overlap.
+func intersectPreferences[T comparable](a, b []T) ([]T, bool) {
+	if len(a) == 0 {
+		return b, true
+	}
+	if len(b) == 0 {
+		return a, true
+	}
+	var common []T
+	for _, v := range a {
+		if slices.Contains(b, v) {
+			common = append(common, v)
+		}
+	}
+	return common, len(common) > 0
+}
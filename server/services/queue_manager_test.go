@@ -0,0 +1,94 @@
+package services
+
+import (
+	"leetcodeduels/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPairEntries(t *testing.T) {
+	now := time.Now()
+	window := ratingWindow{base: 100, growth: 10, max: 600}
+
+	t.Run("pairs closest rating within window", func(t *testing.T) {
+		entries := []models.QueueEntry{
+			{UserID: 1, Rating: 1000, JoinedAt: now},
+			{UserID: 2, Rating: 1090, JoinedAt: now},
+			{UserID: 3, Rating: 1020, JoinedAt: now},
+		}
+		pairs := pairEntries(entries, window, now)
+		assert.Len(t, pairs, 1)
+		assert.Equal(t, int64(1), pairs[0][0].UserID)
+		assert.Equal(t, int64(3), pairs[0][1].UserID)
+	})
+
+	t.Run("does not pair outside window", func(t *testing.T) {
+		entries := []models.QueueEntry{
+			{UserID: 1, Rating: 1800, JoinedAt: now},
+			{UserID: 2, Rating: 1000, JoinedAt: now},
+		}
+		assert.Empty(t, pairEntries(entries, window, now))
+	})
+
+	t.Run("window widens while both players wait", func(t *testing.T) {
+		entries := []models.QueueEntry{
+			{UserID: 1, Rating: 1300, JoinedAt: now.Add(-30 * time.Second)},
+			{UserID: 2, Rating: 1000, JoinedAt: now},
+		}
+		assert.Empty(t, pairEntries(entries, window, now), "newcomer's window is still narrow")
+
+		entries[1].JoinedAt = now.Add(-20 * time.Second)
+		assert.Len(t, pairEntries(entries, window, now), 1)
+	})
+
+	t.Run("window is capped", func(t *testing.T) {
+		entries := []models.QueueEntry{
+			{UserID: 1, Rating: 1800, JoinedAt: now.Add(-time.Hour)},
+			{UserID: 2, Rating: 1000, JoinedAt: now.Add(-time.Hour)},
+		}
+		assert.Empty(t, pairEntries(entries, window, now))
+	})
+
+	t.Run("compares tag ratings only for the same single tag", func(t *testing.T) {
+		entries := []models.QueueEntry{
+			{UserID: 1, Rating: 1800, TagRating: 1000, Tags: []int{4}, JoinedAt: now},
+			{UserID: 2, Rating: 1000, JoinedAt: now},
+		}
+		assert.Empty(t, pairEntries(entries, window, now), "a new tag doesn't put a strong player among new accounts")
+
+		entries = append(entries, models.QueueEntry{UserID: 3, Rating: 1200, TagRating: 1050, Tags: []int{4}, JoinedAt: now})
+		pairs := pairEntries(entries, window, now)
+		assert.Len(t, pairs, 1)
+		assert.Equal(t, int64(1), pairs[0][0].UserID)
+		assert.Equal(t, int64(3), pairs[0][1].UserID)
+	})
+
+	t.Run("requires overlapping preferences", func(t *testing.T) {
+		entries := []models.QueueEntry{
+			{UserID: 1, Rating: 1000, JoinedAt: now, Difficulties: []models.Difficulty{models.Easy}},
+			{UserID: 2, Rating: 1000, JoinedAt: now, Difficulties: []models.Difficulty{models.Hard}},
+			{UserID: 3, Rating: 1000, JoinedAt: now, Tags: []int{4}},
+		}
+		pairs := pairEntries(entries, window, now)
+		assert.Len(t, pairs, 1)
+		assert.Equal(t, int64(1), pairs[0][0].UserID)
+		assert.Equal(t, int64(3), pairs[0][1].UserID)
+	})
+
+	t.Run("requires a common language", func(t *testing.T) {
+		entries := []models.QueueEntry{
+			{UserID: 1, Rating: 1000, JoinedAt: now, Languages: []models.LanguageType{models.Rust}},
+			{UserID: 2, Rating: 1000, JoinedAt: now, Languages: []models.LanguageType{models.Python3}},
+			{UserID: 3, Rating: 1000, JoinedAt: now, Languages: []models.LanguageType{models.Golang, models.Rust}},
+		}
+		pairs := pairEntries(entries, window, now)
+		assert.Len(t, pairs, 1)
+		assert.Equal(t, int64(1), pairs[0][0].UserID)
+		assert.Equal(t, int64(3), pairs[0][1].UserID)
+
+		details := QueueMatchDetails(pairs[0][0], pairs[0][1])
+		assert.Equal(t, []models.LanguageType{models.Rust}, details.Languages)
+	})
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"fmt"
+	"leetcodeduels/config"
+	"leetcodeduels/models"
+	"leetcodeduels/store"
+	"math"
+	"slices"
+	"time"
+)
+
+const (
+	DefaultRating     = 1000
+	DefaultDeviation  = 350.0
+	DefaultVolatility = 0.06
+)
+
+// Calculates the new rating state of every player after a rated match.
+type ratingEngine interface {
+	rate(players []models.PlayerRating, order []int64, now time.Time) []models.RatingChange
+}
+
+func newRatingEngine(cfg *config.Config) ratingEngine {
+	switch cfg.RATING_SYSTEM {
+	case "glicko2":
+		return glicko2Engine{tau: glickoTau, period: ratingPeriod(cfg)}
+	default:
+		return eloEngine{
+			k:              float64(cfg.ELO_K_FACTOR),
+			placementK:     float64(cfg.PLACEMENT_K_FACTOR),
+			placementGames: cfg.PLACEMENT_GAMES,
+		}
+	}
+}
+
+// Whether a player with the given number of rated matches is still in placement.
+func IsProvisional(gamesPlayed int) bool {
+	return gamesPlayed < config.GetConfig().PLACEMENT_GAMES
+}
+
+func ratingPeriod(cfg *config.Config) time.Duration {
+	return time.Duration(cfg.RATING_PERIOD_DAYS) * 24 * time.Hour
+}
+
+// Computes the new ratings of every player in a finished rated session.
+// Ratings are not persisted here; StoreMatch saves them together with the match.
+func CalculateRatingChanges(session *models.Session) ([]models.RatingChange, error) {
+	players := make([]models.PlayerRating, 0, len(session.Players))
+	for _, pid := range session.Players {
+		rating, err := store.DataStore.GetPlayerRating(pid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get rating for player %d: %w", pid, err)
+		}
+		players = append(players, *rating)
+	}
+
+	engine := newRatingEngine(config.GetConfig())
+	changes := engine.rate(players, finishingOrder(session), session.EndTime)
+	for i := range changes {
+		changes[i].OpponentRating = opponentRating(players, changes[i].PlayerID)
+		changes[i].Provisional = IsProvisional(players[i].GamesPlayed + 1)
+	}
+	return changes, nil
+}
+
+// Computes Elo changes to the players' ratings on the difficulty and tags of every problem played,
+// which for a relay is each of its problems. A tag shared by several problems is rated once.
+// Skill ratings always use Elo; they are too sparse for deviation to be meaningful.
+func CalculateSkillChanges(session *models.Session) ([]models.SkillRatingChange, error) {
+	k := float64(config.GetConfig().ELO_K_FACTOR)
+	order := finishingOrder(session)
+
+	problems := session.Problems
+	if len(problems) == 0 {
+		problems = []models.Problem{session.Problem}
+	}
+
+	var changes []models.SkillRatingChange
+	var difficulties []models.Difficulty
+	var tagIDs []int
+	for _, problem := range problems {
+		if !slices.Contains(difficulties, problem.Difficulty) {
+			difficulties = append(difficulties, problem.Difficulty)
+			stored, err := store.DataStore.GetDifficultyRatings(session.Players, problem.Difficulty)
+			if err != nil {
+				return nil, err
+			}
+			difficultyChanges := skillChanges(session.Players, stored, order, k)
+			for i := range difficultyChanges {
+				difficultyChanges[i].Difficulty = problem.Difficulty
+			}
+			changes = append(changes, difficultyChanges...)
+		}
+
+		tags, err := store.DataStore.GetTagsByProblem(problem.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range tags {
+			if slices.Contains(tagIDs, tag.ID) {
+				continue
+			}
+			tagIDs = append(tagIDs, tag.ID)
+			stored, err := store.DataStore.GetTagRatings(session.Players, tag.ID)
+			if err != nil {
+				return nil, err
+			}
+			tagChanges := skillChanges(session.Players, stored, order, k)
+			for i := range tagChanges {
+				tagChanges[i].TagID = tag.ID
+			}
+			changes = append(changes, tagChanges...)
+		}
+	}
+	return changes, nil
+}
+
+// Applies Elo to a single skill. Players without a stored rating start at DefaultRating.
+func skillChanges(players []int64, stored map[int64]int, order []int64, k float64) []models.SkillRatingChange {
+	ratings := make(map[int64]int, len(players))
+	for _, pid := range players {
+		rating, ok := stored[pid]
+		if !ok {
+			rating = DefaultRating
+		}
+		ratings[pid] = rating
+	}
+
+	elo := eloRatingChanges(players, ratings, order, k)
+	changes := make([]models.SkillRatingChange, len(elo))
+	for i, c := range elo {
+		changes[i] = models.SkillRatingChange{
+			PlayerID:  c.PlayerID,
+			OldRating: c.OldRating,
+			NewRating: c.NewRating,
+		}
+	}
+	return changes
+}
+
+// Returns a player's rating on a single tag, or DefaultRating if they have never played it.
+func GetTagRating(playerID int64, tagID int) (int, error) {
+	stored, err := store.DataStore.GetTagRatings([]int64{playerID}, tagID)
+	if err != nil {
+		return 0, err
+	}
+	if rating, ok := stored[playerID]; ok {
+		return rating, nil
+	}
+	return DefaultRating, nil
+}
+
+// The order players finished in, best first. Sessions without placements only rank the winner,
+// and draws rank nobody so every pairing scores 0.5.
+func finishingOrder(session *models.Session) []int64 {
+	if len(session.Placements) > 0 {
+		return session.Placements
+	}
+	if session.Winner > 0 {
+		return []int64{session.Winner}
+	}
+	return nil
+}
+
+// Average pre-match rating of everyone but the given player.
+func opponentRating(players []models.PlayerRating, playerID int64) int {
+	total, count := 0, 0
+	for _, p := range players {
+		if p.PlayerID != playerID {
+			total += p.Rating
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return int(math.Round(float64(total) / float64(count)))
+}
+
+// Returns a player's rating deviation as of now. Under Glicko-2 the deviation grows
+// with every rating period the player sits out, up to the deviation of a new player.
+func EffectiveDeviation(deviation, volatility float64, lastRatedAt *time.Time) float64 {
+	cfg := config.GetConfig()
+	if cfg.RATING_SYSTEM != "glicko2" {
+		return deviation
+	}
+	return inflateDeviation(deviation, volatility, lastRatedAt, ratingPeriod(cfg), time.Now())
+}
+
+type eloEngine struct {
+	k              float64
+	placementK     float64 // Larger K so new players reach their real rating quickly
+	placementGames int
+}
+
+func (e eloEngine) rate(players []models.PlayerRating, order []int64, now time.Time) []models.RatingChange {
+	ids := make([]int64, len(players))
+	ratings := make(map[int64]int, len(players))
+	for i, p := range players {
+		ids[i] = p.PlayerID
+		ratings[p.PlayerID] = p.Rating
+	}
+
+	changes := eloRatingChanges(ids, ratings, order, e.k)
+	placement := eloRatingChanges(ids, ratings, order, e.placementK)
+	for i, p := range players {
+		if p.GamesPlayed < e.placementGames {
+			changes[i] = placement[i]
+		}
+	}
+	// Elo has no notion of deviation; carry the stored values through untouched
+	for i := range changes {
+		changes[i].Deviation = players[i].Deviation
+		changes[i].Volatility = players[i].Volatility
+	}
+	return changes
+}
+
+// Applies Elo between every pair of players. Each player scores 1 against everyone
+// who finished behind them, and players missing from the order count as tied for last.
+func eloRatingChanges(players []int64, ratings map[int64]int, order []int64, k float64) []models.RatingChange {
+	changes := make([]models.RatingChange, 0, len(players))
+	for _, pid := range players {
+		delta := 0.0
+		for _, opp := range players {
+			if opp == pid {
+				continue
+			}
+			delta += k * (pairScore(pid, opp, order) - eloExpected(ratings[pid], ratings[opp]))
+		}
+		if len(players) > 2 {
+			delta /= float64(len(players) - 1)
+		}
+
+		change := int(math.Round(delta))
+		changes = append(changes, models.RatingChange{
+			PlayerID:  pid,
+			OldRating: ratings[pid],
+			NewRating: ratings[pid] + change,
+			Change:    change,
+		})
+	}
+	return changes
+}
+
+// Probability that a player rated a beats a player rated b.
+func eloExpected(a, b int) float64 {
+	return 1 / (1 + math.Pow(10, float64(b-a)/400))
+}
+
+func pairScore(playerID, opponentID int64, order []int64) float64 {
+	mine, theirs := finishRank(order, playerID), finishRank(order, opponentID)
+	switch {
+	case mine < theirs:
+		return 1
+	case mine > theirs:
+		return 0
+	default:
+		return 0.5
+	}
+}
+
+// Zero-based position in the finishing order; unplaced players share the last position.
+func finishRank(order []int64, playerID int64) int {
+	if i := slices.Index(order, playerID); i >= 0 {
+		return i
+	}
+	return len(order)
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"leetcodeduels/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEloRatingChanges(t *testing.T) {
+	t.Run("equal ratings split K", func(t *testing.T) {
+		changes := eloRatingChanges([]int64{1, 2}, map[int64]int{1: 1000, 2: 1000}, []int64{1}, 32)
+		assert.Equal(t, []models.RatingChange{
+			{PlayerID: 1, OldRating: 1000, NewRating: 1016, Change: 16},
+			{PlayerID: 2, OldRating: 1000, NewRating: 984, Change: -16},
+		}, changes)
+	})
+
+	t.Run("upset moves ratings more", func(t *testing.T) {
+		changes := eloRatingChanges([]int64{1, 2}, map[int64]int{1: 1000, 2: 1400}, []int64{1}, 32)
+		assert.Equal(t, 29, changes[0].Change)
+		assert.Equal(t, -29, changes[1].Change)
+	})
+
+	t.Run("expected win moves ratings less", func(t *testing.T) {
+		changes := eloRatingChanges([]int64{1, 2}, map[int64]int{1: 1000, 2: 1400}, []int64{2}, 32)
+		assert.Equal(t, -3, changes[0].Change)
+		assert.Equal(t, 3, changes[1].Change)
+	})
+
+	t.Run("draw moves ratings toward each other", func(t *testing.T) {
+		changes := eloRatingChanges([]int64{1, 2}, map[int64]int{1: 1000, 2: 1400}, nil, 32)
+		assert.Equal(t, 13, changes[0].Change)
+		assert.Equal(t, -13, changes[1].Change)
+	})
+}
+
+func TestEloFinishingOrder(t *testing.T) {
+	ratings := map[int64]int{1: 1000, 2: 1000, 3: 1000, 4: 1000}
+	changes := eloRatingChanges([]int64{1, 2, 3, 4}, ratings, []int64{3, 1, 4, 2}, 32)
+
+	byPlayer := make(map[int64]int, len(changes))
+	for _, c := range changes {
+		byPlayer[c.PlayerID] = c.Change
+	}
+	assert.Equal(t, 16, byPlayer[3])
+	assert.Equal(t, 5, byPlayer[1])
+	assert.Equal(t, -5, byPlayer[4])
+	assert.Equal(t, -16, byPlayer[2])
+
+	t.Run("unplaced players tie for last", func(t *testing.T) {
+		changes := eloRatingChanges([]int64{1, 2, 3}, ratings, []int64{2}, 32)
+		assert.Equal(t, changes[0].Change, changes[2].Change)
+		assert.Equal(t, 16, changes[1].Change)
+	})
+}
+
+func TestGlicko2Update(t *testing.T) {
+	// Worked example from Glickman's Glicko-2 paper
+	toMu := func(r float64) float64 { return (r - 1500) / glickoScale }
+	results := []glickoResult{
+		{mu: toMu(1400), phi: 30 / glickoScale, score: 1},
+		{mu: toMu(1550), phi: 100 / glickoScale, score: 0},
+		{mu: toMu(1700), phi: 300 / glickoScale, score: 0},
+	}
+
+	mu, phi, sigma := glicko2Update(0, 200/glickoScale, 0.06, results, 0.5)
+	assert.InDelta(t, 1464.06, mu*glickoScale+1500, 0.01)
+	assert.InDelta(t, 151.52, phi*glickoScale, 0.01)
+	assert.InDelta(t, 0.05999, sigma, 0.00001)
+}
+
+func TestGlicko2Engine(t *testing.T) {
+	engine := glicko2Engine{tau: glickoTau, period: 7 * 24 * time.Hour}
+	now := time.Now()
+
+	t.Run("new players move further than established ones", func(t *testing.T) {
+		changes := engine.rate([]models.PlayerRating{
+			{PlayerID: 1, Rating: 1000, Deviation: DefaultDeviation, Volatility: DefaultVolatility},
+			{PlayerID: 2, Rating: 1000, Deviation: 50, Volatility: DefaultVolatility, LastRatedAt: &now},
+		}, []int64{1}, now)
+		assert.Greater(t, changes[0].Change, -changes[1].Change)
+		assert.Less(t, changes[0].Deviation, DefaultDeviation)
+	})
+
+	t.Run("inactivity inflates deviation up to the cap", func(t *testing.T) {
+		lastWeek := now.Add(-8 * 24 * time.Hour)
+		assert.Greater(t, inflateDeviation(50, DefaultVolatility, &lastWeek, engine.period, now), 50.0)
+		assert.Equal(t, 50.0, inflateDeviation(50, DefaultVolatility, &now, engine.period, now))
+
+		longAgo := now.Add(-10 * 365 * 24 * time.Hour)
+		assert.Equal(t, DefaultDeviation, inflateDeviation(300, 0.5, &longAgo, engine.period, now))
+	})
+}
+
+func TestSkillChanges(t *testing.T) {
+	// Player 2 has no stored rating for this skill yet
+	changes := skillChanges([]int64{1, 2}, map[int64]int{1: 1100}, []int64{2}, 32)
+	assert.Equal(t, 1100, changes[0].OldRating)
+	assert.Equal(t, DefaultRating, changes[1].OldRating)
+	assert.Equal(t, 20, changes[1].NewRating-changes[1].OldRating)
+	assert.Equal(t, -20, changes[0].NewRating-changes[0].OldRating)
+}
+
+func TestEloPlacement(t *testing.T) {
+	engine := eloEngine{k: 32, placementK: 64, placementGames: 5}
+	changes := engine.rate([]models.PlayerRating{
+		{PlayerID: 1, Rating: 1000, GamesPlayed: 0},
+		{PlayerID: 2, Rating: 1000, GamesPlayed: 20},
+	}, []int64{1}, time.Now())
+
+	assert.Equal(t, 32, changes[0].Change, "placement player uses the larger K")
+	assert.Equal(t, -16, changes[1].Change)
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"cmp"
+	"leetcodeduels/models"
+	"slices"
+	"time"
+)
+
+// Scores each player's best submission under the session's scoring mode, in placement order
+// with unplaced players last. Standard sessions are decided by the first Accepted submission
+// and are not scored.
+func sessionScores(session *models.Session) []models.PlayerScore {
+	if session.ScoringMode == models.ScoringStandard {
+		return nil
+	}
+
+	order := slices.Clone(session.Placements)
+	for _, pid := range session.Players {
+		if !slices.Contains(order, pid) {
+			order = append(order, pid)
+		}
+	}
+
+	scores := make([]models.PlayerScore, 0, len(order))
+	for _, pid := range order {
+		scores = append(scores, ScorePlayer(session, pid))
+	}
+	return scores
+}
+
+// The player's best submission under the session's scoring mode, the earliest of them on ties.
+// A player without a submission that counts scores zero.
+func ScorePlayer(session *models.Session, playerID int64) models.PlayerScore {
+	if session.ScoringMode == models.ScoringPenalty {
+		return penaltyScore(session, playerID)
+	}
+
+	best := models.PlayerScore{PlayerID: playerID}
+	for _, sub := range session.Submissions {
+		if sub.PlayerID != playerID {
+			continue
+		}
+
+		score := models.PlayerScore{
+			PlayerID:        playerID,
+			PassedTestCases: sub.PassedTestCases,
+			TotalTestCases:  sub.TotalTestCases,
+			Runtime:         sub.Runtime,
+			Memory:          sub.Memory,
+			SubmissionID:    sub.ID,
+			SubmittedAt:     &sub.Time,
+		}
+		switch session.ScoringMode {
+		case models.ScoringOptimize:
+			if sub.Status != models.Accepted {
+				continue
+			}
+			score.Score = percentile(sub, session.OptimizeFor)
+		default:
+			score.Score = passedPercent(sub)
+		}
+
+		if compareScores(session.ScoringMode, score, best) < 0 {
+			best = score
+		}
+	}
+	return best
+}
+
+// The player's first Accepted submission, with the time from the start of the session to it
+// adjusted by a penalty for every rejected submission before it. Rejected submissions are still
+// counted for players who never solve the problem.
+func penaltyScore(session *models.Session, playerID int64) models.PlayerScore {
+	score := models.PlayerScore{PlayerID: playerID}
+	for _, sub := range session.Submissions {
+		if sub.PlayerID != playerID {
+			continue
+		}
+		if sub.Status != models.Accepted {
+			score.Penalties++
+			continue
+		}
+
+		score.Score = passedPercent(sub)
+		score.PassedTestCases = sub.PassedTestCases
+		score.TotalTestCases = sub.TotalTestCases
+		score.Runtime = sub.Runtime
+		score.Memory = sub.Memory
+		score.SubmissionID = sub.ID
+		score.SubmittedAt = &sub.Time
+		break
+	}
+
+	penaltyTime := time.Duration(score.Penalties*session.Penalty) * time.Minute
+	score.PenaltyTime = int64(penaltyTime.Seconds())
+	if score.SubmittedAt != nil {
+		score.AdjustedTime = int64((score.SubmittedAt.Sub(session.StartTime) + penaltyTime).Seconds())
+	}
+	return score
+}
+
+func passedPercent(sub models.PlayerSubmission) float64 {
+	if sub.Status == models.Accepted {
+		return 100
+	}
+	if sub.TotalTestCases <= 0 {
+		return 0
+	}
+	return float64(sub.PassedTestCases) * 100 / float64(sub.TotalTestCases)
+}
+
+// The share of LeetCode solutions the submission beats on the metric, or 0 if LeetCode didn't report it.
+func percentile(sub models.PlayerSubmission, metric models.OptimizationMetric) float64 {
+	p := sub.RuntimePercentile
+	if metric == models.OptimizeMemory {
+		p = sub.MemoryPercentile
+	}
+	if p == nil {
+		return 0
+	}
+	return *p
+}
+
+// Negative if a ranks above b and zero if they are tied. Having a scored submission at all beats
+// not having one, and equal scores (or adjusted times in penalty sessions) go to whoever submitted first.
+func compareScores(mode models.ScoringMode, a, b models.PlayerScore) int {
+	if mode == models.ScoringPenalty {
+		if a.SubmittedAt != nil && b.SubmittedAt != nil && a.AdjustedTime != b.AdjustedTime {
+			return cmp.Compare(a.AdjustedTime, b.AdjustedTime)
+		}
+	} else if a.Score != b.Score {
+		return cmp.Compare(b.Score, a.Score)
+	}
+
+	switch {
+	case a.SubmittedAt == nil && b.SubmittedAt == nil:
+		return 0
+	case a.SubmittedAt == nil:
+		return 1
+	case b.SubmittedAt == nil:
+		return -1
+	}
+	return a.SubmittedAt.Compare(*b.SubmittedAt)
+}
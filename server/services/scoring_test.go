@@ -0,0 +1,98 @@
+package services
+
+import (
+	"leetcodeduels/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionScores(t *testing.T) {
+	start := time.Now()
+	session := &models.Session{
+		ScoringMode: models.ScoringPartial,
+		Players:     []int64{1, 2, 3},
+		Placements:  []int64{2, 1},
+		Submissions: []models.PlayerSubmission{
+			{ID: 10, PlayerID: 1, PassedTestCases: 8, TotalTestCases: 10, Status: models.WrongAnswer, Time: start},
+			{ID: 11, PlayerID: 2, PassedTestCases: 10, TotalTestCases: 10, Status: models.Accepted, Time: start.Add(time.Minute)},
+			{ID: 12, PlayerID: 1, PassedTestCases: 8, TotalTestCases: 10, Status: models.TimeLimitExceeded, Time: start.Add(2 * time.Minute)},
+			{ID: 13, PlayerID: 1, PassedTestCases: 2, TotalTestCases: 10, Status: models.WrongAnswer, Time: start.Add(3 * time.Minute)},
+		},
+	}
+
+	scores := sessionScores(session)
+	require.Len(t, scores, 3)
+
+	assert.Equal(t, int64(2), scores[0].PlayerID)
+	assert.Equal(t, 100.0, scores[0].Score)
+
+	assert.Equal(t, int64(1), scores[1].PlayerID)
+	assert.Equal(t, 80.0, scores[1].Score)
+	assert.Equal(t, int64(10), scores[1].SubmissionID, "ties go to the earliest submission")
+
+	assert.Equal(t, models.PlayerScore{PlayerID: 3}, scores[2])
+
+	session.ScoringMode = models.ScoringStandard
+	assert.Nil(t, sessionScores(session))
+}
+
+func TestOptimizationScores(t *testing.T) {
+	start := time.Now()
+	first, better := 60.0, 85.0
+	runtime := int32(12)
+	session := &models.Session{
+		ScoringMode: models.ScoringOptimize,
+		OptimizeFor: models.OptimizeRuntime,
+		Players:     []int64{1, 2},
+		Submissions: []models.PlayerSubmission{
+			{ID: 1, PlayerID: 1, Status: models.Accepted, RuntimePercentile: &first, Time: start},
+			{ID: 2, PlayerID: 1, Status: models.Accepted, RuntimePercentile: &better, Runtime: &runtime, Time: start.Add(time.Minute)},
+			{ID: 3, PlayerID: 2, Status: models.WrongAnswer, PassedTestCases: 5, TotalTestCases: 10, Time: start},
+		},
+	}
+
+	scores := sessionScores(session)
+	require.Len(t, scores, 2)
+	assert.Equal(t, 85.0, scores[0].Score, "the best accepted submission counts")
+	assert.Equal(t, int64(2), scores[0].SubmissionID)
+	assert.Equal(t, &runtime, scores[0].Runtime)
+	assert.Equal(t, models.PlayerScore{PlayerID: 2}, scores[1], "only accepted submissions are scored")
+}
+
+func TestPenaltyScores(t *testing.T) {
+	start := time.Now()
+	session := &models.Session{
+		ScoringMode: models.ScoringPenalty,
+		Penalty:     5,
+		StartTime:   start,
+		Players:     []int64{1, 2, 3},
+		Submissions: []models.PlayerSubmission{
+			{ID: 1, PlayerID: 1, Status: models.WrongAnswer, Time: start.Add(time.Minute)},
+			{ID: 2, PlayerID: 1, Status: models.CompileError, Time: start.Add(2 * time.Minute)},
+			{ID: 3, PlayerID: 1, Status: models.Accepted, Time: start.Add(3 * time.Minute)},
+			{ID: 4, PlayerID: 2, Status: models.Accepted, Time: start.Add(10 * time.Minute)},
+			{ID: 5, PlayerID: 1, Status: models.WrongAnswer, Time: start.Add(11 * time.Minute)},
+			{ID: 6, PlayerID: 3, Status: models.RuntimeError, Time: start.Add(time.Minute)},
+		},
+	}
+
+	first := ScorePlayer(session, 1)
+	assert.Equal(t, 2, first.Penalties, "submissions after the first accept are free")
+	assert.Equal(t, int64(600), first.PenaltyTime)
+	assert.Equal(t, int64(780), first.AdjustedTime)
+	assert.Equal(t, int64(3), first.SubmissionID)
+
+	second := ScorePlayer(session, 2)
+	assert.Equal(t, 0, second.Penalties)
+	assert.Equal(t, int64(600), second.AdjustedTime)
+
+	unsolved := ScorePlayer(session, 3)
+	assert.Equal(t, 1, unsolved.Penalties)
+	assert.Nil(t, unsolved.SubmittedAt)
+
+	assert.Positive(t, compareScores(models.ScoringPenalty, first, second), "lowest adjusted time ranks first")
+	assert.Negative(t, compareScores(models.ScoringPenalty, first, unsolved), "solving beats not solving")
+}
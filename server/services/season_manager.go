@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"leetcodeduels/config"
+	"leetcodeduels/store"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+var SeasonManager *seasonManager
+
+type seasonManager struct {
+	client *redis.Client
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+const (
+	seasonLockKey = "season:lock" // Held while a node is starting or archiving seasons
+	seasonLockTTL = 30 * time.Second
+
+	seasonCheckInterval = time.Minute
+)
+
+// Connects to Redis and starts checking for season boundaries in the background.
+func InitSeasonManager(redisURL string) error {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return fmt.Errorf("invalid redis URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return fmt.Errorf("redis ping failed: %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	SeasonManager = &seasonManager{
+		client: client,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	go SeasonManager.run()
+	return nil
+}
+
+func (sm *seasonManager) run() {
+	ticker := time.NewTicker(seasonCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := sm.processSeasons(time.Now()); err != nil {
+			log.Error().Err(err).Msg("Season check failed")
+		}
+		select {
+		case <-sm.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Archives every season that has ended, then resets ratings for any season that has begun.
+// Archiving first means a season's standings never include the next season's reset.
+func (sm *seasonManager) processSeasons(now time.Time) error {
+	release, err := acquireLock(sm.ctx, sm.client, seasonLockKey, seasonLockTTL)
+	if err != nil {
+		return err
+	}
+	if release == nil {
+		return nil // Another node is handling it
+	}
+	defer release()
+
+	ended, err := store.DataStore.GetSeasonsToArchive(now)
+	if err != nil {
+		return err
+	}
+	for _, season := range ended {
+		if err := store.DataStore.ArchiveSeason(season.ID); err != nil {
+			return err
+		}
+		log.Info().Int("season_id", season.ID).Str("name", season.Name).Msg("Season archived")
+	}
+
+	started, err := store.DataStore.GetSeasonsToStart(now)
+	if err != nil {
+		return err
+	}
+	for _, season := range started {
+		reset, err := store.DataStore.StartSeason(season.ID, config.GetConfig().SEASON_RESET_PERCENT,
+			config.GetConfig().PLACEMENT_GAMES)
+		if err != nil {
+			return err
+		}
+		if !reset {
+			continue
+		}
+		log.Info().Int("season_id", season.ID).Str("name", season.Name).Msg("Season started, ratings reset")
+		if err := Leaderboard.Rebuild(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sm *seasonManager) Close() error {
+	sm.cancel()
+	return sm.client.Close()
+}
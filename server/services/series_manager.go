@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"leetcodeduels/models"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+var SeriesManager *seriesManager
+
+type seriesManager struct {
+	client *redis.Client
+	ctx    context.Context
+}
+
+type seriesState struct {
+	ID        string `redis:"id"`
+	Players   string `redis:"players"`
+	Target    int    `redis:"target"`
+	Details   string `redis:"details"`
+	StartTime string `redis:"startTime"`
+}
+
+const (
+	seriesKeyPrefix   = "series:"      // Hash containing series metadata and each player's wins
+	seriesWinsPrefix  = "wins:"        // Hash field prefix counting a player's wins
+	seriesGamesSuffix = ":sessions"    // List of sessionIDs played in the series
+	seriesTTL         = 24 * time.Hour // Abandoned series are forgotten after a day without games
+
+	MaxSeriesTarget = 7
+)
+
+func seriesKey(seriesID string) string {
+	return seriesKeyPrefix + seriesID
+}
+func seriesGamesKey(seriesID string) string {
+	return seriesKeyPrefix + seriesID + seriesGamesSuffix
+}
+func seriesWinsField(playerID int64) string {
+	return seriesWinsPrefix + strconv.FormatInt(playerID, 10)
+}
+
+func InitSeriesManager(redisURL string) error {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return fmt.Errorf("invalid redis URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return fmt.Errorf("redis ping failed: %w", err)
+	}
+	SeriesManager = &seriesManager{
+		client: client,
+		ctx:    context.Background(),
+	}
+	return nil
+}
+
+// Creates a series between the players and returns its ID. Games are started separately.
+func (sm *seriesManager) StartSeries(players []int64, details models.MatchDetails) (string, error) {
+	seriesID := uuid.NewString()
+	key := seriesKey(seriesID)
+
+	playersData, err := json.Marshal(players)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal players: %w", err)
+	}
+	detailsData, err := json.Marshal(details)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal match details: %w", err)
+	}
+
+	seriesMap := map[string]interface{}{
+		"id":        seriesID,
+		"players":   string(playersData),
+		"target":    details.SeriesTarget,
+		"details":   string(detailsData),
+		"startTime": time.Now().Format(time.RFC3339Nano),
+	}
+	for _, pid := range players {
+		seriesMap[seriesWinsField(pid)] = 0
+	}
+
+	pipe := sm.client.TxPipeline()
+	pipe.HSet(sm.ctx, key, seriesMap)
+	pipe.Expire(sm.ctx, key, seriesTTL)
+	if _, err := pipe.Exec(sm.ctx); err != nil {
+		return "", fmt.Errorf("failed to store series hash: %w", err)
+	}
+	return seriesID, nil
+}
+
+// Returns the series for the given ID (or nil if not found)
+func (sm *seriesManager) GetSeries(seriesID string) (*models.Series, error) {
+	series, _, err := sm.load(seriesID)
+	return series, err
+}
+
+// Returns the details every game of the series is played with.
+func (sm *seriesManager) MatchDetails(seriesID string) (*models.MatchDetails, error) {
+	_, details, err := sm.load(seriesID)
+	return details, err
+}
+
+// Adds a finished session to the series and credits its winner, if any.
+// The returned series has its Winner set once someone has reached the target.
+func (sm *seriesManager) RecordGame(seriesID string, session *models.Session) (*models.Series, error) {
+	key := seriesKey(seriesID)
+	gamesKey := seriesGamesKey(seriesID)
+
+	pipe := sm.client.TxPipeline()
+	pipe.RPush(sm.ctx, gamesKey, session.ID)
+	if session.Winner > 0 {
+		pipe.HIncrBy(sm.ctx, key, seriesWinsField(session.Winner), 1)
+	}
+	pipe.Expire(sm.ctx, key, seriesTTL)
+	pipe.Expire(sm.ctx, gamesKey, seriesTTL)
+	if _, err := pipe.Exec(sm.ctx); err != nil {
+		return nil, fmt.Errorf("failed to record series game: %w", err)
+	}
+
+	series, err := sm.GetSeries(seriesID)
+	if err != nil || series == nil {
+		return series, err
+	}
+	for _, score := range series.Scores {
+		if score.Wins >= series.Target {
+			series.Winner = score.PlayerID
+			series.EndTime = session.EndTime
+		}
+	}
+	return series, nil
+}
+
+// Forgets a series once it has been stored.
+func (sm *seriesManager) EndSeries(seriesID string) error {
+	return sm.client.Del(sm.ctx, seriesKey(seriesID), seriesGamesKey(seriesID)).Err()
+}
+
+func (sm *seriesManager) Close() error {
+	return sm.client.Close()
+}
+
+func (sm *seriesManager) load(seriesID string) (*models.Series, *models.MatchDetails, error) {
+	res := sm.client.HGetAll(sm.ctx, seriesKey(seriesID))
+	var state seriesState
+	if err := res.Scan(&state); err != nil {
+		return nil, nil, fmt.Errorf("redis hgetall/scan failed: %w", err)
+	}
+	if state.ID == "" {
+		return nil, nil, nil // Not found
+	}
+
+	series := models.Series{ID: state.ID, Target: state.Target}
+	series.StartTime, _ = time.Parse(time.RFC3339Nano, state.StartTime)
+
+	if err := json.Unmarshal([]byte(state.Players), &series.Players); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal players: %w", err)
+	}
+	var details models.MatchDetails
+	if err := json.Unmarshal([]byte(state.Details), &details); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal match details: %w", err)
+	}
+	series.IsRated = details.IsRated
+
+	for _, pid := range series.Players {
+		wins, _ := strconv.Atoi(res.Val()[seriesWinsField(pid)])
+		series.Scores = append(series.Scores, models.SeriesScore{PlayerID: pid, Wins: wins})
+	}
+
+	var err error
+	series.MatchIDs, err = sm.client.LRange(sm.ctx, seriesGamesKey(seriesID), 0, -1).Result()
+	if err != nil && err != redis.Nil {
+		return nil, nil, fmt.Errorf("redis lrange failed: %w", err)
+	}
+	return &series, &details, nil
+}
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"leetcodeduels/models"
+	"leetcodeduels/store"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+var TournamentManager *tournamentManager
+
+// Starts a session for a tournament match between its two players and returns the session's ID.
+type TournamentMatchStarter func(t *models.Tournament, match models.TournamentMatch) (string, error)
+
+type tournamentManager struct {
+	client     *redis.Client
+	ctx        context.Context
+	cancel     context.CancelFunc
+	startMatch TournamentMatchStarter
+}
+
+const (
+	tournamentLockPrefix = "tournament:lock:" // Held while a node updates a tournament's bracket
+	tournamentLockTTL    = 30 * time.Second
+	tournamentLockWait   = 10 * time.Second // How long to wait for another node to finish updating
+
+	tournamentCheckInterval = time.Minute // How often matches that failed to start are retried
+
+	MinTournamentPlayers = 2
+	MaxTournamentPlayers = 64
+)
+
+var (
+	ErrTournamentStarted = errors.New("tournament has already started")
+	ErrTooFewPlayers     = fmt.Errorf("a tournament needs at least %d players", MinTournamentPlayers)
+)
+
+func tournamentLockKey(tournamentID int) string {
+	return tournamentLockPrefix + strconv.Itoa(tournamentID)
+}
+
+// Connects to Redis and starts retrying tournament matches that failed to start in the background.
+func InitTournamentManager(redisURL string) error {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return fmt.Errorf("invalid redis URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return fmt.Errorf("redis ping failed: %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	TournamentManager = &tournamentManager{
+		client: client,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	go TournamentManager.run()
+	return nil
+}
+
+// Sets how sessions are started for matches once both of their players are known.
+func (tm *tournamentManager) SetMatchStarter(start TournamentMatchStarter) {
+	tm.startMatch = start
+}
+
+// Closes registration, seeds the players by rating and starts every first round match that
+// isn't a bye.
+func (tm *tournamentManager) StartTournament(tournamentID int) (*models.Tournament, error) {
+	release, err := tm.lock(tournamentID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	t, err := store.DataStore.GetTournament(tournamentID)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, store.ErrTournamentNotFound
+	}
+	if t.Status != models.TournamentRegistration {
+		return nil, ErrTournamentStarted
+	}
+	if len(t.Players) < MinTournamentPlayers {
+		return nil, ErrTooFewPlayers
+	}
+
+	closed, err := store.DataStore.CloseTournamentRegistration(tournamentID)
+	if err != nil {
+		return nil, err
+	}
+	if !closed {
+		return nil, ErrTournamentStarted
+	}
+	// Players can register right up until registration closes, so reload them
+	if t, err = store.DataStore.GetTournament(tournamentID); err != nil {
+		return nil, err
+	}
+
+	seedPlayers(t.Players)
+	seeded := make([]int64, len(t.Players))
+	for i, p := range t.Players {
+		seeded[i] = p.UserID
+	}
+	t.Matches = generateBracket(t.Format, seeded)
+
+	if err := tm.advance(t); err != nil {
+		return nil, err
+	}
+	log.Info().Int("tournament_id", t.ID).Int("players", len(t.Players)).Int("matches", len(t.Matches)).Msg("Tournament started")
+	return t, nil
+}
+
+// Moves the winner of a finished tournament session on in the bracket and starts any matches
+// that are now ready. A drawn match is replayed with a new session. Returns nil if the session
+// no longer decides its match.
+func (tm *tournamentManager) RecordResult(session *models.Session) (*models.Tournament, error) {
+	link := session.Tournament
+	release, err := tm.lock(link.TournamentID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	t, err := store.DataStore.GetTournament(link.TournamentID)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil || link.Match < 1 || link.Match > len(t.Matches) {
+		return nil, nil
+	}
+	match := &t.Matches[link.Match-1]
+	if match.Decided || match.SessionID != session.ID {
+		return nil, nil
+	}
+
+	match.SessionID = ""
+	if session.Winner > 0 {
+		decideMatch(t.Matches, match.Number, session.Winner)
+	}
+	if err := tm.advance(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Starts sessions for the matches that are ready, ends the tournament once the final is decided,
+// and saves the bracket.
+func (tm *tournamentManager) advance(t *models.Tournament) error {
+	for _, number := range resolveBracket(t.Matches) {
+		match := &t.Matches[number-1]
+		sessionID, err := tm.startMatch(t, *match)
+		if err != nil {
+			// The match stays ready without a session so that the next result or check retries it
+			log.Error().Err(err).Int("tournament_id", t.ID).Int("match", number).Msg("Failed to start tournament match")
+			continue
+		}
+		match.SessionID = sessionID
+	}
+
+	if winner, finished := bracketWinner(t.Matches); finished {
+		now := time.Now()
+		t.Status = models.TournamentFinished
+		t.Winner = winner
+		t.EndTime = &now
+		log.Info().Int("tournament_id", t.ID).Int64("winner_id", winner).Msg("Tournament finished")
+	}
+	return store.DataStore.SaveTournamentBracket(t)
+}
+
+func (tm *tournamentManager) run() {
+	ticker := time.NewTicker(tournamentCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-tm.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// Sessions can't be started until the connection manager has set how
+		if tm.startMatch == nil {
+			continue
+		}
+		ids, err := store.DataStore.GetStalledTournaments()
+		if err != nil {
+			log.Error().Err(err).Msg("Tournament check failed")
+		}
+		for _, id := range ids {
+			if err := tm.retryMatches(id); err != nil {
+				log.Error().Err(err).Int("tournament_id", id).Msg("Failed to retry tournament matches")
+			}
+		}
+	}
+}
+
+// Starts the ready matches of a tournament that have no session because starting one failed,
+// so that the tournament doesn't wait on them forever.
+func (tm *tournamentManager) retryMatches(tournamentID int) error {
+	release, err := tm.lock(tournamentID)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// A result on another node may have started them while this one waited for the lock
+	t, err := store.DataStore.GetTournament(tournamentID)
+	if err != nil {
+		return err
+	}
+	if t == nil || t.Status != models.TournamentInProgress || len(resolveBracket(t.Matches)) == 0 {
+		return nil
+	}
+	log.Info().Int("tournament_id", t.ID).Msg("Retrying tournament matches")
+	return tm.advance(t)
+}
+
+// Waits for the tournament's lock so that results finishing at once on different nodes are
+// applied one after the other.
+func (tm *tournamentManager) lock(tournamentID int) (func(), error) {
+	return waitForLock(tm.ctx, tm.client, tournamentLockKey(tournamentID), tournamentLockTTL, tournamentLockWait)
+}
+
+func (tm *tournamentManager) Close() error {
+	tm.cancel()
+	return tm.client.Close()
+}
@@ -39,3 +39,11 @@ func GenerateUniqueDiscriminator_AlphaNumeric(username string) (string, error) {
 	}
 	return "", errors.New("could not generate a unique discriminator for provided username")
 }
+
+// Sets a user's rating and moves them on the leaderboard to match.
+func UpdateUserRating(userID int64, rating int) error {
+	if err := store.DataStore.UpdateUserRating(userID, rating); err != nil {
+		return err
+	}
+	return Leaderboard.Sync(userID)
+}
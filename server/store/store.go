@@ -2,8 +2,11 @@ package store
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"leetcodeduels/models"
+	"slices"
 	"strings"
 	"time"
 
@@ -13,6 +16,16 @@ import (
 
 var DataStore *dataStore
 
+var (
+	ErrMatchNotFound        = errors.New("match not found")
+	ErrMatchAlreadyReverted = errors.New("match has already been reverted")
+	ErrTournamentNotFound   = errors.New("tournament not found")
+	ErrTournamentNotOpen    = errors.New("tournament is not open for registration")
+	ErrAlreadyRegistered    = errors.New("user is already registered")
+	ErrLeagueNotFound       = errors.New("league not found")
+	ErrLeagueNotOpen        = errors.New("league is not open for registration")
+)
+
 type dataStore struct {
 	db *sql.DB
 }
@@ -53,13 +66,14 @@ func (ds *dataStore) UpdateGithubAccessToken(githubID int64, newToken string) er
 // Return the full user record by GitHub ID, or nil if not found.
 func (ds *dataStore) GetUserProfile(githubID int64) (*models.User, error) {
 	query := `SELECT id, access_token, 	username, discriminator, 
-			lc_username, avatar_url, created_at, updated_at, rating
+			lc_username, avatar_url, created_at, updated_at, rating,
+			rating_deviation, volatility, last_rated_at, games_played
 			FROM users WHERE id = $1`
 	row := ds.db.QueryRow(query, githubID)
 	var u models.User
 	err := row.Scan(&u.ID, &u.AccessToken, &u.Username, &u.Discriminator,
 		&u.LeetCodeUsername, &u.AvatarURL, &u.CreatedAt,
-		&u.UpdatedAt, &u.Rating)
+		&u.UpdatedAt, &u.Rating, &u.RatingDeviation, &u.Volatility, &u.LastRatedAt, &u.GamesPlayed)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -85,13 +99,14 @@ func (ds *dataStore) GetLCUsername(userID int64) (string, error) {
 // Retrieves the full user record by username + discriminator, or nil if not found.
 func (ds *dataStore) GetUserProfileByUsername(username string, discriminator string) (*models.User, error) {
 	query := `SELECT id, access_token, 	username, discriminator,
-			lc_username, avatar_url, created_at, updated_at, rating
+			lc_username, avatar_url, created_at, updated_at, rating,
+			rating_deviation, volatility, last_rated_at, games_played
 			FROM users WHERE username = $1 AND discriminator = $2`
 	row := ds.db.QueryRow(query, username, discriminator)
 	var u models.User
 	err := row.Scan(&u.ID, &u.AccessToken, &u.Username, &u.Discriminator,
 		&u.LeetCodeUsername, &u.AvatarURL, &u.CreatedAt,
-		&u.UpdatedAt, &u.Rating)
+		&u.UpdatedAt, &u.Rating, &u.RatingDeviation, &u.Volatility, &u.LastRatedAt, &u.GamesPlayed)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -102,8 +117,9 @@ func (ds *dataStore) GetUserProfileByUsername(username string, discriminator str
 }
 
 // Returns a list of users whose usernames contain the given substring, limited to 'limit' results.
-func (ds *dataStore) SearchUsersByUsername(username string, limit int) ([]models.UserInfoResponse, error) {
-	query := `SELECT id, username, discriminator, lc_username, avatar_url, rating
+func (ds *dataStore) SearchUsersByUsername(username string, limit int) ([]models.User, error) {
+	query := `SELECT id, username, discriminator, lc_username, avatar_url, rating,
+			rating_deviation, volatility, last_rated_at, games_played
 			FROM users WHERE username ILIKE $1 LIMIT $2`
 
 	// Only match usernames that start with given substring
@@ -113,11 +129,12 @@ func (ds *dataStore) SearchUsersByUsername(username string, limit int) ([]models
 	}
 	defer rows.Close()
 
-	var users []models.UserInfoResponse
+	var users []models.User
 	for rows.Next() {
-		var u models.UserInfoResponse
+		var u models.User
 		if err := rows.Scan(&u.ID, &u.Username, &u.Discriminator,
-			&u.LCUsername, &u.AvatarURL, &u.Rating); err != nil {
+			&u.LeetCodeUsername, &u.AvatarURL, &u.Rating,
+			&u.RatingDeviation, &u.Volatility, &u.LastRatedAt, &u.GamesPlayed); err != nil {
 			return nil, fmt.Errorf("SearchUsersByUsername: %w", err)
 		}
 		users = append(users, u)
@@ -136,6 +153,53 @@ func (ds *dataStore) GetUserRating(userID int64) (int, error) {
 	return rating, nil
 }
 
+// GetPlayerRating fetches the rating state used to rate a user's next match.
+func (ds *dataStore) GetPlayerRating(userID int64) (*models.PlayerRating, error) {
+	r := models.PlayerRating{PlayerID: userID}
+	query := `SELECT rating, rating_deviation, volatility, last_rated_at, games_played
+			FROM users WHERE id = $1`
+	err := ds.db.QueryRow(query, userID).Scan(&r.Rating, &r.Deviation, &r.Volatility,
+		&r.LastRatedAt, &r.GamesPlayed)
+	if err != nil {
+		return nil, fmt.Errorf("GetPlayerRating: %w", err)
+	}
+	return &r, nil
+}
+
+// Returns a user's rating history in chronological order. A zero from or to leaves
+// that end of the range open.
+func (ds *dataStore) GetRatingHistory(userID int64, from, to time.Time) ([]models.RatingHistoryEntry, error) {
+	query := `SELECT reason, COALESCE(match_id::text, ''), COALESCE(season_id, 0), old_rating, new_rating,
+			COALESCE(opponent_rating, 0), created_at
+			FROM rating_history WHERE user_id = $1`
+	args := []interface{}{userID}
+	if !from.IsZero() {
+		args = append(args, from)
+		query += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+	if !to.IsZero() {
+		args = append(args, to)
+		query += fmt.Sprintf(" AND created_at <= $%d", len(args))
+	}
+	query += " ORDER BY created_at ASC"
+
+	rows, err := ds.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("GetRatingHistory: %w", err)
+	}
+	defer rows.Close()
+
+	history := []models.RatingHistoryEntry{}
+	for rows.Next() {
+		var e models.RatingHistoryEntry
+		if err := rows.Scan(&e.Reason, &e.MatchID, &e.SeasonID, &e.OldRating, &e.NewRating, &e.OpponentRating, &e.Time); err != nil {
+			return nil, fmt.Errorf("GetRatingHistory scan: %w", err)
+		}
+		history = append(history, e)
+	}
+	return history, nil
+}
+
 // Checks if a given username + discriminator combo exists.
 func (ds *dataStore) DiscriminatorExists(username string, discriminator string) (bool, error) {
 	var exists bool
@@ -208,7 +272,7 @@ func (ds *dataStore) UpdateLCUsername(userID int64, newLCUsername string) error
 	return nil
 }
 
-// Sets a user's rating to a new value.
+// Sets a user's rating to a new value. Use services.UpdateUserRating so the leaderboard follows.
 func (ds *dataStore) UpdateUserRating(userID int64, newRating int) error {
 	query := `UPDATE users SET rating = $1 WHERE id = $2`
 	_, err := ds.db.Exec(query, newRating, userID)
@@ -229,6 +293,196 @@ func (ds *dataStore) DeleteUser(userID int64) error {
 	return nil
 }
 
+// Returns the current rating of every user with at least minGames rated matches, keyed by user ID.
+func (ds *dataStore) GetAllUserRatings(minGames int) (map[int64]int, error) {
+	rows, err := ds.db.Query(`SELECT id, rating FROM users WHERE games_played >= $1`, minGames)
+	if err != nil {
+		return nil, fmt.Errorf("GetAllUserRatings: %w", err)
+	}
+	defer rows.Close()
+
+	ratings := make(map[int64]int)
+	for rows.Next() {
+		var id int64
+		var rating int
+		if err := rows.Scan(&id, &rating); err != nil {
+			return nil, fmt.Errorf("GetAllUserRatings scan: %w", err)
+		}
+		ratings[id] = rating
+	}
+	return ratings, nil
+}
+
+// Returns the users with the given IDs. Missing users are skipped.
+func (ds *dataStore) GetUsersByIDs(ids []int64) ([]models.User, error) {
+	query := `SELECT id, username, discriminator, lc_username, avatar_url, rating,
+			rating_deviation, volatility, last_rated_at, games_played
+			FROM users WHERE id = ANY($1)`
+	rows, err := ds.db.Query(query, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("GetUsersByIDs: %w", err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.ID, &u.Username, &u.Discriminator,
+			&u.LeetCodeUsername, &u.AvatarURL, &u.Rating,
+			&u.RatingDeviation, &u.Volatility, &u.LastRatedAt, &u.GamesPlayed); err != nil {
+			return nil, fmt.Errorf("GetUsersByIDs scan: %w", err)
+		}
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+// Ranks the users that pass a leaderboard filter. Expects $1 = minimum rated games
+// and $2 = earliest last match time (NULL for any).
+const filteredLeaderboardQuery = `
+	WITH stats AS (
+		SELECT u.id, u.rating, u.games_played AS games, MAX(m.end_time) AS last_played
+		FROM users u
+		LEFT JOIN match_players mp ON mp.player_id = u.id
+		LEFT JOIN matches m ON m.id = mp.match_id
+		GROUP BY u.id, u.rating, u.games_played
+	)
+	SELECT id, rating, RANK() OVER (ORDER BY rating DESC) AS rank, COUNT(*) OVER () AS total
+	FROM stats
+	WHERE games >= $1 AND ($2::timestamptz IS NULL OR last_played >= $2)`
+
+func leaderboardFilterArgs(filter models.LeaderboardFilter) []interface{} {
+	activeSince := sql.NullTime{Time: filter.ActiveSince, Valid: !filter.ActiveSince.IsZero()}
+	return []interface{}{filter.MinGames, activeSince}
+}
+
+// Returns one page of the filtered leaderboard and the number of users that pass the filter.
+func (ds *dataStore) GetLeaderboardPage(filter models.LeaderboardFilter, offset, limit int) ([]models.RankedUser, int, error) {
+	query := `SELECT id, rating, rank, total FROM (` + filteredLeaderboardQuery + `) ranked
+			ORDER BY rank, id LIMIT $3 OFFSET $4`
+	args := append(leaderboardFilterArgs(filter), limit, offset)
+	rows, err := ds.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("GetLeaderboardPage: %w", err)
+	}
+	defer rows.Close()
+
+	ranked := []models.RankedUser{}
+	total := 0
+	for rows.Next() {
+		var r models.RankedUser
+		if err := rows.Scan(&r.UserID, &r.Rating, &r.Rank, &total); err != nil {
+			return nil, 0, fmt.Errorf("GetLeaderboardPage scan: %w", err)
+		}
+		ranked = append(ranked, r)
+	}
+
+	// An empty page past the end still needs the total
+	if len(ranked) == 0 && offset > 0 {
+		countQuery := `SELECT COUNT(*) FROM (` + filteredLeaderboardQuery + `) ranked`
+		if err := ds.db.QueryRow(countQuery, leaderboardFilterArgs(filter)...).Scan(&total); err != nil {
+			return nil, 0, fmt.Errorf("GetLeaderboardPage count: %w", err)
+		}
+	}
+	return ranked, total, nil
+}
+
+// Returns a user's rank on the filtered leaderboard, or false if they do not pass the filter.
+func (ds *dataStore) GetLeaderboardRank(filter models.LeaderboardFilter, userID int64) (int, bool, error) {
+	query := `SELECT rank FROM (` + filteredLeaderboardQuery + `) ranked WHERE id = $3`
+	var rank int
+	err := ds.db.QueryRow(query, append(leaderboardFilterArgs(filter), userID)...).Scan(&rank)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("GetLeaderboardRank: %w", err)
+	}
+	return rank, true, nil
+}
+
+// Returns the stored difficulty rating of each given user. Users without one are omitted.
+func (ds *dataStore) GetDifficultyRatings(userIDs []int64, difficulty models.Difficulty) (map[int64]int, error) {
+	query := `SELECT user_id, rating FROM user_difficulty_ratings
+			WHERE user_id = ANY($1) AND difficulty = $2`
+	rows, err := ds.db.Query(query, pq.Array(userIDs), difficulty)
+	if err != nil {
+		return nil, fmt.Errorf("GetDifficultyRatings: %w", err)
+	}
+	defer rows.Close()
+
+	ratings := make(map[int64]int)
+	for rows.Next() {
+		var id int64
+		var rating int
+		if err := rows.Scan(&id, &rating); err != nil {
+			return nil, fmt.Errorf("GetDifficultyRatings scan: %w", err)
+		}
+		ratings[id] = rating
+	}
+	return ratings, nil
+}
+
+// Returns the stored rating of each given user on a tag. Users without one are omitted.
+func (ds *dataStore) GetTagRatings(userIDs []int64, tagID int) (map[int64]int, error) {
+	query := `SELECT user_id, rating FROM user_tag_ratings
+			WHERE user_id = ANY($1) AND tag_id = $2`
+	rows, err := ds.db.Query(query, pq.Array(userIDs), tagID)
+	if err != nil {
+		return nil, fmt.Errorf("GetTagRatings: %w", err)
+	}
+	defer rows.Close()
+
+	ratings := make(map[int64]int)
+	for rows.Next() {
+		var id int64
+		var rating int
+		if err := rows.Scan(&id, &rating); err != nil {
+			return nil, fmt.Errorf("GetTagRatings scan: %w", err)
+		}
+		ratings[id] = rating
+	}
+	return ratings, nil
+}
+
+// Returns every difficulty and tag rating a user has earned.
+func (ds *dataStore) GetSkillRatings(userID int64) (*models.SkillRatings, error) {
+	skills := models.SkillRatings{
+		Difficulties: []models.DifficultyRating{},
+		Tags:         []models.TagRating{},
+	}
+
+	rows, err := ds.db.Query(`SELECT difficulty, rating FROM user_difficulty_ratings
+			WHERE user_id = $1 ORDER BY difficulty`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("GetSkillRatings difficulties: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d models.DifficultyRating
+		if err := rows.Scan(&d.Difficulty, &d.Rating); err != nil {
+			return nil, fmt.Errorf("GetSkillRatings difficulties scan: %w", err)
+		}
+		skills.Difficulties = append(skills.Difficulties, d)
+	}
+
+	tagRows, err := ds.db.Query(`SELECT r.tag_id, t.name, r.rating FROM user_tag_ratings r
+			JOIN tags t ON t.id = r.tag_id
+			WHERE r.user_id = $1 ORDER BY r.rating DESC, t.name`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("GetSkillRatings tags: %w", err)
+	}
+	defer tagRows.Close()
+	for tagRows.Next() {
+		var t models.TagRating
+		if err := tagRows.Scan(&t.TagID, &t.TagName, &t.Rating); err != nil {
+			return nil, fmt.Errorf("GetSkillRatings tags scan: %w", err)
+		}
+		skills.Tags = append(skills.Tags, t)
+	}
+	return &skills, nil
+}
+
 // Returns a list of users whose usernames start with the given prefix, limited to 'limit' results.
 func (ds *dataStore) GetMatchingUsers(username string, limit int) ([]models.User, error) {
 	query := `SELECT id, username, discriminator, lc_username, avatar_url, rating, created_at
@@ -449,7 +703,11 @@ func (ds *dataStore) GetRandomProblemByTagsAndDifficulties(
 	return &p, nil
 }
 
-// Stores a new match record in the database.
+// Stores a new match record in the database, along with any rating changes it caused. Ratings
+// move by each change rather than being overwritten, so a season reset, revert or other match
+// stored since the changes were calculated isn't lost. OldRating and NewRating are updated to
+// the ratings actually stored. Everything the match changed is recorded in the rating history
+// so RevertMatch can undo it.
 func (ds *dataStore) StoreMatch(match *models.Session) error {
 	tx, err := ds.db.Begin()
 	if err != nil {
@@ -457,44 +715,160 @@ func (ds *dataStore) StoreMatch(match *models.Session) error {
 	}
 	defer tx.Rollback()
 
+	// Matches belong to the season that was running when they ended
 	matchQuery := `
-    INSERT INTO matches (id, problem_id, is_rated, status, winner_id, start_time, end_time)
-    VALUES ($1, $2, $3, $4, $5, $6, $7)`
-
+    INSERT INTO matches (id, problem_id, is_rated, status, winner_id, start_time, end_time, scoring_mode, optimize_for,
+        languages, tournament_id, tournament_match, league_id, league_fixture, season_id)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14,
+        (SELECT id FROM seasons WHERE start_time <= $7 AND end_time > $7 ORDER BY start_time DESC LIMIT 1))`
+
+	var winner sql.NullInt64 // Draws and canceled matches have no winner
+	if match.Winner > 0 {
+		winner = sql.NullInt64{Int64: match.Winner, Valid: true}
+	}
+	optimizeFor := sql.NullString{String: string(match.OptimizeFor), Valid: match.OptimizeFor != ""}
+	var languages pq.StringArray // NULL unless the match was restricted
+	for _, lang := range match.Languages {
+		languages = append(languages, string(lang))
+	}
+	var tournamentID, tournamentMatch sql.NullInt64
+	if match.Tournament != nil {
+		tournamentID = sql.NullInt64{Int64: int64(match.Tournament.TournamentID), Valid: true}
+		tournamentMatch = sql.NullInt64{Int64: int64(match.Tournament.Match), Valid: true}
+	}
+	var leagueID, leagueFixture sql.NullInt64
+	if match.League != nil {
+		leagueID = sql.NullInt64{Int64: int64(match.League.LeagueID), Valid: true}
+		leagueFixture = sql.NullInt64{Int64: int64(match.League.Fixture), Valid: true}
+	}
 	_, err = tx.Exec(matchQuery, match.ID, match.Problem.ID, match.IsRated,
-		match.Status, match.Winner, match.StartTime, match.EndTime)
+		match.Status, winner, match.StartTime, match.EndTime, match.ScoringMode, optimizeFor, languages,
+		tournamentID, tournamentMatch, leagueID, leagueFixture)
 	if err != nil {
 		return fmt.Errorf("StoreMatch: failed to insert match: %w", err)
 	}
 
 	if len(match.Players) > 0 {
-		playerQuery := `INSERT INTO match_players (match_id, player_id) VALUES ($1, $2)`
+		playerQuery := `INSERT INTO match_players (match_id, player_id, placement, score, problems_solved)
+			VALUES ($1, $2, $3, $4, $5)`
 		for _, playerID := range match.Players {
-			_, err = tx.Exec(playerQuery, match.ID, playerID)
+			var placement sql.NullInt64 // Unplaced when the match was canceled
+			if i := slices.Index(match.Placements, playerID); i >= 0 {
+				placement = sql.NullInt64{Int64: int64(i + 1), Valid: true}
+			}
+			var score []byte // Only scored modes have a breakdown
+			if i := slices.IndexFunc(match.Scores, func(s models.PlayerScore) bool { return s.PlayerID == playerID }); i >= 0 {
+				if score, err = json.Marshal(match.Scores[i]); err != nil {
+					return fmt.Errorf("StoreMatch: failed to marshal score for player %d: %w", playerID, err)
+				}
+			}
+			var solved sql.NullInt64 // Only relays track progress
+			if i := slices.IndexFunc(match.Progress, func(p models.RelayProgress) bool { return p.PlayerID == playerID }); i >= 0 {
+				solved = sql.NullInt64{Int64: int64(match.Progress[i].Solved), Valid: true}
+			}
+			_, err = tx.Exec(playerQuery, match.ID, playerID, placement, score, solved)
 			if err != nil {
 				return fmt.Errorf("StoreMatch: failed to insert player %d: %w", playerID, err)
 			}
 		}
 	}
 
+	if len(match.Problems) > 0 {
+		problemQuery := `INSERT INTO match_problems (match_id, position, problem_id) VALUES ($1, $2, $3)`
+		for i, problem := range match.Problems {
+			_, err = tx.Exec(problemQuery, match.ID, i+1, problem.ID)
+			if err != nil {
+				return fmt.Errorf("StoreMatch: failed to insert problem %d: %w", problem.ID, err)
+			}
+		}
+	}
+
 	if len(match.Submissions) > 0 {
 		submissionQuery := `
 		INSERT INTO submissions (match_id, submission_id, player_id, passed_test_cases, 
 			total_test_cases, status, runtime, runtime_percentile, memory, 
-			memory_percentile, lang, submitted_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+			memory_percentile, lang, submitted_at, problem_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`
 
 		for _, sub := range match.Submissions {
+			problemID := sql.NullInt64{Int64: int64(sub.ProblemID), Valid: sub.ProblemID != 0}
 			_, err = tx.Exec(submissionQuery, match.ID, sub.ID, sub.PlayerID,
 				sub.PassedTestCases, sub.TotalTestCases, sub.Status,
 				sub.Runtime, sub.RuntimePercentile, sub.Memory,
-				sub.MemoryPercentile, sub.Lang, sub.Time)
+				sub.MemoryPercentile, sub.Lang, sub.Time, problemID)
 			if err != nil {
 				return fmt.Errorf("StoreMatch: failed to insert submission %d: %w", sub.ID, err)
 			}
 		}
 	}
 
+	if len(match.RatingChanges) > 0 {
+		prevQuery := `SELECT rating_deviation, volatility, last_rated_at FROM users WHERE id = $1 FOR UPDATE`
+		ratingQuery := `UPDATE users SET rating = rating + $1, rating_deviation = $2, volatility = $3,
+			last_rated_at = $4, games_played = games_played + 1 WHERE id = $5 RETURNING rating`
+		historyQuery := `
+		INSERT INTO rating_history (user_id, match_id, old_rating, new_rating, opponent_rating, created_at,
+			old_deviation, new_deviation, old_volatility, new_volatility, old_last_rated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+		for i, change := range match.RatingChanges {
+			var deviation, volatility float64
+			var lastRatedAt sql.NullTime
+			err = tx.QueryRow(prevQuery, change.PlayerID).Scan(&deviation, &volatility, &lastRatedAt)
+			if err != nil {
+				return fmt.Errorf("StoreMatch: failed to lock rating for player %d: %w", change.PlayerID, err)
+			}
+			var rating int
+			err = tx.QueryRow(ratingQuery, change.Change, change.Deviation, change.Volatility,
+				match.EndTime, change.PlayerID).Scan(&rating)
+			if err != nil {
+				return fmt.Errorf("StoreMatch: failed to update rating for player %d: %w", change.PlayerID, err)
+			}
+			match.RatingChanges[i].OldRating = rating - change.Change
+			match.RatingChanges[i].NewRating = rating
+
+			_, err = tx.Exec(historyQuery, change.PlayerID, match.ID, rating-change.Change, rating,
+				change.OpponentRating, match.EndTime, deviation, change.Deviation, volatility,
+				change.Volatility, lastRatedAt)
+			if err != nil {
+				return fmt.Errorf("StoreMatch: failed to record rating history for player %d: %w", change.PlayerID, err)
+			}
+		}
+	}
+
+	if len(match.SkillChanges) > 0 {
+		difficultyQuery := `
+		INSERT INTO user_difficulty_ratings (user_id, difficulty, rating) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, difficulty) DO UPDATE SET rating = user_difficulty_ratings.rating + $4
+		RETURNING rating`
+		tagQuery := `
+		INSERT INTO user_tag_ratings (user_id, tag_id, rating) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, tag_id) DO UPDATE SET rating = user_tag_ratings.rating + $4
+		RETURNING rating`
+		historyQuery := `
+		INSERT INTO skill_rating_history (user_id, match_id, difficulty, tag_id, old_rating, new_rating)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+
+		for _, change := range match.SkillChanges {
+			delta := change.NewRating - change.OldRating
+			var rating int
+			difficulty := sql.NullString{String: string(change.Difficulty), Valid: change.Difficulty != ""}
+			var tagID sql.NullInt64
+			if difficulty.Valid {
+				err = tx.QueryRow(difficultyQuery, change.PlayerID, change.Difficulty, change.NewRating, delta).Scan(&rating)
+			} else {
+				tagID = sql.NullInt64{Int64: int64(change.TagID), Valid: true}
+				err = tx.QueryRow(tagQuery, change.PlayerID, change.TagID, change.NewRating, delta).Scan(&rating)
+			}
+			if err != nil {
+				return fmt.Errorf("StoreMatch: failed to update skill rating for player %d: %w", change.PlayerID, err)
+			}
+			_, err = tx.Exec(historyQuery, change.PlayerID, match.ID, difficulty, tagID, rating-delta, rating)
+			if err != nil {
+				return fmt.Errorf("StoreMatch: failed to record skill rating history for player %d: %w", change.PlayerID, err)
+			}
+		}
+	}
+
 	if err = tx.Commit(); err != nil {
 		return fmt.Errorf("StoreMatch: failed to commit transaction: %w", err)
 	}
@@ -514,9 +888,20 @@ func (ds *dataStore) GetMatch(matchID uuid.UUID) (*models.Session, error) {
 	  p.difficulty, 
 	  m.is_rated, 
 	  m.status, 
-	  m.winner_id, 
+	  COALESCE(m.winner_id, 0), 
 	  m.start_time, 
-	  m.end_time
+	  m.end_time,
+	  m.reverted_by,
+	  m.reverted_at,
+	  m.revert_reason,
+	  m.series_id,
+	  m.scoring_mode,
+	  m.optimize_for,
+	  m.languages,
+	  m.tournament_id,
+	  m.tournament_match,
+	  m.league_id,
+	  m.league_fixture
 	FROM matches m
 	JOIN problems p ON p.id = m.problem_id
 	WHERE m.id = $1`
@@ -532,9 +917,22 @@ func (ds *dataStore) GetMatch(matchID uuid.UUID) (*models.Session, error) {
 		winnerID  int64
 		startTime time.Time
 		endTime   time.Time
+		revertBy  sql.NullInt64
+		revertAt  sql.NullTime
+		reason    sql.NullString
+		seriesID  sql.NullString
+		modeStr   string
+		optimize  sql.NullString
+		languages pq.StringArray
+		tourneyID sql.NullInt64
+		tourneyM  sql.NullInt64
+		leagueID  sql.NullInt64
+		fixture   sql.NullInt64
 	)
 	err := ds.db.QueryRow(matchQ, matchID.String()).
-		Scan(&id, &probID, &probName, &probSlug, &probDiff, &isRated, &statusStr, &winnerID, &startTime, &endTime)
+		Scan(&id, &probID, &probName, &probSlug, &probDiff, &isRated, &statusStr, &winnerID, &startTime, &endTime,
+			&revertBy, &revertAt, &reason, &seriesID, &modeStr, &optimize, &languages, &tourneyID, &tourneyM,
+			&leagueID, &fixture)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -550,11 +948,16 @@ func (ds *dataStore) GetMatch(matchID uuid.UUID) (*models.Session, error) {
 	if err != nil {
 		return nil, fmt.Errorf("GetMatch: parse difficulty: %w", err)
 	}
+	parsedMode, err := models.ParseScoringMode(modeStr)
+	if err != nil {
+		return nil, fmt.Errorf("GetMatch: parse scoring mode: %w", err)
+	}
 
 	const playersQ = `
-	SELECT player_id
+	SELECT player_id, placement, score, problems_solved
 	FROM match_players
-	WHERE match_id = $1`
+	WHERE match_id = $1
+	ORDER BY placement NULLS LAST`
 
 	rows, err := ds.db.Query(playersQ, matchID.String())
 	if err != nil {
@@ -562,34 +965,78 @@ func (ds *dataStore) GetMatch(matchID uuid.UUID) (*models.Session, error) {
 	}
 	defer rows.Close()
 
-	var players []int64
+	var players, placements []int64
+	var scores []models.PlayerScore
+	var progress []models.RelayProgress
 	for rows.Next() {
 		var pid int64
-		if err := rows.Scan(&pid); err != nil {
+		var placement, solved sql.NullInt64
+		var scoreData []byte
+		if err := rows.Scan(&pid, &placement, &scoreData, &solved); err != nil {
 			return nil, fmt.Errorf("GetMatch: scanning player: %w", err)
 		}
 		players = append(players, pid)
+		if placement.Valid {
+			placements = append(placements, pid)
+		}
+		if scoreData != nil {
+			var score models.PlayerScore
+			if err := json.Unmarshal(scoreData, &score); err != nil {
+				return nil, fmt.Errorf("GetMatch: unmarshal score: %w", err)
+			}
+			scores = append(scores, score)
+		}
+		if solved.Valid {
+			progress = append(progress, models.RelayProgress{PlayerID: pid, Solved: int(solved.Int64)})
+		}
 	}
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("GetMatch: players rows error: %w", err)
 	}
 
+	problems, err := ds.getMatchProblems(matchID)
+	if err != nil {
+		return nil, fmt.Errorf("GetMatch: %w", err)
+	}
+
 	subs, err := ds.GetMatchSubmissions(matchID)
 	if err != nil {
 		return nil, fmt.Errorf("GetMatch: fetching submissions: %w", err)
 	}
 
-	return &models.Session{
+	session := &models.Session{
 		ID:          id,
 		Problem:     models.Problem{ID: probID, Name: probName, Slug: probSlug, Difficulty: parsedDiff},
+		Problems:    problems,
+		Progress:    progress,
 		IsRated:     isRated,
 		Status:      parsedStatus,
 		Winner:      winnerID,
 		StartTime:   startTime,
 		EndTime:     endTime,
 		Players:     players,
+		Placements:  placements,
 		Submissions: subs,
-	}, nil
+		SeriesID:    seriesID.String,
+		ScoringMode: parsedMode,
+		OptimizeFor: models.OptimizationMetric(optimize.String),
+		Languages:   parseLanguages(languages),
+		Scores:      scores,
+	}
+	if tourneyID.Valid {
+		session.Tournament = &models.TournamentLink{TournamentID: int(tourneyID.Int64), Match: int(tourneyM.Int64)}
+	}
+	if leagueID.Valid {
+		session.League = &models.LeagueLink{LeagueID: int(leagueID.Int64), Fixture: int(fixture.Int64)}
+	}
+	if revertAt.Valid {
+		session.Revert = &models.MatchRevert{
+			RevertedBy: revertBy.Int64,
+			RevertedAt: revertAt.Time,
+			Reason:     reason.String,
+		}
+	}
+	return session, nil
 }
 
 // Returns the most recent count matches for a given user.
@@ -608,16 +1055,21 @@ func (ds *dataStore) GetPlayerMatches(userID int64, page int, limit int) ([]mode
 		p.difficulty, 
 		m.is_rated, 
 		m.status, 
-		m.winner_id, 
+		COALESCE(m.winner_id, 0), 
 		m.start_time, 
 		m.end_time,
-		ARRAY_AGG(mp2.player_id) AS player_ids
+		m.series_id,
+		m.scoring_mode,
+		m.optimize_for,
+		m.languages,
+		ARRAY_AGG(mp2.player_id) AS player_ids,
+		ARRAY_AGG(mp2.player_id ORDER BY mp2.placement) FILTER (WHERE mp2.placement IS NOT NULL) AS placements
 	FROM match_players mp
 	JOIN matches m ON mp.match_id = m.id
 	JOIN problems p ON m.problem_id = p.id
 	JOIN match_players mp2 ON mp2.match_id = m.id
 	WHERE mp.player_id = $1
-	GROUP BY m.id, m.problem_id, p.name, p.slug, p.difficulty, m.is_rated, m.status, m.winner_id, m.start_time, m.end_time
+	GROUP BY m.id, m.problem_id, p.name, p.slug, p.difficulty, m.is_rated, m.status, m.winner_id, m.start_time, m.end_time, m.series_id, m.scoring_mode, m.optimize_for, m.languages
 	ORDER BY m.start_time DESC
 	LIMIT $2 OFFSET $3`
 
@@ -640,9 +1092,14 @@ func (ds *dataStore) GetPlayerMatches(userID int64, page int, limit int) ([]mode
 		var startTime time.Time
 		var endTime time.Time
 		var playerIDs pq.Int64Array
+		var placements pq.Int64Array
+		var seriesID sql.NullString
+		var scoringMode string
+		var optimizeFor sql.NullString
+		var languages pq.StringArray
 
 		err = rows.Scan(&id, &probID, &probName, &probSlug, &probDifficulty,
-			&isRated, &status, &winnerID, &startTime, &endTime, &playerIDs)
+			&isRated, &status, &winnerID, &startTime, &endTime, &seriesID, &scoringMode, &optimizeFor, &languages, &playerIDs, &placements)
 		if err != nil {
 			return nil, fmt.Errorf("GetPlayerMatches scan: %w", err)
 		}
@@ -657,12 +1114,22 @@ func (ds *dataStore) GetPlayerMatches(userID int64, page int, limit int) ([]mode
 			return nil, fmt.Errorf("GetPlayerMatches parse: %w", err)
 		}
 
+		parsedMode, err := models.ParseScoringMode(scoringMode)
+		if err != nil {
+			return nil, fmt.Errorf("GetPlayerMatches parse: %w", err)
+		}
+
 		sesh := models.Session{
 			ID:          id,
 			Status:      parsedStatus,
 			IsRated:     isRated,
 			Problem:     models.Problem{ID: probID, Name: probName, Slug: probSlug, Difficulty: parsedDifficulty},
 			Players:     playerIDs,
+			Placements:  placements,
+			SeriesID:    seriesID.String,
+			ScoringMode: parsedMode,
+			OptimizeFor: models.OptimizationMetric(optimizeFor.String),
+			Languages:   parseLanguages(languages),
 			Submissions: nil, // Do not populate submissions
 			Winner:      winnerID,
 			StartTime:   startTime,
@@ -677,7 +1144,8 @@ func (ds *dataStore) GetPlayerMatches(userID int64, page int, limit int) ([]mode
 func (ds *dataStore) GetMatchSubmissions(matchID uuid.UUID) ([]models.PlayerSubmission, error) {
 	query := `
 	SELECT submission_id, player_id, passed_test_cases, total_test_cases, 
-		status, runtime, runtime_percentile, memory, memory_percentile, lang, submitted_at
+		status, runtime, runtime_percentile, memory, memory_percentile, lang, submitted_at,
+		COALESCE(problem_id, 0)
 	FROM submissions
 	WHERE match_id = $1`
 
@@ -700,9 +1168,10 @@ func (ds *dataStore) GetMatchSubmissions(matchID uuid.UUID) ([]models.PlayerSubm
 		var runtimePercentile sql.NullFloat64
 		var memory sql.NullInt32
 		var memoryPercentile sql.NullFloat64
+		var problemID int
 
 		err = rows.Scan(&id, &playerID, &passedTestCases, &totalTestCases, &status,
-			&runtime, &runtimePercentile, &memory, &memoryPercentile, &lang, &submittedAt)
+			&runtime, &runtimePercentile, &memory, &memoryPercentile, &lang, &submittedAt, &problemID)
 		if err != nil {
 			return nil, fmt.Errorf("GetMatchSubmissions scan: %w", err)
 		}
@@ -740,6 +1209,7 @@ func (ds *dataStore) GetMatchSubmissions(matchID uuid.UUID) ([]models.PlayerSubm
 		submission := models.PlayerSubmission{
 			ID:                id,
 			PlayerID:          playerID,
+			ProblemID:         problemID,
 			PassedTestCases:   passedTestCases,
 			TotalTestCases:    totalTestCases,
 			Status:            parsedStatus,
@@ -754,3 +1224,951 @@ func (ds *dataStore) GetMatchSubmissions(matchID uuid.UUID) ([]models.PlayerSubm
 	}
 	return submissions, nil
 }
+
+// Returns a season by ID, or nil if not found.
+func (ds *dataStore) GetSeason(seasonID int) (*models.Season, error) {
+	query := `SELECT id, name, start_time, end_time, archived_at IS NOT NULL
+			FROM seasons WHERE id = $1`
+	var s models.Season
+	err := ds.db.QueryRow(query, seasonID).Scan(&s.ID, &s.Name, &s.StartTime, &s.EndTime, &s.Archived)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("GetSeason: %w", err)
+	}
+	return &s, nil
+}
+
+func (ds *dataStore) querySeasons(name string, query string, args ...interface{}) ([]models.Season, error) {
+	rows, err := ds.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	defer rows.Close()
+
+	var seasons []models.Season
+	for rows.Next() {
+		var s models.Season
+		if err := rows.Scan(&s.ID, &s.Name, &s.StartTime, &s.EndTime, &s.Archived); err != nil {
+			return nil, fmt.Errorf("%s scan: %w", name, err)
+		}
+		seasons = append(seasons, s)
+	}
+	return seasons, nil
+}
+
+// Returns seasons that have ended but whose standings have not been saved yet.
+func (ds *dataStore) GetSeasonsToArchive(now time.Time) ([]models.Season, error) {
+	query := `SELECT id, name, start_time, end_time, false FROM seasons
+			WHERE end_time <= $1 AND archived_at IS NULL ORDER BY end_time`
+	return ds.querySeasons("GetSeasonsToArchive", query, now)
+}
+
+// Returns running seasons whose ratings have not been reset yet.
+func (ds *dataStore) GetSeasonsToStart(now time.Time) ([]models.Season, error) {
+	query := `SELECT id, name, start_time, end_time, false FROM seasons
+			WHERE start_time <= $1 AND end_time > $1 AND reset_at IS NULL ORDER BY start_time`
+	return ds.querySeasons("GetSeasonsToStart", query, now)
+}
+
+// Saves the final standings of a season: every player who finished a rated match
+// during it, ranked by their current rating. Does nothing if already archived.
+func (ds *dataStore) ArchiveSeason(seasonID int) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ArchiveSeason: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE seasons SET archived_at = NOW() WHERE id = $1 AND archived_at IS NULL`, seasonID)
+	if err != nil {
+		return fmt.Errorf("ArchiveSeason: failed to mark season: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	standingsQuery := `
+	INSERT INTO season_standings (season_id, user_id, rank, rating, games_played)
+	SELECT $1, u.id, RANK() OVER (ORDER BY u.rating DESC), u.rating, g.games
+	FROM users u
+	JOIN (
+		SELECT mp.player_id, COUNT(*) AS games
+		FROM match_players mp
+		JOIN matches m ON m.id = mp.match_id
+		WHERE m.season_id = $1 AND m.is_rated
+		GROUP BY mp.player_id
+	) g ON g.player_id = u.id`
+	if _, err := tx.Exec(standingsQuery, seasonID); err != nil {
+		return fmt.Errorf("ArchiveSeason: failed to save standings: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ArchiveSeason: failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Moves the rating of every player with at least placementGames rated matches resetPercent of
+// the way toward their mean rating, recording each change in their rating history. Players still
+// in placement keep their rating. Does nothing if the season already applied its reset. Returns
+// whether the reset was applied.
+func (ds *dataStore) StartSeason(seasonID int, resetPercent int, placementGames int) (bool, error) {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("StartSeason: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE seasons SET reset_at = NOW() WHERE id = $1 AND reset_at IS NULL`, seasonID)
+	if err != nil {
+		return false, fmt.Errorf("StartSeason: failed to mark season: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+
+	// Matches stored while the reset runs would otherwise be undone by it, since each new
+	// rating is worked out from the rating read when the reset started
+	if _, err := tx.Exec(`LOCK TABLE users IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return false, fmt.Errorf("StartSeason: failed to lock users: %w", err)
+	}
+
+	resetQuery := `
+	WITH mean AS (
+		SELECT AVG(rating) AS rating FROM users WHERE games_played >= $2
+	), reset AS (
+		UPDATE users u SET rating = ROUND(old.rating - (old.rating - mean.rating) * $1 / 100.0)
+		FROM users old, mean
+		WHERE old.id = u.id AND old.games_played >= $2
+			AND ROUND(old.rating - (old.rating - mean.rating) * $1 / 100.0) <> old.rating
+		RETURNING u.id, old.rating AS old_rating, u.rating AS new_rating
+	)
+	INSERT INTO rating_history (user_id, reason, season_id, old_rating, new_rating, created_at)
+	SELECT id, $3, $4, old_rating, new_rating, NOW() FROM reset`
+	_, err = tx.Exec(resetQuery, resetPercent, placementGames, models.RatingHistorySeasonReset, seasonID)
+	if err != nil {
+		return false, fmt.Errorf("StartSeason: failed to reset ratings: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("StartSeason: failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+// Returns one page of a season's final standings and the number of ranked players.
+func (ds *dataStore) GetSeasonStandings(seasonID int, page int, limit int) ([]models.SeasonStanding, int, error) {
+	query := `
+	SELECT s.rank, s.user_id, u.username, u.discriminator, s.rating, s.games_played,
+		COUNT(*) OVER () AS total
+	FROM season_standings s
+	JOIN users u ON u.id = s.user_id
+	WHERE s.season_id = $1
+	ORDER BY s.rank, s.user_id
+	LIMIT $2 OFFSET $3`
+	rows, err := ds.db.Query(query, seasonID, limit, (page-1)*limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("GetSeasonStandings: %w", err)
+	}
+	defer rows.Close()
+
+	standings := []models.SeasonStanding{}
+	total := 0
+	for rows.Next() {
+		var s models.SeasonStanding
+		if err := rows.Scan(&s.Rank, &s.UserID, &s.Username, &s.Discriminator,
+			&s.Rating, &s.GamesPlayed, &total); err != nil {
+			return nil, 0, fmt.Errorf("GetSeasonStandings scan: %w", err)
+		}
+		standings = append(standings, s)
+	}
+	return standings, total, nil
+}
+
+// Marks a stored match as Reverted and undoes the rating changes it caused. Each player's
+// later rating history is shifted by the same amount so their chart stays continuous,
+// and the revert is written to the audit log. Deviation and volatility move back by what the
+// match changed them by, which restores them exactly when it was the player's latest match, and
+// skill ratings move back the same way. Returns the rating change each player received.
+func (ds *dataStore) RevertMatch(matchID uuid.UUID, adminID int64, reason string) ([]models.RatingChange, error) {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("RevertMatch: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRow(`SELECT status FROM matches WHERE id = $1 FOR UPDATE`, matchID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return nil, ErrMatchNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("RevertMatch: failed to lock match: %w", err)
+	}
+	if models.MatchStatus(status) == models.MatchReverted {
+		return nil, ErrMatchAlreadyReverted
+	}
+
+	type historyRow struct {
+		userID          int64
+		delta           int
+		createdAt       time.Time
+		deviationDelta  float64
+		volatilityDelta float64
+		lastRatedAt     sql.NullTime
+	}
+	// Rows stored before deviation and volatility were recorded leave them as they are
+	rows, err := tx.Query(`SELECT user_id, new_rating - old_rating, created_at,
+			COALESCE(new_deviation - old_deviation, 0), COALESCE(new_volatility - old_volatility, 0), old_last_rated_at
+			FROM rating_history WHERE match_id = $1`, matchID)
+	if err != nil {
+		return nil, fmt.Errorf("RevertMatch: failed to read rating history: %w", err)
+	}
+	var history []historyRow
+	for rows.Next() {
+		var h historyRow
+		if err := rows.Scan(&h.userID, &h.delta, &h.createdAt, &h.deviationDelta, &h.volatilityDelta, &h.lastRatedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("RevertMatch: failed to scan rating history: %w", err)
+		}
+		history = append(history, h)
+	}
+	rows.Close()
+
+	reversals := make([]models.RatingChange, 0, len(history))
+	for _, h := range history {
+		// Players were last rated by their latest other match, or when they were before this one
+		var newRating int
+		err := tx.QueryRow(`UPDATE users SET rating = rating - $1, rating_deviation = rating_deviation - $2,
+				volatility = volatility - $3, games_played = GREATEST(games_played - 1, 0),
+				last_rated_at = COALESCE((SELECT MAX(created_at) FROM rating_history
+					WHERE user_id = $4 AND match_id IS NOT NULL AND match_id <> $5), $6)
+				WHERE id = $4 RETURNING rating`, h.delta, h.deviationDelta, h.volatilityDelta, h.userID,
+			matchID, h.lastRatedAt).Scan(&newRating)
+		if err == sql.ErrNoRows {
+			continue // Player has since deleted their account
+		}
+		if err != nil {
+			return nil, fmt.Errorf("RevertMatch: failed to restore rating for player %d: %w", h.userID, err)
+		}
+
+		_, err = tx.Exec(`UPDATE rating_history SET old_rating = old_rating - $1, new_rating = new_rating - $1
+				WHERE user_id = $2 AND created_at > $3`, h.delta, h.userID, h.createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("RevertMatch: failed to adjust later history for player %d: %w", h.userID, err)
+		}
+
+		reversals = append(reversals, models.RatingChange{
+			PlayerID:  h.userID,
+			OldRating: newRating + h.delta,
+			NewRating: newRating,
+			Change:    -h.delta,
+		})
+	}
+
+	if _, err := tx.Exec(`DELETE FROM rating_history WHERE match_id = $1`, matchID); err != nil {
+		return nil, fmt.Errorf("RevertMatch: failed to delete rating history: %w", err)
+	}
+
+	skillReversals, err := revertSkillRatings(tx, matchID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`UPDATE matches SET status = $1, reverted_by = $2, reverted_at = NOW(), revert_reason = $3
+			WHERE id = $4`, models.MatchReverted, adminID, reason, matchID)
+	if err != nil {
+		return nil, fmt.Errorf("RevertMatch: failed to update match: %w", err)
+	}
+
+	details, err := json.Marshal(map[string]interface{}{
+		"reason":        reason,
+		"ratingChanges": reversals,
+		"skillChanges":  skillReversals,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("RevertMatch: failed to marshal audit details: %w", err)
+	}
+	_, err = tx.Exec(`INSERT INTO audit_log (actor_id, action, target_id, details) VALUES ($1, $2, $3, $4)`,
+		adminID, "match_revert", matchID.String(), details)
+	if err != nil {
+		return nil, fmt.Errorf("RevertMatch: failed to write audit log: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("RevertMatch: failed to commit transaction: %w", err)
+	}
+	return reversals, nil
+}
+
+// Moves every skill rating a match changed back by the same amount, returning the reversals.
+func revertSkillRatings(tx *sql.Tx, matchID uuid.UUID) ([]models.SkillRatingChange, error) {
+	rows, err := tx.Query(`SELECT user_id, difficulty, tag_id, new_rating - old_rating
+			FROM skill_rating_history WHERE match_id = $1`, matchID)
+	if err != nil {
+		return nil, fmt.Errorf("RevertMatch: failed to read skill rating history: %w", err)
+	}
+	var changes []models.SkillRatingChange
+	var deltas []int
+	for rows.Next() {
+		var c models.SkillRatingChange
+		var difficulty sql.NullString
+		var tagID sql.NullInt64
+		var delta int
+		if err := rows.Scan(&c.PlayerID, &difficulty, &tagID, &delta); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("RevertMatch: failed to scan skill rating history: %w", err)
+		}
+		c.Difficulty = models.Difficulty(difficulty.String)
+		c.TagID = int(tagID.Int64)
+		changes = append(changes, c)
+		deltas = append(deltas, delta)
+	}
+	rows.Close()
+
+	for i, c := range changes {
+		delta := deltas[i]
+		var rating int
+		if c.Difficulty != "" {
+			err = tx.QueryRow(`UPDATE user_difficulty_ratings SET rating = rating - $1
+					WHERE user_id = $2 AND difficulty = $3 RETURNING rating`, delta, c.PlayerID, c.Difficulty).Scan(&rating)
+		} else {
+			err = tx.QueryRow(`UPDATE user_tag_ratings SET rating = rating - $1
+					WHERE user_id = $2 AND tag_id = $3 RETURNING rating`, delta, c.PlayerID, c.TagID).Scan(&rating)
+		}
+		if err == sql.ErrNoRows {
+			continue // Player has since deleted their account
+		}
+		if err != nil {
+			return nil, fmt.Errorf("RevertMatch: failed to restore skill rating for player %d: %w", c.PlayerID, err)
+		}
+		changes[i].OldRating = rating + delta
+		changes[i].NewRating = rating
+	}
+
+	if _, err := tx.Exec(`DELETE FROM skill_rating_history WHERE match_id = $1`, matchID); err != nil {
+		return nil, fmt.Errorf("RevertMatch: failed to delete skill rating history: %w", err)
+	}
+	return changes, nil
+}
+
+// Saves a finished series and links the matches played in it.
+func (ds *dataStore) StoreSeries(series *models.Series) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return fmt.Errorf("StoreSeries: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+	INSERT INTO series (id, target, is_rated, winner_id, start_time, end_time)
+	VALUES ($1, $2, $3, $4, $5, $6)`,
+		series.ID, series.Target, series.IsRated, series.Winner, series.StartTime, series.EndTime)
+	if err != nil {
+		return fmt.Errorf("StoreSeries: failed to insert series: %w", err)
+	}
+
+	for _, score := range series.Scores {
+		_, err = tx.Exec(`INSERT INTO series_players (series_id, player_id, wins) VALUES ($1, $2, $3)`,
+			series.ID, score.PlayerID, score.Wins)
+		if err != nil {
+			return fmt.Errorf("StoreSeries: failed to insert player %d: %w", score.PlayerID, err)
+		}
+	}
+
+	if len(series.MatchIDs) > 0 {
+		_, err = tx.Exec(`UPDATE matches SET series_id = $1 WHERE id = ANY($2::uuid[])`,
+			series.ID, pq.Array(series.MatchIDs))
+		if err != nil {
+			return fmt.Errorf("StoreSeries: failed to link matches: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("StoreSeries: failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Returns a page of the series a user has played, most recent first.
+func (ds *dataStore) GetPlayerSeries(userID int64, page int, limit int) ([]models.Series, error) {
+	if (page < 1 || limit < 1) || limit > 50 {
+		return nil, fmt.Errorf("GetPlayerSeries: invalid page or limit")
+	}
+
+	query := `
+	SELECT
+		s.id,
+		s.target,
+		s.is_rated,
+		COALESCE(s.winner_id, 0),
+		s.start_time,
+		s.end_time,
+		ARRAY(SELECT player_id FROM series_players WHERE series_id = s.id ORDER BY player_id) AS player_ids,
+		ARRAY(SELECT wins FROM series_players WHERE series_id = s.id ORDER BY player_id) AS wins,
+		ARRAY(SELECT id::text FROM matches WHERE series_id = s.id ORDER BY start_time) AS match_ids
+	FROM series_players sp
+	JOIN series s ON s.id = sp.series_id
+	WHERE sp.player_id = $1
+	ORDER BY s.start_time DESC
+	LIMIT $2 OFFSET $3`
+
+	rows, err := ds.db.Query(query, userID, limit, (page-1)*limit)
+	if err != nil {
+		return nil, fmt.Errorf("GetPlayerSeries: %w", err)
+	}
+	defer rows.Close()
+
+	seriesList := []models.Series{}
+	for rows.Next() {
+		var s models.Series
+		var playerIDs, wins pq.Int64Array
+		var matchIDs pq.StringArray
+		err := rows.Scan(&s.ID, &s.Target, &s.IsRated, &s.Winner, &s.StartTime, &s.EndTime,
+			&playerIDs, &wins, &matchIDs)
+		if err != nil {
+			return nil, fmt.Errorf("GetPlayerSeries scan: %w", err)
+		}
+		s.Players = playerIDs
+		s.MatchIDs = matchIDs
+		for i, pid := range playerIDs {
+			s.Scores = append(s.Scores, models.SeriesScore{PlayerID: pid, Wins: int(wins[i])})
+		}
+		seriesList = append(seriesList, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetPlayerSeries rows: %w", err)
+	}
+	return seriesList, nil
+}
+
+// Stored languages were validated when the match was created, so they are converted as is.
+func parseLanguages(languages []string) []models.LanguageType {
+	var parsed []models.LanguageType
+	for _, lang := range languages {
+		parsed = append(parsed, models.LanguageType(lang))
+	}
+	return parsed
+}
+
+// The problems of a relay match in the order they are solved, or nil for a single-problem match.
+func (ds *dataStore) getMatchProblems(matchID uuid.UUID) ([]models.Problem, error) {
+	const q = `
+	SELECT p.id, p.name, p.slug, p.difficulty
+	FROM match_problems mp
+	JOIN problems p ON p.id = mp.problem_id
+	WHERE mp.match_id = $1
+	ORDER BY mp.position`
+
+	rows, err := ds.db.Query(q, matchID.String())
+	if err != nil {
+		return nil, fmt.Errorf("getMatchProblems: querying problems: %w", err)
+	}
+	defer rows.Close()
+
+	var problems []models.Problem
+	for rows.Next() {
+		var p models.Problem
+		var diff string
+		if err := rows.Scan(&p.ID, &p.Name, &p.Slug, &diff); err != nil {
+			return nil, fmt.Errorf("getMatchProblems: scanning problem: %w", err)
+		}
+		p.Difficulty, err = models.ParseDifficulty(diff)
+		if err != nil {
+			return nil, fmt.Errorf("getMatchProblems: parse difficulty: %w", err)
+		}
+		problems = append(problems, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getMatchProblems: rows error: %w", err)
+	}
+	return problems, nil
+}
+
+// Saves a new tournament open for registration, filling in its ID and creation time.
+func (ds *dataStore) CreateTournament(t *models.Tournament) error {
+	details, err := json.Marshal(t.MatchDetails)
+	if err != nil {
+		return fmt.Errorf("CreateTournament: failed to marshal match details: %w", err)
+	}
+	err = ds.db.QueryRow(`
+	INSERT INTO tournaments (name, format, status, match_details, created_by)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at`,
+		t.Name, t.Format, models.TournamentRegistration, details, t.CreatedBy).Scan(&t.ID, &t.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("CreateTournament: %w", err)
+	}
+	t.Status = models.TournamentRegistration
+	return nil
+}
+
+// Returns a tournament with its players and bracket, or nil if not found. Players are in seed
+// order once the tournament has started, and in registration order before.
+func (ds *dataStore) GetTournament(tournamentID int) (*models.Tournament, error) {
+	var t models.Tournament
+	var details []byte
+	var createdBy, winner sql.NullInt64
+	var startTime, endTime sql.NullTime
+	err := ds.db.QueryRow(`
+	SELECT id, name, format, status, match_details, created_by, winner_id, created_at, start_time, end_time
+	FROM tournaments
+	WHERE id = $1`, tournamentID).
+		Scan(&t.ID, &t.Name, &t.Format, &t.Status, &details, &createdBy, &winner, &t.CreatedAt, &startTime, &endTime)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetTournament: querying tournament: %w", err)
+	}
+	if err := json.Unmarshal(details, &t.MatchDetails); err != nil {
+		return nil, fmt.Errorf("GetTournament: unmarshal match details: %w", err)
+	}
+	t.CreatedBy = createdBy.Int64
+	t.Winner = winner.Int64
+	if startTime.Valid {
+		t.StartTime = &startTime.Time
+	}
+	if endTime.Valid {
+		t.EndTime = &endTime.Time
+	}
+
+	rows, err := ds.db.Query(`
+	SELECT u.id, u.username, u.discriminator, COALESCE(tp.rating, u.rating, 1000), COALESCE(tp.seed, 0)
+	FROM tournament_players tp
+	JOIN users u ON u.id = tp.user_id
+	WHERE tp.tournament_id = $1
+	ORDER BY tp.seed NULLS LAST, tp.registered_at, u.id`, tournamentID)
+	if err != nil {
+		return nil, fmt.Errorf("GetTournament: querying players: %w", err)
+	}
+	defer rows.Close()
+	t.Players = []models.TournamentPlayer{}
+	for rows.Next() {
+		var p models.TournamentPlayer
+		if err := rows.Scan(&p.UserID, &p.Username, &p.Discriminator, &p.Rating, &p.Seed); err != nil {
+			return nil, fmt.Errorf("GetTournament: scanning player: %w", err)
+		}
+		t.Players = append(t.Players, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetTournament: players rows error: %w", err)
+	}
+
+	matchRows, err := ds.db.Query(`
+	SELECT number, bracket, round, COALESCE(player1_id, 0), COALESCE(player2_id, 0), COALESCE(winner_id, 0),
+		decided, COALESCE(session_id::text, ''), winner_to, winner_slot, loser_to, loser_slot
+	FROM tournament_matches
+	WHERE tournament_id = $1
+	ORDER BY number`, tournamentID)
+	if err != nil {
+		return nil, fmt.Errorf("GetTournament: querying matches: %w", err)
+	}
+	defer matchRows.Close()
+	t.Matches = []models.TournamentMatch{}
+	for matchRows.Next() {
+		var m models.TournamentMatch
+		var winnerTo, winnerSlot, loserTo, loserSlot sql.NullInt64
+		err := matchRows.Scan(&m.Number, &m.Bracket, &m.Round, &m.Players[0], &m.Players[1], &m.Winner,
+			&m.Decided, &m.SessionID, &winnerTo, &winnerSlot, &loserTo, &loserSlot)
+		if err != nil {
+			return nil, fmt.Errorf("GetTournament: scanning match: %w", err)
+		}
+		if winnerTo.Valid {
+			m.WinnerTo = &models.BracketSlot{Match: int(winnerTo.Int64), Slot: int(winnerSlot.Int64)}
+		}
+		if loserTo.Valid {
+			m.LoserTo = &models.BracketSlot{Match: int(loserTo.Int64), Slot: int(loserSlot.Int64)}
+		}
+		t.Matches = append(t.Matches, m)
+	}
+	if err := matchRows.Err(); err != nil {
+		return nil, fmt.Errorf("GetTournament: matches rows error: %w", err)
+	}
+	return &t, nil
+}
+
+// Adds a user to a tournament that is still open for registration.
+func (ds *dataStore) RegisterTournamentPlayer(tournamentID int, userID int64) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return fmt.Errorf("RegisterTournamentPlayer: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Locking the tournament keeps registrations out once it has started
+	var status string
+	err = tx.QueryRow(`SELECT status FROM tournaments WHERE id = $1 FOR UPDATE`, tournamentID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return ErrTournamentNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("RegisterTournamentPlayer: failed to lock tournament: %w", err)
+	}
+	if models.TournamentStatus(status) != models.TournamentRegistration {
+		return ErrTournamentNotOpen
+	}
+
+	res, err := tx.Exec(`
+	INSERT INTO tournament_players (tournament_id, user_id) VALUES ($1, $2)
+	ON CONFLICT DO NOTHING`, tournamentID, userID)
+	if err != nil {
+		return fmt.Errorf("RegisterTournamentPlayer: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAlreadyRegistered
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("RegisterTournamentPlayer: failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Closes registration and marks the tournament as started. Returns false if it had already started.
+func (ds *dataStore) CloseTournamentRegistration(tournamentID int) (bool, error) {
+	res, err := ds.db.Exec(`
+	UPDATE tournaments SET status = $2, start_time = NOW()
+	WHERE id = $1 AND status = $3`,
+		tournamentID, models.TournamentInProgress, models.TournamentRegistration)
+	if err != nil {
+		return false, fmt.Errorf("CloseTournamentRegistration: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("CloseTournamentRegistration: %w", err)
+	}
+	return n == 1, nil
+}
+
+// Saves the seeds, bracket and result of a started tournament.
+func (ds *dataStore) SaveTournamentBracket(t *models.Tournament) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return fmt.Errorf("SaveTournamentBracket: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var winner sql.NullInt64
+	if t.Winner > 0 {
+		winner = sql.NullInt64{Int64: t.Winner, Valid: true}
+	}
+	_, err = tx.Exec(`UPDATE tournaments SET status = $2, winner_id = $3, end_time = $4 WHERE id = $1`,
+		t.ID, t.Status, winner, t.EndTime)
+	if err != nil {
+		return fmt.Errorf("SaveTournamentBracket: failed to update tournament: %w", err)
+	}
+
+	for _, p := range t.Players {
+		_, err = tx.Exec(`UPDATE tournament_players SET seed = $3, rating = $4 WHERE tournament_id = $1 AND user_id = $2`,
+			t.ID, p.UserID, p.Seed, p.Rating)
+		if err != nil {
+			return fmt.Errorf("SaveTournamentBracket: failed to seed player %d: %w", p.UserID, err)
+		}
+	}
+
+	matchQuery := `
+	INSERT INTO tournament_matches (tournament_id, number, bracket, round, player1_id, player2_id, winner_id,
+		decided, session_id, winner_to, winner_slot, loser_to, loser_slot)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	ON CONFLICT (tournament_id, number) DO UPDATE SET
+		player1_id = EXCLUDED.player1_id,
+		player2_id = EXCLUDED.player2_id,
+		winner_id = EXCLUDED.winner_id,
+		decided = EXCLUDED.decided,
+		session_id = EXCLUDED.session_id`
+	nullID := func(id int64) sql.NullInt64 { return sql.NullInt64{Int64: id, Valid: id > 0} }
+	nullSlot := func(to *models.BracketSlot) (sql.NullInt64, sql.NullInt64) {
+		if to == nil {
+			return sql.NullInt64{}, sql.NullInt64{}
+		}
+		return sql.NullInt64{Int64: int64(to.Match), Valid: true}, sql.NullInt64{Int64: int64(to.Slot), Valid: true}
+	}
+	for _, m := range t.Matches {
+		winnerTo, winnerSlot := nullSlot(m.WinnerTo)
+		loserTo, loserSlot := nullSlot(m.LoserTo)
+		sessionID := sql.NullString{String: m.SessionID, Valid: m.SessionID != ""}
+		_, err = tx.Exec(matchQuery, t.ID, m.Number, m.Bracket, m.Round, nullID(m.Players[0]), nullID(m.Players[1]),
+			nullID(m.Winner), m.Decided, sessionID, winnerTo, winnerSlot, loserTo, loserSlot)
+		if err != nil {
+			return fmt.Errorf("SaveTournamentBracket: failed to save match %d: %w", m.Number, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("SaveTournamentBracket: failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Returns the IDs of started tournaments with a match that has both players but no session
+// deciding it.
+func (ds *dataStore) GetStalledTournaments() ([]int, error) {
+	rows, err := ds.db.Query(`
+	SELECT DISTINCT t.id FROM tournaments t
+	JOIN tournament_matches m ON m.tournament_id = t.id
+	WHERE t.status = $1 AND NOT m.decided AND m.session_id IS NULL
+		AND m.player1_id IS NOT NULL AND m.player2_id IS NOT NULL
+	ORDER BY t.id`, models.TournamentInProgress)
+	if err != nil {
+		return nil, fmt.Errorf("GetStalledTournaments: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("GetStalledTournaments: scanning tournament: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetStalledTournaments: rows error: %w", err)
+	}
+	return ids, nil
+}
+
+// Saves a new league open for registration, filling in its ID and creation time.
+func (ds *dataStore) CreateLeague(l *models.League) error {
+	details, err := json.Marshal(l.MatchDetails)
+	if err != nil {
+		return fmt.Errorf("CreateLeague: failed to marshal match details: %w", err)
+	}
+	err = ds.db.QueryRow(`
+	INSERT INTO leagues (name, format, status, match_details, created_by, rounds, round_hours)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING id, created_at`,
+		l.Name, l.Format, models.LeagueRegistration, details, l.CreatedBy, l.Rounds, l.RoundHours).Scan(&l.ID, &l.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("CreateLeague: %w", err)
+	}
+	l.Status = models.LeagueRegistration
+	return nil
+}
+
+// Returns a league with its players and every fixture paired so far, or nil if not found.
+// Players are in rating order once the league has started, and in registration order before.
+func (ds *dataStore) GetLeague(leagueID int) (*models.League, error) {
+	var l models.League
+	var details []byte
+	var createdBy sql.NullInt64
+	var nextRoundAt, startTime, endTime sql.NullTime
+	err := ds.db.QueryRow(`
+	SELECT id, name, format, status, match_details, created_by, rounds, round_hours, current_round,
+		next_round_at, created_at, start_time, end_time
+	FROM leagues
+	WHERE id = $1`, leagueID).
+		Scan(&l.ID, &l.Name, &l.Format, &l.Status, &details, &createdBy, &l.Rounds, &l.RoundHours, &l.CurrentRound,
+			&nextRoundAt, &l.CreatedAt, &startTime, &endTime)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetLeague: querying league: %w", err)
+	}
+	if err := json.Unmarshal(details, &l.MatchDetails); err != nil {
+		return nil, fmt.Errorf("GetLeague: unmarshal match details: %w", err)
+	}
+	l.CreatedBy = createdBy.Int64
+	if nextRoundAt.Valid {
+		l.NextRoundAt = &nextRoundAt.Time
+	}
+	if startTime.Valid {
+		l.StartTime = &startTime.Time
+	}
+	if endTime.Valid {
+		l.EndTime = &endTime.Time
+	}
+
+	rows, err := ds.db.Query(`
+	SELECT u.id, u.username, u.discriminator, COALESCE(lp.rating, u.rating, 1000)
+	FROM league_players lp
+	JOIN users u ON u.id = lp.user_id
+	WHERE lp.league_id = $1
+	ORDER BY lp.rating DESC NULLS LAST, lp.registered_at, u.id`, leagueID)
+	if err != nil {
+		return nil, fmt.Errorf("GetLeague: querying players: %w", err)
+	}
+	defer rows.Close()
+	l.Players = []models.LeaguePlayer{}
+	for rows.Next() {
+		var p models.LeaguePlayer
+		if err := rows.Scan(&p.UserID, &p.Username, &p.Discriminator, &p.Rating); err != nil {
+			return nil, fmt.Errorf("GetLeague: scanning player: %w", err)
+		}
+		l.Players = append(l.Players, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetLeague: players rows error: %w", err)
+	}
+
+	fixtureRows, err := ds.db.Query(`
+	SELECT number, round, COALESCE(player1_id, 0), COALESCE(player2_id, 0), status, COALESCE(winner_id, 0),
+		COALESCE(session_id::text, ''), requested1, requested2, deadline
+	FROM league_fixtures
+	WHERE league_id = $1
+	ORDER BY number`, leagueID)
+	if err != nil {
+		return nil, fmt.Errorf("GetLeague: querying fixtures: %w", err)
+	}
+	defer fixtureRows.Close()
+	l.Fixtures = []models.LeagueFixture{}
+	for fixtureRows.Next() {
+		var f models.LeagueFixture
+		err := fixtureRows.Scan(&f.Number, &f.Round, &f.Players[0], &f.Players[1], &f.Status, &f.Winner,
+			&f.SessionID, &f.Requested[0], &f.Requested[1], &f.Deadline)
+		if err != nil {
+			return nil, fmt.Errorf("GetLeague: scanning fixture: %w", err)
+		}
+		l.Fixtures = append(l.Fixtures, f)
+	}
+	if err := fixtureRows.Err(); err != nil {
+		return nil, fmt.Errorf("GetLeague: fixtures rows error: %w", err)
+	}
+	return &l, nil
+}
+
+// Adds a user to a league that is still open for registration.
+func (ds *dataStore) RegisterLeaguePlayer(leagueID int, userID int64) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return fmt.Errorf("RegisterLeaguePlayer: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Locking the league keeps registrations out once it has started
+	var status string
+	err = tx.QueryRow(`SELECT status FROM leagues WHERE id = $1 FOR UPDATE`, leagueID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return ErrLeagueNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("RegisterLeaguePlayer: failed to lock league: %w", err)
+	}
+	if models.LeagueStatus(status) != models.LeagueRegistration {
+		return ErrLeagueNotOpen
+	}
+
+	res, err := tx.Exec(`
+	INSERT INTO league_players (league_id, user_id) VALUES ($1, $2)
+	ON CONFLICT DO NOTHING`, leagueID, userID)
+	if err != nil {
+		return fmt.Errorf("RegisterLeaguePlayer: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAlreadyRegistered
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("RegisterLeaguePlayer: failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Closes registration, marks the league as started and records each player's rating at the
+// start. Returns false if it had already started.
+func (ds *dataStore) CloseLeagueRegistration(leagueID int) (bool, error) {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("CloseLeagueRegistration: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+	UPDATE leagues SET status = $2, start_time = NOW()
+	WHERE id = $1 AND status = $3`,
+		leagueID, models.LeagueInProgress, models.LeagueRegistration)
+	if err != nil {
+		return false, fmt.Errorf("CloseLeagueRegistration: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("CloseLeagueRegistration: %w", err)
+	}
+	if n == 0 {
+		return false, nil
+	}
+
+	_, err = tx.Exec(`
+	UPDATE league_players lp SET rating = COALESCE(u.rating, 1000)
+	FROM users u
+	WHERE u.id = lp.user_id AND lp.league_id = $1`, leagueID)
+	if err != nil {
+		return false, fmt.Errorf("CloseLeagueRegistration: failed to record ratings: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("CloseLeagueRegistration: failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+// Saves the schedule and fixtures of a started league.
+func (ds *dataStore) SaveLeague(l *models.League) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return fmt.Errorf("SaveLeague: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+	UPDATE leagues SET status = $2, rounds = $3, current_round = $4, next_round_at = $5, end_time = $6
+	WHERE id = $1`,
+		l.ID, l.Status, l.Rounds, l.CurrentRound, l.NextRoundAt, l.EndTime)
+	if err != nil {
+		return fmt.Errorf("SaveLeague: failed to update league: %w", err)
+	}
+
+	fixtureQuery := `
+	INSERT INTO league_fixtures (league_id, number, round, player1_id, player2_id, status, winner_id,
+		session_id, requested1, requested2, deadline)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	ON CONFLICT (league_id, number) DO UPDATE SET
+		status = EXCLUDED.status,
+		winner_id = EXCLUDED.winner_id,
+		session_id = EXCLUDED.session_id,
+		requested1 = EXCLUDED.requested1,
+		requested2 = EXCLUDED.requested2`
+	nullID := func(id int64) sql.NullInt64 { return sql.NullInt64{Int64: id, Valid: id > 0} }
+	for _, f := range l.Fixtures {
+		sessionID := sql.NullString{String: f.SessionID, Valid: f.SessionID != ""}
+		_, err = tx.Exec(fixtureQuery, l.ID, f.Number, f.Round, nullID(f.Players[0]), nullID(f.Players[1]),
+			f.Status, nullID(f.Winner), sessionID, f.Requested[0], f.Requested[1], f.Deadline)
+		if err != nil {
+			return fmt.Errorf("SaveLeague: failed to save fixture %d: %w", f.Number, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("SaveLeague: failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Returns the IDs of started leagues whose current round has closed.
+func (ds *dataStore) GetLeaguesDue(now time.Time) ([]int, error) {
+	rows, err := ds.db.Query(`
+	SELECT id FROM leagues
+	WHERE status = $1 AND next_round_at <= $2
+	ORDER BY next_round_at`, models.LeagueInProgress, now)
+	if err != nil {
+		return nil, fmt.Errorf("GetLeaguesDue: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("GetLeaguesDue: scanning league: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetLeaguesDue: rows error: %w", err)
+	}
+	return ids, nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"leetcodeduels/config"
 	"leetcodeduels/server"
+	"leetcodeduels/services"
 	"log"
 	"net/http/httptest"
 	"os"
@@ -49,6 +50,23 @@ func mustMigrate(dbURL string) {
 	}
 }
 
+// Treats every user as having finished placement until the test ends, for tests that expect
+// seeded users to have established ratings.
+func withoutPlacement(t *testing.T) {
+	cfg := config.GetConfig()
+	games := cfg.PLACEMENT_GAMES
+	cfg.PLACEMENT_GAMES = 0
+	if err := services.Leaderboard.Rebuild(); err != nil {
+		t.Fatalf("could not rebuild leaderboard: %s", err)
+	}
+	t.Cleanup(func() {
+		cfg.PLACEMENT_GAMES = games
+		if err := services.Leaderboard.Rebuild(); err != nil {
+			t.Errorf("could not rebuild leaderboard: %s", err)
+		}
+	})
+}
+
 func TestMain(m *testing.M) {
 	var err error
 	pool, err = dockertest.NewPool("")
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"leetcodeduels/config"
 	"leetcodeduels/models"
 	"leetcodeduels/services"
 	"net/http"
@@ -137,6 +138,7 @@ func TestSearchUsers(t *testing.T) {
 }
 
 func TestGetProfile(t *testing.T) {
+	withoutPlacement(t)
 	token, err := services.GenerateJWT(12345) // Alice
 	assert.NoError(t, err)
 
@@ -162,6 +164,9 @@ func TestGetProfile(t *testing.T) {
 	assert.Equal(t, "0001", user.Discriminator)
 	assert.Equal(t, "alice_lc", user.LCUsername)
 	assert.Equal(t, 1000, user.Rating)
+	assert.Equal(t, 350.0, user.RatingDeviation)
+	assert.NotNil(t, user.SkillRatings)
+	assert.Empty(t, user.SkillRatings.Difficulties, "alice has no rated matches")
 }
 
 func TestMyProfile(t *testing.T) {
@@ -728,3 +733,200 @@ func TestInviteEndpoints(t *testing.T) {
 		}
 	})
 }
+
+func TestQueueSize(t *testing.T) {
+	token, err := services.GenerateJWT(12345) // Alice
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest("GET", ts.URL+"/api/v1/queue/size", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	res, err := ts.Client().Do(req)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	var size models.QueueSizeResponse
+	err = json.NewDecoder(res.Body).Decode(&size)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, size.Size)
+}
+
+func TestRatingHistory(t *testing.T) {
+	token, err := services.GenerateJWT(12345) // Alice
+	assert.NoError(t, err)
+
+	t.Run("No rated matches", func(t *testing.T) {
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/v1/users/%d/rating-history", ts.URL, 12345), nil)
+		assert.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		res, err := ts.Client().Do(req)
+		assert.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+
+		var history []models.RatingHistoryEntry
+		err = json.NewDecoder(res.Body).Decode(&history)
+		assert.NoError(t, err)
+		assert.Empty(t, history)
+	})
+
+	t.Run("Invalid from", func(t *testing.T) {
+		url := fmt.Sprintf("%s/api/v1/users/%d/rating-history?from=yesterday", ts.URL, 12345)
+		req, err := http.NewRequest("GET", url, nil)
+		assert.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		res, err := ts.Client().Do(req)
+		assert.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+}
+
+func TestLeaderboard(t *testing.T) {
+	withoutPlacement(t)
+	token, err := services.GenerateJWT(12345) // Alice
+	assert.NoError(t, err)
+
+	getLeaderboard := func(t *testing.T, query string) (int, models.LeaderboardResponse) {
+		req, err := http.NewRequest("GET", ts.URL+"/api/v1/leaderboard"+query, nil)
+		assert.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		res, err := ts.Client().Do(req)
+		assert.NoError(t, err)
+		defer res.Body.Close()
+
+		var board models.LeaderboardResponse
+		if res.StatusCode == http.StatusOK {
+			assert.NoError(t, json.NewDecoder(res.Body).Decode(&board))
+		}
+		return res.StatusCode, board
+	}
+
+	t.Run("Global", func(t *testing.T) {
+		status, board := getLeaderboard(t, "?limit=5")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Len(t, board.Entries, 5)
+		assert.Equal(t, int64(9001), board.Entries[0].User.ID)
+		assert.Equal(t, 1, board.Entries[0].Rank)
+		assert.Equal(t, int64(9002), board.Entries[1].User.ID)
+		assert.Equal(t, 2, board.Entries[1].Rank)
+		assert.Equal(t, 3, board.Entries[2].Rank)
+		assert.Equal(t, 3, board.Entries[4].Rank, "tied ratings share a rank")
+
+		assert.NotNil(t, board.MyRank)
+		assert.Equal(t, 3, *board.MyRank)
+	})
+
+	t.Run("Minimum games", func(t *testing.T) {
+		status, board := getLeaderboard(t, "?min_games=2")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, 2, board.Total)
+		assert.Len(t, board.Entries, 2)
+		assert.Equal(t, int64(9001), board.Entries[0].User.ID)
+		assert.Nil(t, board.MyRank, "alice has no rated matches")
+	})
+
+	t.Run("Active recently", func(t *testing.T) {
+		status, board := getLeaderboard(t, "?active_days=7&limit=100")
+		assert.Equal(t, http.StatusOK, status)
+		assert.NotNil(t, board.MyRank)
+		for _, entry := range board.Entries {
+			assert.NotEqual(t, int64(25074), entry.User.ID, "emily has never played")
+		}
+	})
+
+	t.Run("Invalid limit", func(t *testing.T) {
+		status, _ := getLeaderboard(t, "?limit=500")
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+}
+
+func TestSeasonStandings(t *testing.T) {
+	token, err := services.GenerateJWT(12345) // Alice
+	assert.NoError(t, err)
+
+	t.Run("Archived season", func(t *testing.T) {
+		req, err := http.NewRequest("GET", ts.URL+"/api/v1/seasons/1/standings", nil)
+		assert.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		res, err := ts.Client().Do(req)
+		assert.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+
+		var standings models.SeasonStandingsResponse
+		err = json.NewDecoder(res.Body).Decode(&standings)
+		assert.NoError(t, err)
+		assert.Equal(t, "Preseason", standings.Season.Name)
+		assert.True(t, standings.Season.Archived)
+		assert.Equal(t, 2, standings.Total)
+		assert.Len(t, standings.Standings, 2)
+		assert.Equal(t, int64(9001), standings.Standings[0].UserID)
+		assert.Equal(t, 1, standings.Standings[0].Rank)
+		assert.Equal(t, 1200, standings.Standings[0].Rating)
+		assert.Equal(t, "k6user1", standings.Standings[0].Username)
+	})
+
+	t.Run("Unknown season", func(t *testing.T) {
+		req, err := http.NewRequest("GET", ts.URL+"/api/v1/seasons/999/standings", nil)
+		assert.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		res, err := ts.Client().Do(req)
+		assert.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+}
+
+func TestProvisionalRating(t *testing.T) {
+	cfg := config.GetConfig()
+	games := cfg.PLACEMENT_GAMES
+	cfg.PLACEMENT_GAMES = 5
+	defer func() { cfg.PLACEMENT_GAMES = games }()
+
+	getUser := func(t *testing.T, viewerID int64, path string) models.UserInfoResponse {
+		token, err := services.GenerateJWT(viewerID)
+		assert.NoError(t, err)
+
+		req, err := http.NewRequest("GET", ts.URL+"/api/v1/users/"+path, nil)
+		assert.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		res, err := ts.Client().Do(req)
+		assert.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+
+		var user models.UserInfoResponse
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&user))
+		return user
+	}
+
+	t.Run("Hidden from others", func(t *testing.T) {
+		user := getUser(t, 67890, "12345") // Bob viewing Alice
+		assert.True(t, user.Provisional)
+		assert.Equal(t, 0, user.GamesPlayed)
+		assert.Equal(t, 0, user.Rating)
+	})
+
+	t.Run("Visible to self", func(t *testing.T) {
+		user := getUser(t, 12345, "me")
+		assert.True(t, user.Provisional)
+		assert.Equal(t, 1000, user.Rating)
+	})
+
+	t.Run("Established", func(t *testing.T) {
+		cfg.PLACEMENT_GAMES = 2
+		user := getUser(t, 12345, "9001") // k6user1 has 2 rated matches
+		assert.False(t, user.Provisional)
+		assert.Equal(t, 2, user.GamesPlayed)
+		assert.Equal(t, 1200, user.Rating)
+	})
+}
@@ -1,17 +1,23 @@
 package tests
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
 	"testing"
 	"time"
 
+	"leetcodeduels/config"
 	"leetcodeduels/models"
 	"leetcodeduels/services"
+	"leetcodeduels/store"
 	"leetcodeduels/ws"
 
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/require"
 )
@@ -95,7 +101,12 @@ func dialWS(t *testing.T, userID int64) *websocket.Conn {
 }
 
 func readMessage(t *testing.T, c *websocket.Conn) ws.Message {
-	c.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	return readMessageWithin(t, c, 500*time.Millisecond)
+}
+
+// Like readMessage, for messages produced by background loops rather than a direct reply.
+func readMessageWithin(t *testing.T, c *websocket.Conn, timeout time.Duration) ws.Message {
+	c.SetReadDeadline(time.Now().Add(timeout))
 	var m ws.Message
 	err := c.ReadJSON(&m)
 	require.NoError(t, err)
@@ -429,3 +440,1474 @@ func TestForfeitFlow(t *testing.T) {
 	require.NoError(t, err)
 	require.False(t, inGame2, "Player 2 should not be in a game after it ends")
 }
+
+func TestQueueMatchFlow(t *testing.T) {
+	player1ID := int64(87902) // Charlie
+	player2ID := int64(20579) // David
+
+	player1 := dialWS(t, player1ID)
+	defer player1.Close()
+	player2 := dialWS(t, player2ID)
+	defer player2.Close()
+
+	err := player1.WriteJSON(ws.Message{
+		Type:    ws.ClientMsgEnterQueue,
+		Payload: ws.MarshalPayload(ws.EnterQueuePayload{Difficulties: []string{"Easy", "Medium"}}),
+	})
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+
+	size, err := services.QueueManager.QueueSize()
+	require.NoError(t, err)
+	require.Equal(t, int64(1), size, "first player should be waiting in the queue")
+
+	err = player2.WriteJSON(ws.Message{
+		Type:    ws.ClientMsgEnterQueue,
+		Payload: ws.MarshalPayload(ws.EnterQueuePayload{Difficulties: []string{"Easy"}, Tags: []int{1}}),
+	})
+	require.NoError(t, err)
+
+	m1 := readMessageWithin(t, player1, 3*time.Second)
+	m2 := readMessageWithin(t, player2, 3*time.Second)
+	require.Equal(t, ws.ServerMsgStartGame, m1.Type)
+	require.Equal(t, ws.ServerMsgStartGame, m2.Type)
+
+	var p1, p2 ws.StartGamePayload
+	require.NoError(t, json.Unmarshal(m1.Payload, &p1))
+	require.NoError(t, json.Unmarshal(m2.Payload, &p2))
+	require.Equal(t, p1.SessionID, p2.SessionID)
+	require.Equal(t, player2ID, p1.OpponentID)
+	require.Equal(t, player1ID, p2.OpponentID)
+
+	session, err := services.GameManager.GetGame(p1.SessionID)
+	require.NoError(t, err)
+	require.Equal(t, models.Easy, session.Problem.Difficulty)
+
+	size, err = services.QueueManager.QueueSize()
+	require.NoError(t, err)
+	require.Equal(t, int64(0), size, "matched players should leave the queue")
+
+	err = player1.WriteJSON(ws.Message{Type: ws.ClientMsgForfeit})
+	require.NoError(t, err)
+	readMessage(t, player1)
+	readMessage(t, player2)
+}
+
+func TestLeaveQueue(t *testing.T) {
+	playerID := int64(25074) // Emily
+
+	player := dialWS(t, playerID)
+	defer player.Close()
+
+	err := player.WriteJSON(ws.Message{
+		Type:    ws.ClientMsgEnterQueue,
+		Payload: ws.MarshalPayload(ws.EnterQueuePayload{Difficulties: []string{"Hard"}}),
+	})
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+
+	queued, err := services.QueueManager.IsQueued(playerID)
+	require.NoError(t, err)
+	require.True(t, queued)
+
+	err = player.WriteJSON(ws.Message{Type: ws.ClientMsgLeaveQueue})
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+
+	queued, err = services.QueueManager.IsQueued(playerID)
+	require.NoError(t, err)
+	require.False(t, queued, "player should be removed after leaving the queue")
+}
+
+// Sends an invite from inviter to invitee, accepts it and returns the inviter's start_game payload.
+func startInvitedGame(t *testing.T, inviter, invitee *websocket.Conn, inviterID, inviteeID int64, details models.MatchDetails) ws.StartGamePayload {
+	err := inviter.WriteJSON(ws.Message{
+		Type:    ws.ClientMsgSendInvitation,
+		Payload: ws.MarshalPayload(ws.SendInvitationPayload{InviteeID: inviteeID, MatchDetails: details}),
+	})
+	require.NoError(t, err)
+	require.Equal(t, ws.ServerMsgInvitationRequest, readMessage(t, invitee).Type)
+
+	err = invitee.WriteJSON(ws.Message{
+		Type:    ws.ClientMsgAcceptInvitation,
+		Payload: ws.MarshalPayload(ws.AcceptInvitationPayload{InviterID: inviterID}),
+	})
+	require.NoError(t, err)
+
+	m1 := readMessage(t, inviter)
+	m2 := readMessage(t, invitee)
+	require.Equal(t, ws.ServerMsgStartGame, m1.Type)
+	require.Equal(t, ws.ServerMsgStartGame, m2.Type)
+
+	var start ws.StartGamePayload
+	require.NoError(t, json.Unmarshal(m1.Payload, &start))
+	return start
+}
+
+func TestRatedMatchUpdatesRatings(t *testing.T) {
+	withoutPlacement(t)
+	player1ID := int64(43567) // Fiona
+	player2ID := int64(56563) // Gavin
+
+	player1 := dialWS(t, player1ID)
+	defer player1.Close()
+	player2 := dialWS(t, player2ID)
+	defer player2.Close()
+
+	details := models.MatchDetails{IsRated: true, Difficulties: []models.Difficulty{models.Easy}}
+	startInvitedGame(t, player1, player2, player1ID, player2ID, details)
+
+	err := player1.WriteJSON(ws.Message{Type: ws.ClientMsgForfeit})
+	require.NoError(t, err)
+
+	var end ws.GameOverPayload
+	var changes []models.RatingChange
+	for _, c := range []*websocket.Conn{player1, player2} {
+		endMsg := readMessage(t, c)
+		require.Equal(t, ws.ServerMsgGameOver, endMsg.Type)
+		require.NoError(t, json.Unmarshal(endMsg.Payload, &end))
+		require.Equal(t, player2ID, end.WinnerID)
+		require.Len(t, end.RatingChanges, 1, "players only hear about their own rating change")
+		changes = append(changes, end.RatingChanges...)
+	}
+	require.Equal(t, player1ID, changes[0].PlayerID)
+	require.Equal(t, player2ID, changes[1].PlayerID)
+
+	time.Sleep(100 * time.Millisecond) // match is stored after game_over is sent
+	for _, change := range changes {
+		rating, err := store.DataStore.GetUserRating(change.PlayerID)
+		require.NoError(t, err)
+		require.Equal(t, change.NewRating, rating, "stored rating should match game_over payload")
+		if change.PlayerID == player2ID {
+			require.Equal(t, 16, change.Change)
+		} else {
+			require.Equal(t, -16, change.Change)
+		}
+
+		history, err := store.DataStore.GetRatingHistory(change.PlayerID, time.Time{}, time.Time{})
+		require.NoError(t, err)
+		require.Len(t, history, 1)
+		require.Equal(t, end.SessionID, history[0].MatchID)
+		require.Equal(t, change.OldRating, history[0].OldRating)
+		require.Equal(t, change.NewRating, history[0].NewRating)
+		require.Equal(t, 1000, history[0].OpponentRating)
+
+		inFuture, err := store.DataStore.GetRatingHistory(change.PlayerID, time.Now().Add(time.Hour), time.Time{})
+		require.NoError(t, err)
+		require.Empty(t, inFuture)
+
+		skills, err := store.DataStore.GetSkillRatings(change.PlayerID)
+		require.NoError(t, err)
+		require.Len(t, skills.Difficulties, 1)
+		require.Equal(t, models.Easy, skills.Difficulties[0].Difficulty)
+		require.Equal(t, change.NewRating, skills.Difficulties[0].Rating, "first rated match moves skill ratings like the overall one")
+		for _, tag := range skills.Tags {
+			require.Equal(t, change.NewRating, tag.Rating)
+		}
+	}
+}
+
+func TestRevertRatedMatch(t *testing.T) {
+	player1ID := int64(81970) // Henry
+	player2ID := int64(92349) // Isabel
+	adminID := int64(31657)   // Juliet
+
+	cfg := config.GetConfig()
+	system := cfg.RATING_SYSTEM
+	cfg.ADMIN_USER_IDS = []int64{adminID}
+	cfg.RATING_SYSTEM = "glicko2" // So the match moves deviation and volatility too
+	defer func() {
+		cfg.ADMIN_USER_IDS = nil
+		cfg.RATING_SYSTEM = system
+	}()
+
+	player1 := dialWS(t, player1ID)
+	defer player1.Close()
+	player2 := dialWS(t, player2ID)
+	defer player2.Close()
+
+	details := models.MatchDetails{IsRated: true, Difficulties: []models.Difficulty{models.Easy}}
+	startInvitedGame(t, player1, player2, player1ID, player2ID, details)
+
+	require.NoError(t, player1.WriteJSON(ws.Message{Type: ws.ClientMsgForfeit}))
+	endMsg := readMessage(t, player2)
+	readMessage(t, player1)
+
+	var end ws.GameOverPayload
+	require.NoError(t, json.Unmarshal(endMsg.Payload, &end))
+	time.Sleep(100 * time.Millisecond) // match is stored after game_over is sent
+
+	revert := func(userID int64) *http.Response {
+		token, err := services.GenerateJWT(userID)
+		require.NoError(t, err)
+		body := strings.NewReader(`{"reason": "opponent disconnected"}`)
+		req, err := http.NewRequest("POST", ts.URL+"/api/v1/matches/"+end.SessionID+"/revert", body)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	res := revert(player1ID)
+	res.Body.Close()
+	require.Equal(t, http.StatusForbidden, res.StatusCode, "only admins may revert")
+
+	res = revert(adminID)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var session models.Session
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&session))
+	require.Equal(t, models.MatchReverted, session.Status)
+	require.NotNil(t, session.Revert)
+	require.Equal(t, adminID, session.Revert.RevertedBy)
+	require.Equal(t, "opponent disconnected", session.Revert.Reason)
+
+	for _, pid := range []int64{player1ID, player2ID} {
+		rating, err := store.DataStore.GetPlayerRating(pid)
+		require.NoError(t, err)
+		require.Equal(t, 1000, rating.Rating, "rating should be restored")
+		require.InDelta(t, 350, rating.Deviation, 0.01)
+		require.InDelta(t, 0.06, rating.Volatility, 0.0001)
+		require.Nil(t, rating.LastRatedAt)
+		require.Zero(t, rating.GamesPlayed)
+
+		history, err := store.DataStore.GetRatingHistory(pid, time.Time{}, time.Time{})
+		require.NoError(t, err)
+		require.Empty(t, history)
+
+		skills, err := store.DataStore.GetSkillRatings(pid)
+		require.NoError(t, err)
+		require.NotEmpty(t, skills.Difficulties)
+		for _, d := range skills.Difficulties {
+			require.Equal(t, 1000, d.Rating, "skill ratings should be restored")
+		}
+		for _, tag := range skills.Tags {
+			require.Equal(t, 1000, tag.Rating)
+		}
+	}
+
+	again := revert(adminID)
+	again.Body.Close()
+	require.Equal(t, http.StatusConflict, again.StatusCode)
+}
+
+func TestFreeForAllFlow(t *testing.T) {
+	inviterID := int64(10987) // Katya
+	lisaID := int64(26354)
+	mattID := int64(51796)
+
+	inviter := dialWS(t, inviterID)
+	defer inviter.Close()
+	lisa := dialWS(t, lisaID)
+	defer lisa.Close()
+	matt := dialWS(t, mattID)
+	defer matt.Close()
+
+	invite := ws.SendInvitationPayload{
+		InviteeIDs:   []int64{lisaID, mattID},
+		MatchDetails: models.MatchDetails{Difficulties: []models.Difficulty{models.Easy}},
+	}
+	require.NoError(t, inviter.WriteJSON(ws.Message{Type: ws.ClientMsgSendInvitation, Payload: ws.MarshalPayload(invite)}))
+
+	for _, c := range []*websocket.Conn{lisa, matt} {
+		msg := readMessage(t, c)
+		require.Equal(t, ws.ServerMsgInvitationRequest, msg.Type)
+		var req ws.InvitationRequestPayload
+		require.NoError(t, json.Unmarshal(msg.Payload, &req))
+		require.ElementsMatch(t, []int64{lisaID, mattID}, req.InviteeIDs)
+	}
+
+	accept := ws.Message{Type: ws.ClientMsgAcceptInvitation, Payload: ws.MarshalPayload(ws.AcceptInvitationPayload{InviterID: inviterID})}
+	require.NoError(t, lisa.WriteJSON(accept))
+	require.Equal(t, ws.ServerMsgInvitationAccepted, readMessage(t, inviter).Type, "game waits for every invitee")
+
+	require.NoError(t, matt.WriteJSON(accept))
+	var start ws.StartGamePayload
+	for _, c := range []*websocket.Conn{inviter, lisa, matt} {
+		msg := readMessage(t, c)
+		require.Equal(t, ws.ServerMsgStartGame, msg.Type)
+		require.NoError(t, json.Unmarshal(msg.Payload, &start))
+		require.Len(t, start.OpponentIDs, 2)
+	}
+
+	session, err := services.GameManager.GetGame(start.SessionID)
+	require.NoError(t, err)
+	require.Len(t, session.Players, 3)
+
+	submit := func(c *websocket.Conn, id int64, status models.SubmissionStatus) {
+		sub := ws.SubmissionPayload{
+			ID:        id,
+			ProblemID: session.Problem.ID,
+			Status:    status,
+			Language:  "go",
+			Time:      time.Now(),
+		}
+		require.NoError(t, c.WriteJSON(ws.Message{Type: ws.ClientMsgSubmission, Payload: ws.MarshalPayload(sub)}))
+	}
+
+	// Every other player hears about a submission
+	submit(lisa, 1, models.WrongAnswer)
+	for _, c := range []*websocket.Conn{inviter, matt} {
+		msg := readMessage(t, c)
+		require.Equal(t, ws.ServerMsgOpponentSubmission, msg.Type)
+	}
+
+	// The first to finish doesn't end the game while two players remain
+	submit(matt, 2, models.Accepted)
+	for _, c := range []*websocket.Conn{inviter, lisa, matt} {
+		msg := readMessage(t, c)
+		require.Equal(t, ws.ServerMsgPlayerFinished, msg.Type)
+		var finished ws.PlayerFinishedPayload
+		require.NoError(t, json.Unmarshal(msg.Payload, &finished))
+		require.Equal(t, mattID, finished.PlayerID)
+		require.Equal(t, 1, finished.Placement)
+	}
+
+	require.NoError(t, inviter.WriteJSON(ws.Message{Type: ws.ClientMsgForfeit}))
+	for _, c := range []*websocket.Conn{inviter, lisa, matt} {
+		msg := readMessage(t, c)
+		require.Equal(t, ws.ServerMsgGameOver, msg.Type)
+		var end ws.GameOverPayload
+		require.NoError(t, json.Unmarshal(msg.Payload, &end))
+		require.Equal(t, mattID, end.WinnerID)
+		require.Equal(t, []int64{mattID, lisaID, inviterID}, end.Placements)
+	}
+
+	time.Sleep(100 * time.Millisecond) // match is stored after game_over is sent
+	stored, err := store.DataStore.GetMatch(uuid.MustParse(start.SessionID))
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	require.Equal(t, []int64{mattID, lisaID, inviterID}, stored.Placements)
+}
+
+func TestSeriesFlow(t *testing.T) {
+	player1ID := int64(43298) // Owen
+	player2ID := int64(97862) // Philip
+
+	player1 := dialWS(t, player1ID)
+	defer player1.Close()
+	player2 := dialWS(t, player2ID)
+	defer player2.Close()
+
+	details := models.MatchDetails{Difficulties: []models.Difficulty{models.Easy}, SeriesTarget: 2}
+	start := startInvitedGame(t, player1, player2, player1ID, player2ID, details)
+	require.NotEmpty(t, start.SeriesID)
+
+	for game := 1; game <= 2; game++ {
+		require.NoError(t, player1.WriteJSON(ws.Message{Type: ws.ClientMsgForfeit}))
+
+		for _, c := range []*websocket.Conn{player1, player2} {
+			require.Equal(t, ws.ServerMsgGameOver, readMessage(t, c).Type)
+
+			msg := readMessage(t, c)
+			require.Equal(t, ws.ServerMsgSeriesUpdate, msg.Type)
+			var update ws.SeriesUpdatePayload
+			require.NoError(t, json.Unmarshal(msg.Payload, &update))
+			require.Equal(t, start.SeriesID, update.SeriesID)
+			require.Equal(t, game == 2, update.Finished)
+			require.Contains(t, update.Scores, models.SeriesScore{PlayerID: player2ID, Wins: game})
+
+			if game == 1 {
+				msg = readMessage(t, c)
+				require.Equal(t, ws.ServerMsgStartGame, msg.Type, "next game starts automatically")
+				var next ws.StartGamePayload
+				require.NoError(t, json.Unmarshal(msg.Payload, &next))
+				require.Equal(t, start.SeriesID, next.SeriesID)
+			} else {
+				require.Equal(t, player2ID, update.WinnerID)
+			}
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond) // series is stored after series_update is sent
+	series, err := store.DataStore.GetPlayerSeries(player1ID, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, series, 1)
+	require.Equal(t, start.SeriesID, series[0].ID)
+	require.Equal(t, player2ID, series[0].Winner)
+	require.Len(t, series[0].MatchIDs, 2)
+
+	matches, err := store.DataStore.GetPlayerMatches(player1ID, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, matches, 2)
+	for _, m := range matches {
+		require.Equal(t, start.SeriesID, m.SeriesID)
+	}
+}
+
+func TestTimeLimitExpires(t *testing.T) {
+	player1ID := int64(70763) // Quincy
+	player2ID := int64(82352) // Rachel
+
+	player1 := dialWS(t, player1ID)
+	defer player1.Close()
+	player2 := dialWS(t, player2ID)
+	defer player2.Close()
+
+	details := models.MatchDetails{Difficulties: []models.Difficulty{models.Easy}, TimeLimit: 5}
+	start := startInvitedGame(t, player1, player2, player1ID, player2ID, details)
+	require.WithinDuration(t, time.Now().Add(5*time.Minute), start.Deadline, 5*time.Second)
+
+	session, err := services.GameManager.GetGame(start.SessionID)
+	require.NoError(t, err)
+
+	sub := ws.SubmissionPayload{
+		ID:              1,
+		ProblemID:       session.Problem.ID,
+		Status:          models.WrongAnswer,
+		PassedTestCases: 5,
+		TotalTestCases:  10,
+		Language:        "go",
+		Time:            time.Now(),
+	}
+	require.NoError(t, player2.WriteJSON(ws.Message{Type: ws.ClientMsgSubmission, Payload: ws.MarshalPayload(sub)}))
+	require.Equal(t, ws.ServerMsgOpponentSubmission, readMessage(t, player1).Type)
+
+	// Move the deadline into the past rather than waiting out the limit
+	opts, err := redis.ParseURL(config.GetConfig().RDB_URL)
+	require.NoError(t, err)
+	rdb := redis.NewClient(opts)
+	defer rdb.Close()
+	require.NoError(t, rdb.ZAdd(context.Background(), "game:timers", &redis.Z{Score: 0, Member: start.SessionID}).Err())
+
+	for _, c := range []*websocket.Conn{player1, player2} {
+		msg := readMessageWithin(t, c, 5*time.Second)
+		require.Equal(t, ws.ServerMsgGameOver, msg.Type)
+		var end ws.GameOverPayload
+		require.NoError(t, json.Unmarshal(msg.Payload, &end))
+		require.Equal(t, ws.GameOverTimeout, end.Reason)
+		require.Equal(t, player2ID, end.WinnerID, "most passed test cases wins on time")
+	}
+
+	inGame, err := services.GameManager.IsPlayerInGame(player1ID)
+	require.NoError(t, err)
+	require.False(t, inGame)
+}
+
+func TestPartialScoringTimeout(t *testing.T) {
+	player1ID := int64(73443) // Nancy
+	player2ID := int64(32189) // Tom
+
+	player1 := dialWS(t, player1ID)
+	defer player1.Close()
+	player2 := dialWS(t, player2ID)
+	defer player2.Close()
+
+	details := models.MatchDetails{Difficulties: []models.Difficulty{models.Easy}, ScoringMode: models.ScoringPartial}
+	start := startInvitedGame(t, player1, player2, player1ID, player2ID, details)
+
+	session, err := services.GameManager.GetGame(start.SessionID)
+	require.NoError(t, err)
+	require.Equal(t, models.ScoringPartial, session.ScoringMode)
+
+	// Both pass half of the test cases, so the earlier submission wins
+	submit := func(c *websocket.Conn, other *websocket.Conn, id int64, passed, total int) {
+		sub := ws.SubmissionPayload{
+			ID:              id,
+			ProblemID:       session.Problem.ID,
+			Status:          models.WrongAnswer,
+			PassedTestCases: passed,
+			TotalTestCases:  total,
+			Language:        "go",
+			Time:            time.Now(),
+		}
+		require.NoError(t, c.WriteJSON(ws.Message{Type: ws.ClientMsgSubmission, Payload: ws.MarshalPayload(sub)}))
+		require.Equal(t, ws.ServerMsgOpponentSubmission, readMessage(t, other).Type)
+	}
+	submit(player1, player2, 1, 6, 12)
+	submit(player2, player1, 2, 10, 20)
+
+	opts, err := redis.ParseURL(config.GetConfig().RDB_URL)
+	require.NoError(t, err)
+	rdb := redis.NewClient(opts)
+	defer rdb.Close()
+	require.NoError(t, rdb.ZAdd(context.Background(), "game:timers", &redis.Z{Score: 0, Member: start.SessionID}).Err())
+
+	for _, c := range []*websocket.Conn{player1, player2} {
+		msg := readMessageWithin(t, c, 5*time.Second)
+		require.Equal(t, ws.ServerMsgGameOver, msg.Type)
+		var end ws.GameOverPayload
+		require.NoError(t, json.Unmarshal(msg.Payload, &end))
+		require.Equal(t, ws.GameOverTimeout, end.Reason)
+		require.Equal(t, player1ID, end.WinnerID, "ties break on submission time")
+		require.Equal(t, models.ScoringPartial, end.ScoringMode)
+		require.Len(t, end.Scores, 2)
+		require.Equal(t, player1ID, end.Scores[0].PlayerID)
+		require.Equal(t, 50.0, end.Scores[0].Score)
+		require.Equal(t, 50.0, end.Scores[1].Score)
+	}
+
+	time.Sleep(100 * time.Millisecond) // match is stored after game_over is sent
+	stored, err := store.DataStore.GetMatch(uuid.MustParse(start.SessionID))
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	require.Equal(t, models.ScoringPartial, stored.ScoringMode)
+	require.Len(t, stored.Scores, 2)
+	require.Equal(t, int64(1), stored.Scores[0].SubmissionID)
+}
+
+func TestOptimizationDuel(t *testing.T) {
+	player1ID := int64(62307) // Uri
+	player2ID := int64(52340) // Victor
+
+	player1 := dialWS(t, player1ID)
+	defer player1.Close()
+	player2 := dialWS(t, player2ID)
+	defer player2.Close()
+
+	details := models.MatchDetails{
+		Difficulties: []models.Difficulty{models.Easy},
+		ScoringMode:  models.ScoringOptimize,
+		OptimizeFor:  models.OptimizeMemory,
+	}
+	start := startInvitedGame(t, player1, player2, player1ID, player2ID, details)
+
+	session, err := services.GameManager.GetGame(start.SessionID)
+	require.NoError(t, err)
+	require.Equal(t, models.OptimizeMemory, session.OptimizeFor)
+
+	// Accepted submissions don't end an optimization duel
+	submit := func(c, other *websocket.Conn, id int64, runtimePct, memoryPct float64) {
+		sub := ws.SubmissionPayload{
+			ID:                id,
+			ProblemID:         session.Problem.ID,
+			Status:            models.Accepted,
+			PassedTestCases:   10,
+			TotalTestCases:    10,
+			RuntimePercentile: &runtimePct,
+			MemoryPercentile:  &memoryPct,
+			Language:          "go",
+			Time:              time.Now(),
+		}
+		require.NoError(t, c.WriteJSON(ws.Message{Type: ws.ClientMsgSubmission, Payload: ws.MarshalPayload(sub)}))
+		require.Equal(t, ws.ServerMsgOpponentSubmission, readMessage(t, other).Type)
+	}
+	submit(player1, player2, 1, 95, 30)
+	submit(player2, player1, 2, 50, 70)
+	submit(player1, player2, 3, 60, 65)
+
+	opts, err := redis.ParseURL(config.GetConfig().RDB_URL)
+	require.NoError(t, err)
+	rdb := redis.NewClient(opts)
+	defer rdb.Close()
+	require.NoError(t, rdb.ZAdd(context.Background(), "game:timers", &redis.Z{Score: 0, Member: start.SessionID}).Err())
+
+	for _, c := range []*websocket.Conn{player1, player2} {
+		msg := readMessageWithin(t, c, 5*time.Second)
+		require.Equal(t, ws.ServerMsgGameOver, msg.Type)
+		var end ws.GameOverPayload
+		require.NoError(t, json.Unmarshal(msg.Payload, &end))
+		require.Equal(t, player2ID, end.WinnerID, "best memory percentile wins")
+		require.Equal(t, models.ScoringOptimize, end.ScoringMode)
+		require.Equal(t, models.OptimizeMemory, end.OptimizeFor)
+		require.Len(t, end.Scores, 2)
+		require.Equal(t, 70.0, end.Scores[0].Score)
+		require.Equal(t, 65.0, end.Scores[1].Score)
+		require.Equal(t, int64(3), end.Scores[1].SubmissionID)
+	}
+
+	time.Sleep(100 * time.Millisecond) // match is stored after game_over is sent
+	stored, err := store.DataStore.GetMatch(uuid.MustParse(start.SessionID))
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	require.Equal(t, models.OptimizeMemory, stored.OptimizeFor)
+}
+
+func TestPenaltyScoring(t *testing.T) {
+	player1ID := int64(80001) // Amara
+	player2ID := int64(80002) // Bruno
+
+	player1 := dialWS(t, player1ID)
+	defer player1.Close()
+	player2 := dialWS(t, player2ID)
+	defer player2.Close()
+
+	details := models.MatchDetails{Difficulties: []models.Difficulty{models.Easy}, ScoringMode: models.ScoringPenalty}
+	start := startInvitedGame(t, player1, player2, player1ID, player2ID, details)
+
+	session, err := services.GameManager.GetGame(start.SessionID)
+	require.NoError(t, err)
+	penalty := int64(config.GetConfig().SUBMISSION_PENALTY * 60)
+
+	submit := func(c *websocket.Conn, id int64, status models.SubmissionStatus) {
+		sub := ws.SubmissionPayload{
+			ID:              id,
+			ProblemID:       session.Problem.ID,
+			Status:          status,
+			PassedTestCases: 10,
+			TotalTestCases:  10,
+			Language:        "go",
+			Time:            time.Now(),
+		}
+		require.NoError(t, c.WriteJSON(ws.Message{Type: ws.ClientMsgSubmission, Payload: ws.MarshalPayload(sub)}))
+	}
+
+	// A wrong answer costs a penalty, and solving it first doesn't end the game
+	for _, status := range []models.SubmissionStatus{models.WrongAnswer, models.Accepted} {
+		submit(player1, 1, status)
+		msg := readMessage(t, player2)
+		require.Equal(t, ws.ServerMsgOpponentSubmission, msg.Type)
+		var opp ws.OpponentSubmissionPayload
+		require.NoError(t, json.Unmarshal(msg.Payload, &opp))
+		require.Equal(t, 1, opp.Penalties)
+		require.Equal(t, penalty, opp.PenaltyTime)
+	}
+
+	// Solving it cleanly afterwards still has the lower adjusted time
+	submit(player2, 2, models.Accepted)
+	for _, c := range []*websocket.Conn{player1, player2} {
+		msg := readMessage(t, c)
+		require.Equal(t, ws.ServerMsgGameOver, msg.Type)
+		var end ws.GameOverPayload
+		require.NoError(t, json.Unmarshal(msg.Payload, &end))
+		require.Equal(t, ws.GameOverSolved, end.Reason)
+		require.Equal(t, player2ID, end.WinnerID)
+		require.Len(t, end.Scores, 2)
+		require.Equal(t, 0, end.Scores[0].Penalties)
+		require.Equal(t, player1ID, end.Scores[1].PlayerID)
+		require.Equal(t, 1, end.Scores[1].Penalties)
+		require.GreaterOrEqual(t, end.Scores[1].AdjustedTime, penalty)
+	}
+}
+
+func TestLanguageRestrictedMatch(t *testing.T) {
+	player1ID := int64(80003) // Celia
+	player2ID := int64(80004) // Dmitri
+
+	player1 := dialWS(t, player1ID)
+	defer player1.Close()
+	player2 := dialWS(t, player2ID)
+	defer player2.Close()
+
+	details := models.MatchDetails{
+		Difficulties: []models.Difficulty{models.Easy},
+		Languages:    []models.LanguageType{models.Rust},
+	}
+	start := startInvitedGame(t, player1, player2, player1ID, player2ID, details)
+	require.Equal(t, []models.LanguageType{models.Rust}, start.Languages)
+
+	session, err := services.GameManager.GetGame(start.SessionID)
+	require.NoError(t, err)
+
+	sub := ws.SubmissionPayload{
+		ID:              1,
+		ProblemID:       session.Problem.ID,
+		Status:          models.Accepted,
+		PassedTestCases: 10,
+		TotalTestCases:  10,
+		Language:        models.Python3,
+		Time:            time.Now(),
+	}
+	require.NoError(t, player1.WriteJSON(ws.Message{Type: ws.ClientMsgSubmission, Payload: ws.MarshalPayload(sub)}))
+
+	msg := readMessage(t, player1)
+	require.Equal(t, ws.ServerMsgError, msg.Type)
+	var errPayload ws.ErrorPayload
+	require.NoError(t, json.Unmarshal(msg.Payload, &errPayload))
+	require.Equal(t, "language_not_allowed", errPayload.Code)
+
+	session, err = services.GameManager.GetGame(start.SessionID)
+	require.NoError(t, err)
+	require.Empty(t, session.Submissions, "rejected submissions are not recorded")
+
+	sub.ID, sub.Language = 2, models.Rust
+	require.NoError(t, player1.WriteJSON(ws.Message{Type: ws.ClientMsgSubmission, Payload: ws.MarshalPayload(sub)}))
+	for _, c := range []*websocket.Conn{player1, player2} {
+		msg := readMessage(t, c)
+		require.Equal(t, ws.ServerMsgGameOver, msg.Type)
+	}
+
+	time.Sleep(100 * time.Millisecond) // match is stored after game_over is sent
+	stored, err := store.DataStore.GetMatch(uuid.MustParse(start.SessionID))
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	require.Equal(t, []models.LanguageType{models.Rust}, stored.Languages)
+}
+
+func TestRelayMatch(t *testing.T) {
+	player1ID := int64(80005) // Elena
+	player2ID := int64(80006) // Felix
+
+	player1 := dialWS(t, player1ID)
+	defer player1.Close()
+	player2 := dialWS(t, player2ID)
+	defer player2.Close()
+
+	start := startInvitedGame(t, player1, player2, player1ID, player2ID, models.MatchDetails{Relay: true, IsRated: true})
+	require.Equal(t, len(services.RelayDifficulties), start.ProblemCount)
+
+	session, err := services.GameManager.GetGame(start.SessionID)
+	require.NoError(t, err)
+	require.Len(t, session.Problems, 3)
+	for i, problem := range session.Problems {
+		require.Equal(t, services.RelayDifficulties[i], problem.Difficulty)
+	}
+	require.Equal(t, session.Problems[0], session.Problem)
+
+	submit := func(id int64, problem models.Problem) {
+		sub := ws.SubmissionPayload{
+			ID:              id,
+			ProblemID:       problem.ID,
+			Status:          models.Accepted,
+			PassedTestCases: 10,
+			TotalTestCases:  10,
+			Language:        models.Python3,
+			Time:            time.Now(),
+		}
+		require.NoError(t, player1.WriteJSON(ws.Message{Type: ws.ClientMsgSubmission, Payload: ws.MarshalPayload(sub)}))
+	}
+
+	// Skipping ahead to the second problem is ignored
+	submit(1, session.Problems[1])
+
+	for i, problem := range session.Problems[:2] {
+		submit(int64(i+2), problem)
+		for _, c := range []*websocket.Conn{player1, player2} {
+			msg := readMessage(t, c)
+			require.Equal(t, ws.ServerMsgRelayProgress, msg.Type)
+			var progress ws.RelayProgressPayload
+			require.NoError(t, json.Unmarshal(msg.Payload, &progress))
+			require.Equal(t, player1ID, progress.PlayerID)
+			require.Equal(t, i+1, progress.Solved)
+			require.Equal(t, 3, progress.Total)
+			if c == player1 {
+				require.Contains(t, progress.NextProblemURL, session.Problems[i+1].Slug)
+			} else {
+				require.Empty(t, progress.NextProblemURL, "opponents aren't told the next problem")
+			}
+		}
+	}
+
+	submit(4, session.Problems[2])
+	for _, c := range []*websocket.Conn{player1, player2} {
+		msg := readMessage(t, c)
+		require.Equal(t, ws.ServerMsgGameOver, msg.Type)
+		var end ws.GameOverPayload
+		require.NoError(t, json.Unmarshal(msg.Payload, &end))
+		require.Equal(t, player1ID, end.WinnerID)
+	}
+
+	time.Sleep(100 * time.Millisecond) // match is stored after game_over is sent
+	stored, err := store.DataStore.GetMatch(uuid.MustParse(start.SessionID))
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	require.Equal(t, session.Problems, stored.Problems)
+	require.ElementsMatch(t, []models.RelayProgress{
+		{PlayerID: player1ID, Solved: 3},
+		{PlayerID: player2ID, Solved: 0},
+	}, stored.Progress)
+	require.Len(t, stored.Submissions, 4)
+	require.Equal(t, session.Problems[2].ID, stored.Submissions[3].ProblemID)
+
+	// Every problem of the relay is rated, not just the first
+	for _, pid := range []int64{player1ID, player2ID} {
+		skills, err := store.DataStore.GetSkillRatings(pid)
+		require.NoError(t, err)
+		var difficulties []models.Difficulty
+		for _, d := range skills.Difficulties {
+			difficulties = append(difficulties, d.Difficulty)
+		}
+		require.ElementsMatch(t, services.RelayDifficulties, difficulties)
+	}
+}
+
+func TestSpectateMatch(t *testing.T) {
+	player1ID := int64(80007)   // Greta
+	player2ID := int64(80008)   // Hugo
+	spectatorID := int64(80009) // Ingrid
+
+	player1 := dialWS(t, player1ID)
+	defer player1.Close()
+	player2 := dialWS(t, player2ID)
+	defer player2.Close()
+	spectator := dialWS(t, spectatorID)
+	defer spectator.Close()
+
+	spectate := func(c *websocket.Conn, sessionID string) ws.Message {
+		p := ws.SpectatePayload{SessionID: sessionID}
+		require.NoError(t, c.WriteJSON(ws.Message{Type: ws.ClientMsgSpectate, Payload: ws.MarshalPayload(p)}))
+		return readMessage(t, c)
+	}
+	requireError := func(msg ws.Message, code string) {
+		require.Equal(t, ws.ServerMsgError, msg.Type)
+		var errPayload ws.ErrorPayload
+		require.NoError(t, json.Unmarshal(msg.Payload, &errPayload))
+		require.Equal(t, code, errPayload.Code)
+	}
+
+	requireError(spectate(spectator, uuid.NewString()), "session_not_found")
+
+	details := models.MatchDetails{Difficulties: []models.Difficulty{models.Easy}}
+	start := startInvitedGame(t, player1, player2, player1ID, player2ID, details)
+	session, err := services.GameManager.GetGame(start.SessionID)
+	require.NoError(t, err)
+
+	requireError(spectate(player1, start.SessionID), "cannot_spectate")
+
+	msg := spectate(spectator, start.SessionID)
+	require.Equal(t, ws.ServerMsgSpectating, msg.Type)
+	var state ws.SpectatingPayload
+	require.NoError(t, json.Unmarshal(msg.Payload, &state))
+	require.Equal(t, start.SessionID, state.SessionID)
+	require.ElementsMatch(t, []int64{player1ID, player2ID}, state.Players)
+	require.Equal(t, start.ProblemURL, state.ProblemURL)
+	require.Empty(t, state.Submissions)
+
+	submit := func(c *websocket.Conn, id int64, status models.SubmissionStatus) {
+		sub := ws.SubmissionPayload{
+			ID:              id,
+			ProblemID:       session.Problem.ID,
+			Status:          status,
+			PassedTestCases: 5,
+			TotalTestCases:  10,
+			Language:        models.Python3,
+			Time:            time.Now(),
+		}
+		require.NoError(t, c.WriteJSON(ws.Message{Type: ws.ClientMsgSubmission, Payload: ws.MarshalPayload(sub)}))
+	}
+
+	submit(player2, 1, models.WrongAnswer)
+	for _, c := range []*websocket.Conn{spectator, player1} {
+		msg := readMessage(t, c)
+		require.Equal(t, ws.ServerMsgOpponentSubmission, msg.Type)
+		var update ws.OpponentSubmissionPayload
+		require.NoError(t, json.Unmarshal(msg.Payload, &update))
+		require.Equal(t, player2ID, update.PlayerID)
+		require.Equal(t, models.WrongAnswer, update.Status)
+	}
+
+	// Spectators can't submit or forfeit on anyone's behalf
+	submit(spectator, 2, models.Accepted)
+	require.NoError(t, spectator.WriteJSON(ws.Message{Type: ws.ClientMsgForfeit}))
+	time.Sleep(100 * time.Millisecond)
+	session, err = services.GameManager.GetGame(start.SessionID)
+	require.NoError(t, err)
+	require.Equal(t, models.MatchActive, session.Status)
+	require.Len(t, session.Submissions, 1)
+
+	submit(player1, 3, models.Accepted)
+	msg = readMessage(t, spectator)
+	require.Equal(t, ws.ServerMsgOpponentSubmission, msg.Type)
+	var update ws.OpponentSubmissionPayload
+	require.NoError(t, json.Unmarshal(msg.Payload, &update))
+	require.Equal(t, player1ID, update.PlayerID)
+	require.Equal(t, models.Accepted, update.Status)
+
+	for _, c := range []*websocket.Conn{spectator, player1, player2} {
+		msg := readMessage(t, c)
+		require.Equal(t, ws.ServerMsgGameOver, msg.Type)
+		var end ws.GameOverPayload
+		require.NoError(t, json.Unmarshal(msg.Payload, &end))
+		require.Equal(t, player1ID, end.WinnerID)
+	}
+
+	watching, err := services.GameManager.RemoveSpectator(spectatorID)
+	require.NoError(t, err)
+	require.Empty(t, watching, "spectators stop watching once the game is over")
+}
+
+func TestAgreedDraw(t *testing.T) {
+	player1ID := int64(77356) // Samuel
+	player2ID := int64(12346) // Samantha
+
+	player1 := dialWS(t, player1ID)
+	defer player1.Close()
+	player2 := dialWS(t, player2ID)
+	defer player2.Close()
+
+	details := models.MatchDetails{IsRated: true, Difficulties: []models.Difficulty{models.Easy}}
+	start := startInvitedGame(t, player1, player2, player1ID, player2ID, details)
+
+	require.NoError(t, player1.WriteJSON(ws.Message{Type: ws.ClientMsgOfferDraw}))
+	msg := readMessage(t, player2)
+	require.Equal(t, ws.ServerMsgDrawOffered, msg.Type)
+
+	require.NoError(t, player2.WriteJSON(ws.Message{Type: ws.ClientMsgOfferDraw}))
+	for _, c := range []*websocket.Conn{player1, player2} {
+		msg := readMessage(t, c)
+		require.Equal(t, ws.ServerMsgGameOver, msg.Type)
+		var end ws.GameOverPayload
+		require.NoError(t, json.Unmarshal(msg.Payload, &end))
+		require.Equal(t, models.MatchDraw, end.Status)
+		require.Equal(t, ws.GameOverDraw, end.Reason)
+		require.Zero(t, end.WinnerID)
+		require.Len(t, end.RatingChanges, 1)
+		require.Zero(t, end.RatingChanges[0].Change, "evenly rated players keep their rating on a draw")
+	}
+
+	time.Sleep(100 * time.Millisecond) // match is stored after game_over is sent
+	matches, err := store.DataStore.GetPlayerMatches(player1ID, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, matches, 1)
+	require.Equal(t, start.SessionID, matches[0].ID)
+	require.Equal(t, models.MatchDraw, matches[0].Status)
+	require.Zero(t, matches[0].Winner)
+}
+
+func TestTournamentFlow(t *testing.T) {
+	playerIDs := []int64{80010, 80011, 80012, 80013} // Jonas, Kira, Leon, Mira
+	conns := map[int64]*websocket.Conn{}
+	for _, id := range playerIDs {
+		c := dialWS(t, id)
+		defer c.Close()
+		conns[id] = c
+	}
+
+	call := func(userID int64, method, path string, body any) *http.Response {
+		token, err := services.GenerateJWT(userID)
+		require.NoError(t, err)
+		var reader io.Reader
+		if body != nil {
+			b, err := json.Marshal(body)
+			require.NoError(t, err)
+			reader = strings.NewReader(string(b))
+		}
+		req, err := http.NewRequest(method, ts.URL+"/api/v1/tournaments"+path, reader)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		return res
+	}
+	decode := func(res *http.Response) models.Tournament {
+		defer res.Body.Close()
+		var tournament models.Tournament
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&tournament))
+		return tournament
+	}
+	// Skips anything else the player is sent, such as the other semi-final's game_over
+	readUntil := func(c *websocket.Conn, msgType string) ws.Message {
+		for {
+			msg := readMessage(t, c)
+			if msg.Type == msgType {
+				return msg
+			}
+		}
+	}
+
+	create := models.CreateTournamentRequest{
+		Name:         "Friday Knockout",
+		Format:       models.SingleElimination,
+		MatchDetails: models.MatchDetails{Difficulties: []models.Difficulty{models.Easy}},
+	}
+	res := call(playerIDs[0], "POST", "", create)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	tournament := decode(res)
+	require.Equal(t, models.TournamentRegistration, tournament.Status)
+	path := fmt.Sprintf("/%d", tournament.ID)
+
+	res = call(playerIDs[0], "POST", path+"/start", nil)
+	res.Body.Close()
+	require.Equal(t, http.StatusConflict, res.StatusCode, "a tournament can't start without players")
+
+	for _, id := range playerIDs {
+		res := call(id, "POST", path+"/register", nil)
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	}
+	res = call(playerIDs[1], "POST", path+"/register", nil)
+	res.Body.Close()
+	require.Equal(t, http.StatusConflict, res.StatusCode)
+
+	res = call(playerIDs[1], "POST", path+"/start", nil)
+	res.Body.Close()
+	require.Equal(t, http.StatusForbidden, res.StatusCode, "only the creator can start the tournament")
+
+	res = call(playerIDs[0], "POST", path+"/start", nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	tournament = decode(res)
+	require.Equal(t, models.TournamentInProgress, tournament.Status)
+	require.Len(t, tournament.Matches, 3)
+
+	// Plays a match out with the player in the first slot winning
+	play := func(match models.TournamentMatch) int64 {
+		winner, loser := match.Players[0], match.Players[1]
+		for i, id := range match.Players {
+			msg := readUntil(conns[id], ws.ServerMsgTournamentMatch)
+			var ready ws.TournamentMatchReadyPayload
+			require.NoError(t, json.Unmarshal(msg.Payload, &ready))
+			require.Equal(t, tournament.ID, ready.TournamentID)
+			require.Equal(t, match.Number, ready.Match)
+			require.Equal(t, match.Players[1-i], ready.OpponentID)
+			require.Equal(t, match.SessionID, ready.SessionID)
+		}
+
+		session, err := services.GameManager.GetGame(match.SessionID)
+		require.NoError(t, err)
+		require.Equal(t, &models.TournamentLink{TournamentID: tournament.ID, Match: match.Number}, session.Tournament)
+
+		sub := ws.SubmissionPayload{
+			ID:        int64(match.Number),
+			ProblemID: session.Problem.ID,
+			Status:    models.Accepted,
+			Language:  models.Python3,
+			Time:      time.Now(),
+		}
+		require.NoError(t, conns[winner].WriteJSON(ws.Message{Type: ws.ClientMsgSubmission, Payload: ws.MarshalPayload(sub)}))
+		for _, id := range []int64{winner, loser} {
+			msg := readUntil(conns[id], ws.ServerMsgGameOver)
+			var end ws.GameOverPayload
+			require.NoError(t, json.Unmarshal(msg.Payload, &end))
+			require.Equal(t, winner, end.WinnerID)
+		}
+		return winner
+	}
+
+	// Equal ratings seed in registration order, so the top seed meets the bottom seed
+	require.Equal(t, [2]int64{playerIDs[0], playerIDs[3]}, tournament.Matches[0].Players)
+	require.Equal(t, [2]int64{playerIDs[1], playerIDs[2]}, tournament.Matches[1].Players)
+	semiWinners := [2]int64{play(tournament.Matches[0]), play(tournament.Matches[1])}
+
+	res = call(playerIDs[3], "GET", path, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	tournament = decode(res)
+	final := tournament.Matches[2]
+	require.Equal(t, semiWinners, final.Players)
+	require.NotEmpty(t, final.SessionID, "the final starts once both semi-finals are decided")
+
+	champion := play(final)
+	tournament = decode(call(playerIDs[3], "GET", path, nil))
+	require.Equal(t, models.TournamentFinished, tournament.Status)
+	require.Equal(t, champion, tournament.Winner)
+	require.NotNil(t, tournament.EndTime)
+
+	match, err := store.DataStore.GetMatch(uuid.MustParse(final.SessionID))
+	require.NoError(t, err)
+	require.Equal(t, &models.TournamentLink{TournamentID: tournament.ID, Match: final.Number}, match.Tournament)
+}
+
+func TestLeagueFlow(t *testing.T) {
+	playerIDs := []int64{80014, 80015, 80016} // Nils, Olga, Pablo
+	conns := map[int64]*websocket.Conn{}
+	for _, id := range playerIDs {
+		c := dialWS(t, id)
+		defer c.Close()
+		conns[id] = c
+	}
+
+	call := func(userID int64, method, path string, body any) *http.Response {
+		token, err := services.GenerateJWT(userID)
+		require.NoError(t, err)
+		var reader io.Reader
+		if body != nil {
+			b, err := json.Marshal(body)
+			require.NoError(t, err)
+			reader = strings.NewReader(string(b))
+		}
+		req, err := http.NewRequest(method, ts.URL+"/api/v1/leagues"+path, reader)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		return res
+	}
+	decode := func(res *http.Response, v any) {
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.NoError(t, json.NewDecoder(res.Body).Decode(v))
+	}
+
+	create := models.CreateLeagueRequest{
+		Name:         "Weekly Round Robin",
+		Format:       models.RoundRobin,
+		MatchDetails: models.MatchDetails{Difficulties: []models.Difficulty{models.Easy}},
+		RoundHours:   1,
+	}
+	res := call(playerIDs[0], "POST", "", create)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	var league models.League
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&league))
+	res.Body.Close()
+	path := fmt.Sprintf("/%d", league.ID)
+
+	for _, id := range playerIDs {
+		res := call(id, "POST", path+"/register", nil)
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	}
+	decode(call(playerIDs[0], "POST", path+"/start", nil), &league)
+	require.Equal(t, models.LeagueInProgress, league.Status)
+	require.Equal(t, 3, league.Rounds, "three players need a round each to sit out")
+	require.Equal(t, 1, league.CurrentRound)
+	require.Len(t, league.Fixtures, 2)
+
+	var fixture, bye models.LeagueFixture
+	for _, f := range league.Fixtures {
+		if f.Status == models.FixtureBye {
+			bye = f
+		} else {
+			fixture = f
+		}
+	}
+	require.Equal(t, models.FixtureScheduled, fixture.Status)
+	inviterID, inviteeID, byeID := fixture.Players[0], fixture.Players[1], bye.Players[0]
+	inviter, invitee := conns[inviterID], conns[inviteeID]
+
+	for i, id := range fixture.Players {
+		msg := readMessage(t, conns[id])
+		require.Equal(t, ws.ServerMsgLeagueFixture, msg.Type)
+		var paired ws.LeagueFixturePayload
+		require.NoError(t, json.Unmarshal(msg.Payload, &paired))
+		require.Equal(t, league.ID, paired.LeagueID)
+		require.Equal(t, fixture.Number, paired.Fixture)
+		require.Equal(t, fixture.Players[1-i], paired.OpponentID)
+		require.WithinDuration(t, time.Now().Add(time.Hour), paired.Deadline, time.Minute)
+	}
+
+	link := &models.LeagueLink{LeagueID: league.ID, Fixture: fixture.Number}
+	sendInvite := func(c *websocket.Conn, inviteeID int64) {
+		p := ws.SendInvitationPayload{
+			InviteeID:    inviteeID,
+			MatchDetails: models.MatchDetails{Difficulties: []models.Difficulty{models.Hard}},
+			League:       link,
+		}
+		require.NoError(t, c.WriteJSON(ws.Message{Type: ws.ClientMsgSendInvitation, Payload: ws.MarshalPayload(p)}))
+	}
+
+	// Only the paired players can play the fixture
+	sendInvite(conns[byeID], inviterID)
+	msg := readMessage(t, conns[byeID])
+	require.Equal(t, ws.ServerMsgError, msg.Type)
+	var errPayload ws.ErrorPayload
+	require.NoError(t, json.Unmarshal(msg.Payload, &errPayload))
+	require.Equal(t, "invalid_fixture", errPayload.Code)
+
+	sendInvite(inviter, inviteeID)
+	msg = readMessage(t, invitee)
+	require.Equal(t, ws.ServerMsgInvitationRequest, msg.Type)
+	var request ws.InvitationRequestPayload
+	require.NoError(t, json.Unmarshal(msg.Payload, &request))
+	require.Equal(t, link, request.League)
+	require.Equal(t, create.MatchDetails, request.MatchDetails, "fixtures are played with the league's details")
+
+	accept := ws.AcceptInvitationPayload{InviterID: inviterID}
+	require.NoError(t, invitee.WriteJSON(ws.Message{Type: ws.ClientMsgAcceptInvitation, Payload: ws.MarshalPayload(accept)}))
+	var start ws.StartGamePayload
+	for _, c := range []*websocket.Conn{inviter, invitee} {
+		msg := readMessage(t, c)
+		require.Equal(t, ws.ServerMsgStartGame, msg.Type)
+		require.NoError(t, json.Unmarshal(msg.Payload, &start))
+		require.Equal(t, link, start.League)
+	}
+
+	session, err := services.GameManager.GetGame(start.SessionID)
+	require.NoError(t, err)
+	sub := ws.SubmissionPayload{
+		ID:        1,
+		ProblemID: session.Problem.ID,
+		Status:    models.Accepted,
+		Language:  models.Python3,
+		Time:      time.Now(),
+	}
+	require.NoError(t, inviter.WriteJSON(ws.Message{Type: ws.ClientMsgSubmission, Payload: ws.MarshalPayload(sub)}))
+	require.Equal(t, ws.ServerMsgGameOver, readMessage(t, inviter).Type)
+
+	// The result is recorded once the match is stored, just after game_over is sent
+	var table models.LeagueStandingsResponse
+	require.Eventually(t, func() bool {
+		decode(call(byeID, "GET", path+"/standings", nil), &table)
+		return table.League.Fixtures[fixture.Number-1].Status == models.FixturePlayed
+	}, 2*time.Second, 50*time.Millisecond)
+	require.Equal(t, inviterID, table.League.Fixtures[fixture.Number-1].Winner)
+
+	points := map[int64]int{}
+	for _, s := range table.Standings {
+		points[s.UserID] = s.Points
+	}
+	require.Equal(t, map[int64]int{inviterID: 3, byeID: 3, inviteeID: 0}, points)
+	require.Equal(t, inviteeID, table.Standings[2].UserID)
+
+	match, err := store.DataStore.GetMatch(uuid.MustParse(start.SessionID))
+	require.NoError(t, err)
+	require.Equal(t, link, match.League)
+}
+
+func TestPrivateLobby(t *testing.T) {
+	hostID := int64(80017)  // Quinn
+	guestID := int64(80018) // Rosa
+	otherID := int64(80019) // Sven
+
+	host := dialWS(t, hostID)
+	defer host.Close()
+	guest := dialWS(t, guestID)
+	defer func() { guest.Close() }()
+	other := dialWS(t, otherID)
+	defer other.Close()
+
+	send := func(c *websocket.Conn, msgType string, payload any) {
+		require.NoError(t, c.WriteJSON(ws.Message{Type: msgType, Payload: ws.MarshalPayload(payload)}))
+	}
+	readLobby := func(c *websocket.Conn) models.Lobby {
+		msg := readMessage(t, c)
+		require.Equal(t, ws.ServerMsgLobbyUpdate, msg.Type)
+		var l models.Lobby
+		require.NoError(t, json.Unmarshal(msg.Payload, &l))
+		return l
+	}
+	requireError := func(c *websocket.Conn, code string) {
+		msg := readMessage(t, c)
+		require.Equal(t, ws.ServerMsgError, msg.Type)
+		var errPayload ws.ErrorPayload
+		require.NoError(t, json.Unmarshal(msg.Payload, &errPayload))
+		require.Equal(t, code, errPayload.Code)
+	}
+
+	send(guest, ws.ClientMsgJoinLobby, ws.JoinLobbyPayload{Code: "ZZZZZZ"})
+	requireError(guest, "lobby_not_found")
+
+	details := models.MatchDetails{Difficulties: []models.Difficulty{models.Easy}}
+	send(host, ws.ClientMsgCreateLobby, ws.CreateLobbyPayload{MatchDetails: details})
+	lobby := readLobby(host)
+	require.Len(t, lobby.Code, 6)
+	require.Equal(t, hostID, lobby.HostID)
+
+	// Codes can be typed in any case
+	send(guest, ws.ClientMsgJoinLobby, ws.JoinLobbyPayload{Code: strings.ToLower(lobby.Code)})
+	for _, c := range []*websocket.Conn{host, guest} {
+		require.Equal(t, []int64{hostID, guestID}, readLobby(c).MemberIDs())
+	}
+
+	send(guest, ws.ClientMsgStartLobby, nil)
+	requireError(guest, "not_lobby_host")
+
+	send(other, ws.ClientMsgJoinLobby, ws.JoinLobbyPayload{Code: lobby.Code})
+	for _, c := range []*websocket.Conn{host, guest, other} {
+		readLobby(c)
+	}
+	send(other, ws.ClientMsgLeaveLobby, nil)
+	for _, c := range []*websocket.Conn{host, guest} {
+		require.Equal(t, []int64{hostID, guestID}, readLobby(c).MemberIDs())
+	}
+	msg := readMessage(t, other)
+	require.Equal(t, ws.ServerMsgLobbyLeft, msg.Type)
+
+	details.Difficulties = []models.Difficulty{models.Medium}
+	send(host, ws.ClientMsgUpdateLobby, ws.UpdateLobbyPayload{MatchDetails: details})
+	for _, c := range []*websocket.Conn{host, guest} {
+		require.Equal(t, details.Difficulties, readLobby(c).MatchDetails.Difficulties)
+	}
+
+	// A member who drops out keeps their place if they come back in time
+	guest.Close()
+	lobby = readLobby(host)
+	require.True(t, lobby.Members[1].Away)
+	guest = dialWS(t, guestID)
+	for _, c := range []*websocket.Conn{host, guest} {
+		lobby = readLobby(c)
+		require.False(t, lobby.Members[1].Away)
+	}
+
+	send(host, ws.ClientMsgStartLobby, nil)
+	for _, c := range []*websocket.Conn{host, guest} {
+		msg := readMessage(t, c)
+		require.Equal(t, ws.ServerMsgStartGame, msg.Type)
+	}
+
+	// The lobby closes once its game starts
+	send(other, ws.ClientMsgJoinLobby, ws.JoinLobbyPayload{Code: lobby.Code})
+	requireError(other, "lobby_not_found")
+}
+
+func TestRematch(t *testing.T) {
+	player1ID := int64(80019) // Sven
+	player2ID := int64(80020) // Tara
+
+	player1 := dialWS(t, player1ID)
+	defer player1.Close()
+	player2 := dialWS(t, player2ID)
+	defer player2.Close()
+
+	send := func(c *websocket.Conn, msgType string, payload any) {
+		require.NoError(t, c.WriteJSON(ws.Message{Type: msgType, Payload: ws.MarshalPayload(payload)}))
+	}
+	requireError := func(c *websocket.Conn, code string) {
+		msg := readMessage(t, c)
+		require.Equal(t, ws.ServerMsgError, msg.Type)
+		var errPayload ws.ErrorPayload
+		require.NoError(t, json.Unmarshal(msg.Payload, &errPayload))
+		require.Equal(t, code, errPayload.Code)
+	}
+	forfeit := func() {
+		send(player1, ws.ClientMsgForfeit, nil)
+		require.Equal(t, ws.ServerMsgGameOver, readMessage(t, player1).Type)
+		require.Equal(t, ws.ServerMsgGameOver, readMessage(t, player2).Type)
+	}
+
+	details := models.MatchDetails{Difficulties: []models.Difficulty{models.Easy}, TimeLimit: 20}
+	start := startInvitedGame(t, player1, player2, player1ID, player2ID, details)
+
+	send(player1, ws.ClientMsgRequestRematch, ws.RequestRematchPayload{SessionID: start.SessionID})
+	requireError(player1, "game_in_progress")
+	forfeit()
+
+	send(player2, ws.ClientMsgAcceptRematch, ws.AcceptRematchPayload{SessionID: start.SessionID})
+	requireError(player2, "rematch_not_requested")
+
+	send(player1, ws.ClientMsgRequestRematch, ws.RequestRematchPayload{SessionID: start.SessionID, NewProblem: true})
+	msg := readMessage(t, player2)
+	require.Equal(t, ws.ServerMsgRematchRequested, msg.Type)
+	var requested ws.RematchRequestedPayload
+	require.NoError(t, json.Unmarshal(msg.Payload, &requested))
+	require.Equal(t, player1ID, requested.PlayerID)
+	require.True(t, requested.NewProblem)
+
+	send(player2, ws.ClientMsgAcceptRematch, ws.AcceptRematchPayload{SessionID: start.SessionID})
+	var rematch ws.StartGamePayload
+	for _, c := range []*websocket.Conn{player1, player2} {
+		msg := readMessage(t, c)
+		require.Equal(t, ws.ServerMsgStartGame, msg.Type)
+		require.NoError(t, json.Unmarshal(msg.Payload, &rematch))
+	}
+	require.NotEqual(t, start.SessionID, rematch.SessionID)
+
+	session, err := services.GameManager.GetGame(rematch.SessionID)
+	require.NoError(t, err)
+	require.Equal(t, details.TimeLimit, session.MatchDetails.TimeLimit)
+	require.Equal(t, models.Easy, session.Problem.Difficulty)
+	forfeit()
+
+	// The request was used up by the rematch
+	send(player2, ws.ClientMsgAcceptRematch, ws.AcceptRematchPayload{SessionID: start.SessionID})
+	requireError(player2, "rematch_not_requested")
+}
+
+func TestGhostRace(t *testing.T) {
+	player1ID := int64(80019) // Sven
+	player2ID := int64(80020) // Tara
+
+	player1 := dialWS(t, player1ID)
+	defer player1.Close()
+	player2 := dialWS(t, player2ID)
+	defer player2.Close()
+
+	send := func(msgType string, payload any) {
+		require.NoError(t, player1.WriteJSON(ws.Message{Type: msgType, Payload: ws.MarshalPayload(payload)}))
+	}
+	requireError := func(code string) {
+		msg := readMessage(t, player1)
+		require.Equal(t, ws.ServerMsgError, msg.Type)
+		var errPayload ws.ErrorPayload
+		require.NoError(t, json.Unmarshal(msg.Payload, &errPayload))
+		require.Equal(t, code, errPayload.Code)
+	}
+
+	details := models.MatchDetails{Difficulties: []models.Difficulty{models.Easy}}
+	start := startInvitedGame(t, player1, player2, player1ID, player2ID, details)
+	send(ws.ClientMsgForfeit, nil)
+	require.Equal(t, ws.ServerMsgGameOver, readMessage(t, player1).Type)
+	require.Equal(t, ws.ServerMsgGameOver, readMessage(t, player2).Type)
+	require.Eventually(t, func() bool {
+		match, err := store.DataStore.GetMatch(uuid.MustParse(start.SessionID))
+		return err == nil && match != nil
+	}, 5*time.Second, 100*time.Millisecond)
+
+	send(ws.ClientMsgStartGhostRace, ws.StartGhostRacePayload{MatchID: uuid.NewString(), PlayerID: player2ID})
+	requireError("match_not_found")
+	send(ws.ClientMsgStartGhostRace, ws.StartGhostRacePayload{MatchID: start.SessionID, PlayerID: 1})
+	requireError("ghost_not_found")
+
+	send(ws.ClientMsgStartGhostRace, ws.StartGhostRacePayload{MatchID: start.SessionID, PlayerID: player2ID})
+	msg := readMessage(t, player1)
+	require.Equal(t, ws.ServerMsgStartGame, msg.Type)
+	var race ws.StartGamePayload
+	require.NoError(t, json.Unmarshal(msg.Payload, &race))
+	require.NotNil(t, race.Ghost)
+	require.Equal(t, player2ID, race.Ghost.PlayerID)
+	require.Equal(t, -1, race.Ghost.Finish, "the ghost never submitted")
+
+	// Giving up hands the race to the ghost, and the race isn't stored
+	send(ws.ClientMsgForfeit, nil)
+	msg = readMessage(t, player1)
+	require.Equal(t, ws.ServerMsgGameOver, msg.Type)
+	var over ws.GameOverPayload
+	require.NoError(t, json.Unmarshal(msg.Payload, &over))
+	require.Equal(t, player2ID, over.WinnerID)
+	require.Empty(t, over.RatingChanges)
+
+	match, err := store.DataStore.GetMatch(uuid.MustParse(race.SessionID))
+	require.NoError(t, err)
+	require.Nil(t, match)
+}
+
+func TestPlacementMatch(t *testing.T) {
+	require.Equal(t, 5, config.GetConfig().PLACEMENT_GAMES, "placement is on outside withoutPlacement")
+	player1ID := int64(90001)
+	player2ID := int64(90002)
+	spectatorID := int64(90003)
+	for i, id := range []int64{player1ID, player2ID, spectatorID} {
+		require.NoError(t, store.DataStore.SaveOAuthUser(id, "dummy-token", fmt.Sprintf("newcomer%d", i+1), "0001", ""))
+	}
+
+	player1 := dialWS(t, player1ID)
+	defer player1.Close()
+	player2 := dialWS(t, player2ID)
+	defer player2.Close()
+	spectator := dialWS(t, spectatorID)
+	defer spectator.Close()
+
+	details := models.MatchDetails{IsRated: true, Difficulties: []models.Difficulty{models.Easy}}
+	start := startInvitedGame(t, player1, player2, player1ID, player2ID, details)
+	spectate := ws.SpectatePayload{SessionID: start.SessionID}
+	require.NoError(t, spectator.WriteJSON(ws.Message{Type: ws.ClientMsgSpectate, Payload: ws.MarshalPayload(spectate)}))
+	require.Equal(t, ws.ServerMsgSpectating, readMessage(t, spectator).Type)
+
+	require.NoError(t, player1.WriteJSON(ws.Message{Type: ws.ClientMsgForfeit}))
+	gameOver := func(c *websocket.Conn) []models.RatingChange {
+		msg := readMessage(t, c)
+		require.Equal(t, ws.ServerMsgGameOver, msg.Type)
+		var end ws.GameOverPayload
+		require.NoError(t, json.Unmarshal(msg.Payload, &end))
+		return end.RatingChanges
+	}
+
+	own := gameOver(player2)
+	require.Len(t, own, 1)
+	require.Equal(t, player2ID, own[0].PlayerID)
+	require.Equal(t, 32, own[0].Change, "placement matches use the larger K factor")
+	require.Equal(t, 1032, own[0].NewRating, "players see their own rating")
+	require.Zero(t, own[0].OpponentRating, "the opponent is in placement too")
+	require.True(t, own[0].Provisional)
+	require.Len(t, gameOver(player1), 1)
+
+	public := gameOver(spectator)
+	require.Len(t, public, 2)
+	for _, change := range public {
+		require.True(t, change.Provisional)
+		require.Zero(t, change.OldRating)
+		require.Zero(t, change.NewRating)
+		require.Equal(t, 32, max(change.Change, -change.Change))
+	}
+	time.Sleep(100 * time.Millisecond) // match is stored after game_over is sent
+
+	get := func(viewerID int64, path string, out any) {
+		token, err := services.GenerateJWT(viewerID)
+		require.NoError(t, err)
+		req, err := http.NewRequest("GET", ts.URL+"/api/v1/users/"+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.NoError(t, json.NewDecoder(res.Body).Decode(out))
+	}
+
+	var profile models.UserInfoResponse
+	get(player1ID, "90002", &profile)
+	require.True(t, profile.Provisional)
+	require.Zero(t, profile.Rating)
+	require.Nil(t, profile.SkillRatings, "skill ratings are hidden during placement")
+
+	var history []models.RatingHistoryEntry
+	get(player1ID, "90002/rating-history", &history)
+	require.Empty(t, history, "history is hidden from others during placement")
+	get(player2ID, "90002/rating-history", &history)
+	require.Len(t, history, 1)
+	require.Equal(t, 1032, history[0].NewRating)
+
+	_, ranked, err := services.Leaderboard.Rank(models.LeaderboardFilter{}, player2ID)
+	require.NoError(t, err)
+	require.False(t, ranked, "players in placement are left off the leaderboard")
+}
@@ -0,0 +1,4 @@
+ALTER TABLE users
+  DROP COLUMN IF EXISTS rating_deviation,
+  DROP COLUMN IF EXISTS volatility,
+  DROP COLUMN IF EXISTS last_rated_at;
@@ -0,0 +1,4 @@
+ALTER TABLE users
+  ADD COLUMN rating_deviation REAL NOT NULL DEFAULT 350,
+  ADD COLUMN volatility       REAL NOT NULL DEFAULT 0.06,
+  ADD COLUMN last_rated_at    TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,11 @@
+CREATE TABLE rating_history (
+    user_id         BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    match_id        UUID NOT NULL REFERENCES matches(id) ON DELETE CASCADE,
+    old_rating      SMALLINT NOT NULL,
+    new_rating      SMALLINT NOT NULL,
+    opponent_rating SMALLINT NOT NULL,
+    created_at      TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (user_id, match_id)
+);
+
+CREATE INDEX rating_history_user_time_idx ON rating_history (user_id, created_at);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS user_tag_ratings;
+DROP TABLE IF EXISTS user_difficulty_ratings;
@@ -0,0 +1,13 @@
+CREATE TABLE user_difficulty_ratings (
+    user_id    BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    difficulty problem_difficulty NOT NULL,
+    rating     SMALLINT NOT NULL DEFAULT 1000,
+    PRIMARY KEY (user_id, difficulty)
+);
+
+CREATE TABLE user_tag_ratings (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    tag_id  INT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    rating  SMALLINT NOT NULL DEFAULT 1000,
+    PRIMARY KEY (user_id, tag_id)
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS season_standings;
+ALTER TABLE matches DROP COLUMN IF EXISTS season_id;
+DROP TABLE IF EXISTS seasons;
@@ -0,0 +1,20 @@
+CREATE TABLE seasons (
+    id          SERIAL PRIMARY KEY,
+    name        TEXT NOT NULL,
+    start_time  TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_time    TIMESTAMP WITH TIME ZONE NOT NULL,
+    reset_at    TIMESTAMP WITH TIME ZONE, -- Set once ratings were soft reset for this season
+    archived_at TIMESTAMP WITH TIME ZONE, -- Set once final standings were saved
+    CHECK (end_time > start_time)
+);
+
+ALTER TABLE matches ADD COLUMN season_id INT REFERENCES seasons(id) ON DELETE SET NULL;
+
+CREATE TABLE season_standings (
+    season_id    INT NOT NULL REFERENCES seasons(id) ON DELETE CASCADE,
+    user_id      BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    rank         INT NOT NULL,
+    rating       SMALLINT NOT NULL,
+    games_played INT NOT NULL,
+    PRIMARY KEY (season_id, user_id)
+);
@@ -0,0 +1,2 @@
+DELETE FROM season_standings WHERE season_id = 1;
+DELETE FROM seasons WHERE id = 1;
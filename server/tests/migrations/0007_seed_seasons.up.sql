@@ -0,0 +1,10 @@
+-- A finished season with archived standings
+INSERT INTO seasons (id, name, start_time, end_time, reset_at, archived_at) VALUES
+  (1, 'Preseason', now() - INTERVAL '120 days', now() - INTERVAL '30 days',
+   now() - INTERVAL '120 days', now() - INTERVAL '30 days');
+
+SELECT setval('seasons_id_seq', 1);
+
+INSERT INTO season_standings (season_id, user_id, rank, rating, games_played) VALUES
+  (1, 9001, 1, 1200, 2),
+  (1, 9002, 2, 1150, 2);
@@ -0,0 +1,7 @@
+ALTER TABLE users ADD COLUMN games_played INT NOT NULL DEFAULT 0;
+
+UPDATE users u SET games_played = (
+    SELECT COUNT(*) FROM match_players mp
+    JOIN matches m ON m.id = mp.match_id
+    WHERE mp.player_id = u.id AND m.is_rated
+);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS audit_log;
+ALTER TABLE matches
+  DROP COLUMN IF EXISTS reverted_by,
+  DROP COLUMN IF EXISTS reverted_at,
+  DROP COLUMN IF EXISTS revert_reason;
@@ -0,0 +1,13 @@
+ALTER TABLE matches
+  ADD COLUMN reverted_by   BIGINT REFERENCES users(id) ON DELETE SET NULL,
+  ADD COLUMN reverted_at   TIMESTAMP WITH TIME ZONE,
+  ADD COLUMN revert_reason TEXT;
+
+CREATE TABLE audit_log (
+    id         BIGSERIAL PRIMARY KEY,
+    actor_id   BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    action     TEXT NOT NULL,
+    target_id  TEXT NOT NULL,
+    details    JSONB,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
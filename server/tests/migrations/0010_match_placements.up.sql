@@ -0,0 +1,7 @@
+ALTER TABLE match_players ADD COLUMN placement SMALLINT;
+
+-- Matches before free-for-all only had a winner and a loser
+UPDATE match_players mp
+SET placement = CASE WHEN mp.player_id = m.winner_id THEN 1 ELSE 2 END
+FROM matches m
+WHERE m.id = mp.match_id AND m.winner_id IS NOT NULL AND m.winner_id <> 0;
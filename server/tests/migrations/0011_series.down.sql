@@ -0,0 +1,3 @@
+ALTER TABLE matches DROP COLUMN IF EXISTS series_id;
+DROP TABLE IF EXISTS series_players;
+DROP TABLE IF EXISTS series;
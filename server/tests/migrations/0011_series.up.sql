@@ -0,0 +1,19 @@
+CREATE TABLE series (
+    id         UUID PRIMARY KEY,
+    target     SMALLINT NOT NULL,
+    is_rated   BOOLEAN NOT NULL,
+    winner_id  BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    start_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_time   TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE TABLE series_players (
+    series_id UUID NOT NULL REFERENCES series(id) ON DELETE CASCADE,
+    player_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    wins      SMALLINT NOT NULL,
+    PRIMARY KEY (series_id, player_id)
+);
+
+CREATE INDEX series_players_player_idx ON series_players (player_id);
+
+ALTER TABLE matches ADD COLUMN series_id UUID REFERENCES series(id) ON DELETE SET NULL;
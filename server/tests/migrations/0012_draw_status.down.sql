@@ -0,0 +1,7 @@
+-- Postgres cannot drop enum values, so rebuild the type without them
+UPDATE matches SET status = 'Canceled' WHERE status IN ('Active', 'Draw');
+
+ALTER TYPE match_status RENAME TO match_status_old;
+CREATE TYPE match_status AS ENUM ('Won', 'Canceled', 'Reverted');
+ALTER TABLE matches ALTER COLUMN status TYPE match_status USING status::text::match_status;
+DROP TYPE match_status_old;
@@ -0,0 +1,2 @@
+ALTER TYPE match_status ADD VALUE IF NOT EXISTS 'Active';
+ALTER TYPE match_status ADD VALUE IF NOT EXISTS 'Draw';
@@ -0,0 +1,2 @@
+ALTER TABLE match_players DROP COLUMN IF EXISTS score;
+ALTER TABLE matches DROP COLUMN IF EXISTS scoring_mode;
@@ -0,0 +1,4 @@
+ALTER TABLE matches ADD COLUMN scoring_mode TEXT NOT NULL DEFAULT 'standard';
+
+-- Breakdown of how the player was scored, for matches not decided by the first Accepted submission
+ALTER TABLE match_players ADD COLUMN score JSONB;
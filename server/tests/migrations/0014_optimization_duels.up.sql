@@ -0,0 +1,2 @@
+-- Percentile an optimization duel was ranked by; NULL for other scoring modes
+ALTER TABLE matches ADD COLUMN optimize_for TEXT;
@@ -0,0 +1 @@
+DELETE FROM users WHERE id BETWEEN 80001 AND 80020;
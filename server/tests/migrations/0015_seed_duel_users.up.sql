@@ -0,0 +1,26 @@
+-- More players for websocket tests, which each need players that aren't in a game
+INSERT INTO users (
+  id, username, discriminator, lc_username, access_token,
+  created_at, updated_at, rating
+) VALUES
+  (80001, 'amara', '0001', 'amara_lc', 'dummy-token', now(), now(), 1000),
+  (80002, 'bruno', '0001', 'bruno_lc', 'dummy-token', now(), now(), 1000),
+  (80003, 'celia', '0001', 'celia_lc', 'dummy-token', now(), now(), 1000),
+  (80004, 'dmitri', '0001', 'dmitri_lc', 'dummy-token', now(), now(), 1000),
+  (80005, 'elena', '0001', 'elena_lc', 'dummy-token', now(), now(), 1000),
+  (80006, 'felix', '0001', 'felix_lc', 'dummy-token', now(), now(), 1000),
+  (80007, 'greta', '0001', 'greta_lc', 'dummy-token', now(), now(), 1000),
+  (80008, 'hugo', '0001', 'hugo_lc', 'dummy-token', now(), now(), 1000),
+  (80009, 'ingrid', '0001', 'ingrid_lc', 'dummy-token', now(), now(), 1000),
+  (80010, 'jonas', '0001', 'jonas_lc', 'dummy-token', now(), now(), 1000),
+  (80011, 'kira', '0001', 'kira_lc', 'dummy-token', now(), now(), 1000),
+  (80012, 'leon', '0001', 'leon_lc', 'dummy-token', now(), now(), 1000),
+  (80013, 'mira', '0001', 'mira_lc', 'dummy-token', now(), now(), 1000),
+  (80014, 'nils', '0001', 'nils_lc', 'dummy-token', now(), now(), 1000),
+  (80015, 'olga', '0001', 'olga_lc', 'dummy-token', now(), now(), 1000),
+  (80016, 'pablo', '0001', 'pablo_lc', 'dummy-token', now(), now(), 1000),
+  (80017, 'quinn', '0001', 'quinn_lc', 'dummy-token', now(), now(), 1000),
+  (80018, 'rosa', '0001', 'rosa_lc', 'dummy-token', now(), now(), 1000),
+  (80019, 'sven', '0001', 'sven_lc', 'dummy-token', now(), now(), 1000),
+  (80020, 'tara', '0001', 'tara_lc', 'dummy-token', now(), now(), 1000)
+ON CONFLICT (id) DO NOTHING;
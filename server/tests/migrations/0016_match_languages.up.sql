@@ -0,0 +1,2 @@
+-- Languages a match was restricted to; NULL when any language was allowed
+ALTER TABLE matches ADD COLUMN languages TEXT[];
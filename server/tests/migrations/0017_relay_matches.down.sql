@@ -0,0 +1,3 @@
+ALTER TABLE submissions DROP COLUMN IF EXISTS problem_id;
+ALTER TABLE match_players DROP COLUMN IF EXISTS problems_solved;
+DROP TABLE IF EXISTS match_problems;
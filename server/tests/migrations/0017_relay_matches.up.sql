@@ -0,0 +1,10 @@
+-- Every problem of a relay in the order it was solved; matches.problem_id holds the first
+CREATE TABLE match_problems (
+    match_id   UUID NOT NULL REFERENCES matches(id) ON DELETE CASCADE,
+    position   SMALLINT NOT NULL,
+    problem_id INTEGER NOT NULL REFERENCES problems(id),
+    PRIMARY KEY (match_id, position)
+);
+
+ALTER TABLE match_players ADD COLUMN problems_solved SMALLINT;
+ALTER TABLE submissions ADD COLUMN problem_id INTEGER REFERENCES problems(id);
@@ -0,0 +1,5 @@
+ALTER TABLE matches DROP COLUMN IF EXISTS tournament_match;
+ALTER TABLE matches DROP COLUMN IF EXISTS tournament_id;
+DROP TABLE IF EXISTS tournament_matches;
+DROP TABLE IF EXISTS tournament_players;
+DROP TABLE IF EXISTS tournaments;
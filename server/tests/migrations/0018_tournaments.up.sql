@@ -0,0 +1,43 @@
+CREATE TABLE tournaments (
+    id            SERIAL PRIMARY KEY,
+    name          TEXT NOT NULL,
+    format        TEXT NOT NULL,
+    status        TEXT NOT NULL DEFAULT 'registration',
+    match_details JSONB NOT NULL,
+    created_by    BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    winner_id     BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    start_time    TIMESTAMP WITH TIME ZONE,
+    end_time      TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE tournament_players (
+    tournament_id INT NOT NULL REFERENCES tournaments(id) ON DELETE CASCADE,
+    user_id       BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    seed          SMALLINT, -- Set when the tournament starts
+    rating        SMALLINT, -- Rating the player was seeded by
+    registered_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (tournament_id, user_id)
+);
+
+-- Each match points to the match its winner, and in double elimination its loser, moves on to
+CREATE TABLE tournament_matches (
+    tournament_id INT NOT NULL REFERENCES tournaments(id) ON DELETE CASCADE,
+    number        SMALLINT NOT NULL,
+    bracket       TEXT NOT NULL,
+    round         SMALLINT NOT NULL,
+    player1_id    BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    player2_id    BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    winner_id     BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    decided       BOOLEAN NOT NULL DEFAULT FALSE,
+    session_id    UUID, -- The session currently deciding the match; not stored in matches until it ends
+    winner_to     SMALLINT,
+    winner_slot   SMALLINT,
+    loser_to      SMALLINT,
+    loser_slot    SMALLINT,
+    PRIMARY KEY (tournament_id, number)
+);
+
+-- Set on matches that decided (or drew and replayed) a tournament match
+ALTER TABLE matches ADD COLUMN tournament_id INT REFERENCES tournaments(id) ON DELETE SET NULL;
+ALTER TABLE matches ADD COLUMN tournament_match SMALLINT;
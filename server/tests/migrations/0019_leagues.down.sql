@@ -0,0 +1,5 @@
+ALTER TABLE matches DROP COLUMN IF EXISTS league_fixture;
+ALTER TABLE matches DROP COLUMN IF EXISTS league_id;
+DROP TABLE IF EXISTS league_fixtures;
+DROP TABLE IF EXISTS league_players;
+DROP TABLE IF EXISTS leagues;
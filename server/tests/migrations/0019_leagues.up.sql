@@ -0,0 +1,44 @@
+CREATE TABLE leagues (
+    id            SERIAL PRIMARY KEY,
+    name          TEXT NOT NULL,
+    format        TEXT NOT NULL,
+    status        TEXT NOT NULL DEFAULT 'registration',
+    match_details JSONB NOT NULL,
+    created_by    BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    rounds        SMALLINT NOT NULL DEFAULT 0,
+    round_hours   SMALLINT NOT NULL,
+    current_round SMALLINT NOT NULL DEFAULT 0,
+    next_round_at TIMESTAMP WITH TIME ZONE, -- When the current round closes and the next is paired
+    created_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    start_time    TIMESTAMP WITH TIME ZONE,
+    end_time      TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_leagues_next_round ON leagues (next_round_at) WHERE status = 'in_progress';
+
+CREATE TABLE league_players (
+    league_id     INT NOT NULL REFERENCES leagues(id) ON DELETE CASCADE,
+    user_id       BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    rating        SMALLINT, -- Rating when the league started
+    registered_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (league_id, user_id)
+);
+
+CREATE TABLE league_fixtures (
+    league_id    INT NOT NULL REFERENCES leagues(id) ON DELETE CASCADE,
+    number       SMALLINT NOT NULL,
+    round        SMALLINT NOT NULL,
+    player1_id   BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    player2_id   BIGINT REFERENCES users(id) ON DELETE SET NULL, -- NULL for a bye
+    status       TEXT NOT NULL DEFAULT 'scheduled',
+    winner_id    BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    session_id   UUID, -- The session currently deciding the fixture; not stored in matches until it ends
+    requested1   BOOLEAN NOT NULL DEFAULT FALSE,
+    requested2   BOOLEAN NOT NULL DEFAULT FALSE,
+    deadline     TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (league_id, number)
+);
+
+-- Set on matches that decided a league fixture
+ALTER TABLE matches ADD COLUMN league_id INT REFERENCES leagues(id) ON DELETE SET NULL;
+ALTER TABLE matches ADD COLUMN league_fixture SMALLINT;
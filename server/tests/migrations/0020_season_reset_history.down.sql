@@ -0,0 +1,9 @@
+DELETE FROM rating_history WHERE match_id IS NULL;
+DROP INDEX IF EXISTS rating_history_user_match_idx;
+ALTER TABLE rating_history
+  DROP COLUMN IF EXISTS season_id,
+  DROP COLUMN IF EXISTS reason,
+  DROP COLUMN IF EXISTS id,
+  ALTER COLUMN match_id SET NOT NULL,
+  ALTER COLUMN opponent_rating SET NOT NULL;
+ALTER TABLE rating_history ADD PRIMARY KEY (user_id, match_id);
@@ -0,0 +1,10 @@
+-- Season resets are recorded in rating history alongside matches
+ALTER TABLE rating_history DROP CONSTRAINT rating_history_pkey;
+ALTER TABLE rating_history
+  ADD COLUMN id        BIGSERIAL PRIMARY KEY,
+  ADD COLUMN reason    TEXT NOT NULL DEFAULT 'match',
+  ADD COLUMN season_id INT REFERENCES seasons(id) ON DELETE SET NULL, -- Set for season resets
+  ALTER COLUMN match_id DROP NOT NULL,
+  ALTER COLUMN opponent_rating DROP NOT NULL;
+
+CREATE UNIQUE INDEX rating_history_user_match_idx ON rating_history (user_id, match_id);
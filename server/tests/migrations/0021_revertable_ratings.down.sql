@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS skill_rating_history;
+ALTER TABLE rating_history
+  DROP COLUMN IF EXISTS old_last_rated_at,
+  DROP COLUMN IF EXISTS new_volatility,
+  DROP COLUMN IF EXISTS old_volatility,
+  DROP COLUMN IF EXISTS new_deviation,
+  DROP COLUMN IF EXISTS old_deviation;
@@ -0,0 +1,19 @@
+-- Rating state around each match, so reverting a match can undo everything it changed
+ALTER TABLE rating_history
+  ADD COLUMN old_deviation     REAL,
+  ADD COLUMN new_deviation     REAL,
+  ADD COLUMN old_volatility    REAL,
+  ADD COLUMN new_volatility    REAL,
+  ADD COLUMN old_last_rated_at TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE skill_rating_history (
+    user_id    BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    match_id   UUID NOT NULL REFERENCES matches(id) ON DELETE CASCADE,
+    difficulty problem_difficulty, -- Exactly one of difficulty and tag_id is set
+    tag_id     INT REFERENCES tags(id) ON DELETE CASCADE,
+    old_rating SMALLINT NOT NULL,
+    new_rating SMALLINT NOT NULL,
+    CHECK ((difficulty IS NULL) <> (tag_id IS NULL))
+);
+
+CREATE INDEX skill_rating_history_match_idx ON skill_rating_history (match_id);
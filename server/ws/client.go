@@ -3,6 +3,7 @@ package ws
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -71,7 +72,10 @@ func (c *Client) readPump() {
 		}
 
 		err = c.hub.HandleClientMessage(c, &env)
-		if err != nil {
+		var clientErr *ClientError
+		if errors.As(err, &clientErr) {
+			c.sendError(clientErr.Code, clientErr.Message)
+		} else if err != nil {
 			c.log.Error().Err(err).Str("message_type", string(env.Type)).Msg("Error handling client message")
 			c.sendError("handler_error", err.Error())
 		}
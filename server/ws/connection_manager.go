@@ -3,12 +3,15 @@ package ws
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"leetcodeduels/config"
 	"leetcodeduels/models"
 	"leetcodeduels/services"
 	"leetcodeduels/store"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -22,6 +25,9 @@ const (
 	serverChannelPrefix = "server:"
 	wsTicketPrefix      = "ws_ticket:"
 	userLocationTTL     = 60 * time.Second
+
+	maxPlayers          = 8 // Largest free-for-all a player can invite others to
+	problemPickAttempts = 5 // Random picks made looking for a problem the players didn't just play
 )
 
 var ConnManager *connManager
@@ -103,6 +109,12 @@ func newConnManager(redisURL string) (*connManager, error) {
 
 	go cm.run()
 	go cm.redisListener()
+	go services.QueueManager.Run(ctx, cm.startQueueMatch)
+	go services.GameManager.RunTimers(ctx, cm.expireGame)
+	go services.LobbyManager.RunTimers(ctx, cm.broadcastLobby)
+	go services.GameManager.RunGhostReplays(ctx, cm.replayGhostSubmission)
+	services.TournamentManager.SetMatchStarter(cm.startTournamentMatch)
+	services.LeagueManager.SetFixtureNotifier(cm.notifyLeagueFixture)
 
 	cm.log.Info().
 		Str("server_id", serverUUID).
@@ -148,6 +160,7 @@ func (cm *connManager) handleClientRegister(c *Client) {
 	if !exists {
 		uc = make(map[*Client]bool)
 		cm.userClients[c.userID] = uc
+		go cm.returnToLobby(c.userID)
 	}
 	uc[c] = true
 
@@ -186,6 +199,23 @@ func (cm *connManager) handleClientUnregister(c *Client) {
 
 func (cm *connManager) cleanupUserLocation(userID int64) {
 	delete(cm.userClients, userID)
+
+	// A disconnected user can't be notified of a match, so take them out of the queue
+	if _, err := services.QueueManager.LeaveQueue(userID); err != nil {
+		cm.log.Error().
+			Err(err).
+			Int64("user_id", userID).
+			Msg("Failed to remove disconnected user from queue")
+	}
+	if _, err := services.GameManager.RemoveSpectator(userID); err != nil {
+		cm.log.Error().
+			Err(err).
+			Int64("user_id", userID).
+			Msg("Failed to stop disconnected user spectating")
+	}
+	// Lobby members keep their place for a while so that a dropped connection doesn't cost it
+	go cm.leaveLobbyAway(userID)
+
 	err := cm.redisClient.Del(context.Background(), userLocationKey(userID)).Err()
 	if err != nil {
 		cm.log.Error().
@@ -297,6 +327,15 @@ func (cm *connManager) SendToUser(userID int64, payload []byte) error {
 	return cm.redisClient.Publish(context.Background(), serverChannel(serverID), b).Err()
 }
 
+// Sends an error message to a user who may be connected to any node.
+func (cm *connManager) sendErrorToUser(userID int64, code, msg string) {
+	payload := ErrorPayload{Code: code, Message: msg}
+	b, _ := json.Marshal(Message{Type: ServerMsgError, Payload: MarshalPayload(payload)})
+	if err := cm.SendToUser(userID, b); err != nil {
+		cm.log.Error().Err(err).Int64("user_id", userID).Str("error_code", code).Msg("Failed to send error to user")
+	}
+}
+
 func (cm *connManager) refreshUserTTL(userID int64) error {
 	return cm.redisClient.Expire(context.Background(), userLocationKey(userID), userLocationTTL).Err()
 }
@@ -332,7 +371,7 @@ func (h *connManager) HandleClientMessage(c *Client, env *Message) error {
 			h.log.Error().Err(err).Int64("user_id", c.userID).Str("message_type", string(env.Type)).Msg("Invalid payload")
 			return fmt.Errorf("invalid payload for %s: %w", env.Type, err)
 		}
-		return h.handleDeclineInvitation(p)
+		return h.handleDeclineInvitation(c.userID, p)
 
 	case ClientMsgEnterQueue:
 		var p EnterQueuePayload
@@ -356,6 +395,74 @@ func (h *connManager) HandleClientMessage(c *Client, env *Message) error {
 	case ClientMsgForfeit:
 		return h.handleForfeit(c.userID)
 
+	case ClientMsgOfferDraw:
+		return h.handleOfferDraw(c.userID)
+
+	case ClientMsgSpectate:
+		var p SpectatePayload
+		if err := json.Unmarshal(env.Payload, &p); err != nil {
+			h.log.Error().Err(err).Int64("user_id", c.userID).Str("message_type", string(env.Type)).Msg("Invalid payload")
+			return fmt.Errorf("invalid payload for %s: %w", env.Type, err)
+		}
+		return h.handleSpectate(c.userID, p)
+
+	case ClientMsgStopSpectating:
+		return h.handleStopSpectating(c.userID)
+
+	case ClientMsgCreateLobby:
+		var p CreateLobbyPayload
+		if err := json.Unmarshal(env.Payload, &p); err != nil {
+			h.log.Error().Err(err).Int64("user_id", c.userID).Str("message_type", string(env.Type)).Msg("Invalid payload")
+			return fmt.Errorf("invalid payload for %s: %w", env.Type, err)
+		}
+		return h.handleCreateLobby(c.userID, p)
+
+	case ClientMsgJoinLobby:
+		var p JoinLobbyPayload
+		if err := json.Unmarshal(env.Payload, &p); err != nil {
+			h.log.Error().Err(err).Int64("user_id", c.userID).Str("message_type", string(env.Type)).Msg("Invalid payload")
+			return fmt.Errorf("invalid payload for %s: %w", env.Type, err)
+		}
+		return h.handleJoinLobby(c.userID, p)
+
+	case ClientMsgUpdateLobby:
+		var p UpdateLobbyPayload
+		if err := json.Unmarshal(env.Payload, &p); err != nil {
+			h.log.Error().Err(err).Int64("user_id", c.userID).Str("message_type", string(env.Type)).Msg("Invalid payload")
+			return fmt.Errorf("invalid payload for %s: %w", env.Type, err)
+		}
+		return h.handleUpdateLobby(c.userID, p)
+
+	case ClientMsgLeaveLobby:
+		return h.handleLeaveLobby(c.userID)
+
+	case ClientMsgStartLobby:
+		return h.handleStartLobby(c.userID)
+
+	case ClientMsgRequestRematch:
+		var p RequestRematchPayload
+		if err := json.Unmarshal(env.Payload, &p); err != nil {
+			h.log.Error().Err(err).Int64("user_id", c.userID).Str("message_type", string(env.Type)).Msg("Invalid payload")
+			return fmt.Errorf("invalid payload for %s: %w", env.Type, err)
+		}
+		return h.handleRematch(c.userID, p.SessionID, p.NewProblem, false)
+
+	case ClientMsgAcceptRematch:
+		var p AcceptRematchPayload
+		if err := json.Unmarshal(env.Payload, &p); err != nil {
+			h.log.Error().Err(err).Int64("user_id", c.userID).Str("message_type", string(env.Type)).Msg("Invalid payload")
+			return fmt.Errorf("invalid payload for %s: %w", env.Type, err)
+		}
+		return h.handleRematch(c.userID, p.SessionID, false, true)
+
+	case ClientMsgStartGhostRace:
+		var p StartGhostRacePayload
+		if err := json.Unmarshal(env.Payload, &p); err != nil {
+			h.log.Error().Err(err).Int64("user_id", c.userID).Str("message_type", string(env.Type)).Msg("Invalid payload")
+			return fmt.Errorf("invalid payload for %s: %w", env.Type, err)
+		}
+		return h.handleStartGhostRace(c.userID, p)
+
 	default:
 		h.log.Warn().Int64("user_id", c.userID).Str("message_type", string(env.Type)).Msg("Unknown message type received")
 		c.sendError("unknown_type", "message type not recognized")
@@ -393,42 +500,100 @@ func (cm *connManager) Close() error {
 func (c *connManager) handleSendInvitation(
 	userID int64, p SendInvitationPayload,
 ) error {
+	invitees := p.InviteeIDs
+	if len(invitees) == 0 {
+		invitees = []int64{p.InviteeID}
+	}
+
 	c.log.Info().
 		Int64("inviter_id", userID).
-		Int64("invitee_id", p.InviteeID).
+		Ints64("invitee_ids", invitees).
 		Msg("Processing invitation request")
 
-	// todo: check if inviter and invitee are the same
-
-	isOnline := c.redisClient.Exists(context.Background(), userLocationKey(p.InviteeID)).Val() == 1
-	if !isOnline {
-		b, _ := json.Marshal(Message{Type: ServerMsgUserOffline})
-		c.direct <- directMessage{userID: userID, payload: b}
+	if len(invitees) > maxPlayers-1 {
+		c.sendErrorToUser(userID, "too_many_invitees", fmt.Sprintf("at most %d players can be invited", maxPlayers-1))
+		return nil
+	}
+	if p.MatchDetails.SeriesTarget > 1 && len(invitees) > 1 {
+		c.sendErrorToUser(userID, "invalid_series", "series are only played between two players")
+		return nil
+	}
+	// A league fixture is played with the league's details. Asking to play it counts even if the
+	// opponent is offline, so that an unplayed fixture goes to whoever tried.
+	if p.League != nil {
+		if len(invitees) != 1 {
+			c.sendErrorToUser(userID, "invalid_fixture", "league fixtures are played between two players")
+			return nil
+		}
+		details, err := services.LeagueManager.RequestFixture(*p.League, userID, invitees[0])
+		if clientErr := fixtureError(err); clientErr != nil {
+			c.sendErrorToUser(userID, clientErr.Code, clientErr.Message)
+			return nil
+		}
+		if err != nil {
+			c.log.Error().Err(err).Int64("inviter_id", userID).Int("league_id", p.League.LeagueID).Msg("Failed to request league fixture")
+			return err
+		}
+		p.MatchDetails = details
+	}
+	if clientErr := ValidateMatchDetails(p.MatchDetails); clientErr != nil {
+		c.sendErrorToUser(userID, clientErr.Code, clientErr.Message)
 		return nil
 	}
+	seen := make(map[int64]bool, len(invitees))
+	for _, inviteeID := range invitees {
+		if inviteeID == userID || seen[inviteeID] {
+			c.sendErrorToUser(userID, "invalid_invitee", "cannot invite yourself or the same player twice")
+			return nil
+		}
+		seen[inviteeID] = true
+	}
+
+	for _, inviteeID := range invitees {
+		isOnline := c.redisClient.Exists(context.Background(), userLocationKey(inviteeID)).Val() == 1
+		if !isOnline {
+			b, _ := json.Marshal(Message{Type: ServerMsgUserOffline})
+			c.direct <- directMessage{userID: userID, payload: b}
+			return nil
+		}
+	}
 
 	// todo: check if user is in-game already.
 
-	success, err := services.InviteManager.CreateInvite(userID, p.InviteeID, p.MatchDetails)
+	var success bool
+	var err error
+	if p.League != nil {
+		success, err = services.InviteManager.CreateFixtureInvite(userID, invitees[0], p.MatchDetails, *p.League)
+	} else {
+		success, err = services.InviteManager.CreateGroupInvite(userID, invitees, p.MatchDetails)
+	}
 	if err != nil {
-		c.log.Error().Err(err).Int64("inviter_id", userID).Int64("invitee_id", p.InviteeID).Msg("Failed to create invite")
+		c.log.Error().Err(err).Int64("inviter_id", userID).Ints64("invitee_ids", invitees).Msg("Failed to create invite")
 		return err
 	}
 	if !success {
 		// Invite already exists from this user
 		// TODO: Either replace the existing invite or ignore this invite
-		c.log.Warn().Int64("inviter_id", userID).Int64("invitee_id", p.InviteeID).Msg("Invite already exists from this user")
+		c.log.Warn().Int64("inviter_id", userID).Ints64("invitee_ids", invitees).Msg("Invite already exists from this user")
 		return nil
 	}
 
-	request := InvitationRequestPayload{InviterID: userID, MatchDetails: p.MatchDetails}
+	request := InvitationRequestPayload{InviterID: userID, MatchDetails: p.MatchDetails, League: p.League}
+	if len(invitees) > 1 {
+		request.InviteeIDs = invitees
+	}
 	payload, _ := json.Marshal(request)
 
 	msg := Message{Type: ServerMsgInvitationRequest, Payload: payload}
 	b, _ := json.Marshal(msg)
 
 	// SendToUser will now correctly route the message across servers.
-	return ConnManager.SendToUser(p.InviteeID, b)
+	for _, inviteeID := range invitees {
+		if err := ConnManager.SendToUser(inviteeID, b); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (c *connManager) handleAcceptInvitation(userID int64, p AcceptInvitationPayload) error {
@@ -442,12 +607,25 @@ func (c *connManager) handleAcceptInvitation(userID int64, p AcceptInvitationPay
 		c.log.Error().Err(err).Int64("accepter_id", userID).Int64("inviter_id", p.InviterID).Msg("Failed to get invite details")
 		return err
 	}
-	if invite == nil {
+	if invite == nil || !slices.Contains(invite.Invitees(), userID) {
 		b, _ := json.Marshal(Message{Type: ServerMsgInviteDoesNotExist})
 		ConnManager.SendToUser(userID, b)
 		return nil
 	}
 
+	// A free-for-all only starts once every invitee has accepted
+	if len(invite.Invitees()) > 1 {
+		allAccepted, err := services.InviteManager.AcceptInvite(p.InviterID, userID)
+		if err != nil {
+			c.log.Error().Err(err).Int64("accepter_id", userID).Int64("inviter_id", p.InviterID).Msg("Failed to accept invite")
+			return err
+		}
+		if !allAccepted {
+			b, _ := json.Marshal(Message{Type: ServerMsgInvitationAccepted, Payload: MarshalPayload(InvitationAcceptedPayload{PlayerID: userID})})
+			return ConnManager.SendToUser(p.InviterID, b)
+		}
+	}
+
 	// remove the invite
 	removed, err := services.InviteManager.RemoveInvite(p.InviterID)
 	if err != nil {
@@ -460,62 +638,192 @@ func (c *connManager) handleAcceptInvitation(userID int64, p AcceptInvitationPay
 		return nil
 	}
 
-	// todo: check if user is already in game
+	// The invite is used up, so everyone hears why if the game can't start
+	players := append([]int64{p.InviterID}, invite.Invitees()...)
+	for _, playerID := range players {
+		inGame, err := services.GameManager.IsPlayerInGame(playerID)
+		if err != nil {
+			c.log.Error().Err(err).Int64("user_id", playerID).Msg("Failed to check if player is in game")
+			return err
+		}
+		if inGame {
+			for _, id := range players {
+				c.sendErrorToUser(id, "player_in_game", "a player has already started another game")
+			}
+			return nil
+		}
+	}
+	if invite.League != nil {
+		return c.startLeagueFixture(players, invite)
+	}
+
+	var link models.GameLink
+	if invite.MatchDetails.SeriesTarget > 1 {
+		link.SeriesID, err = services.SeriesManager.StartSeries(players, invite.MatchDetails)
+		if err != nil {
+			c.log.Error().Err(err).Ints64("players", players).Msg("Failed to start series")
+			return err
+		}
+	}
+
+	_, err = c.startGame(players, invite.MatchDetails, link)
+	return err
+}
 
-	problem, err := store.DataStore.GetRandomProblemByTagsAndDifficulties(invite.MatchDetails.Tags, invite.MatchDetails.Difficulties)
+// Checks the options a player chose for a match, or a series of them, are within limits.
+func ValidateMatchDetails(details models.MatchDetails) *ClientError {
+	if details.SeriesTarget < 0 || details.SeriesTarget > services.MaxSeriesTarget {
+		return &ClientError{"invalid_series", fmt.Sprintf("series target must be at most %d", services.MaxSeriesTarget)}
+	}
+	if details.TimeLimit < 0 || details.TimeLimit > services.MaxTimeLimit {
+		return &ClientError{"invalid_time_limit", fmt.Sprintf("time limit must be at most %d minutes", services.MaxTimeLimit)}
+	}
+	scoringMode, err := models.ParseScoringMode(string(details.ScoringMode))
 	if err != nil {
-		c.log.Error().Err(err).Msg("Failed to get random problem")
-		return err
+		return &ClientError{"invalid_scoring_mode", "unknown scoring mode"}
+	}
+	if details.Relay && scoringMode != models.ScoringStandard {
+		return &ClientError{"invalid_relay", "relays are won by the first player to solve every problem"}
+	}
+	if _, err := models.ParseOptimizationMetric(string(details.OptimizeFor)); err != nil {
+		return &ClientError{"invalid_scoring_mode", "optimization duels are ranked by runtime or memory"}
+	}
+	return validateLanguages(details.Languages)
+}
+
+// Checks a list of allowed languages. A nil list allows any language, but an empty one would
+// allow none.
+func validateLanguages(languages []models.LanguageType) *ClientError {
+	if languages != nil && len(languages) == 0 {
+		return &ClientError{"invalid_languages", "allow at least one language, or leave languages out to allow any"}
+	}
+	if len(languages) > len(models.Languages) {
+		return &ClientError{"invalid_languages", fmt.Sprintf("at most %d languages can be allowed", len(models.Languages))}
+	}
+	seen := make(map[models.LanguageType]bool, len(languages))
+	for _, lang := range languages {
+		if _, err := models.ParseLang(string(lang)); err != nil {
+			return &ClientError{"invalid_languages", fmt.Sprintf("unknown language: %s", lang)}
+		}
+		if seen[lang] {
+			return &ClientError{"invalid_languages", fmt.Sprintf("%s is listed more than once", lang)}
+		}
+		seen[lang] = true
+	}
+	return nil
+}
+
+func problemURL(problem models.Problem) string {
+	return fmt.Sprintf("https://leetcode.com/problems/%s", problem.Slug)
+}
+
+// Picks a problem matching the details, starts a session for the players, notifies each of them
+// and returns its ID. The link is empty unless the game is part of a series or tournament.
+func (c *connManager) startGame(players []int64, details models.MatchDetails, link models.GameLink) (string, error) {
+	problems, err := c.pickProblems(details, nil)
+	if err != nil {
+		return "", err
 	}
-	if problem == nil {
-		c.log.Warn().Msg("No problem found matching preferences")
-		return fmt.Errorf("no problem found matching preferences")
+	return c.startSession(players, problems, details, link)
+}
+
+// Picks a random problem matching the details, or one of each difficulty for a relay. A problem
+// in avoid is only picked if a few more tries turn up nothing else.
+func (c *connManager) pickProblems(details models.MatchDetails, avoid []models.Problem) ([]models.Problem, error) {
+	// A relay has one problem of each difficulty in order
+	difficulties := [][]models.Difficulty{details.Difficulties}
+	if details.Relay {
+		difficulties = nil
+		for _, d := range services.RelayDifficulties {
+			difficulties = append(difficulties, []models.Difficulty{d})
+		}
+	}
+
+	avoided := func(p *models.Problem) bool {
+		return slices.ContainsFunc(avoid, func(a models.Problem) bool { return a.ID == p.ID })
+	}
+	problems := make([]models.Problem, 0, len(difficulties))
+	for _, d := range difficulties {
+		var problem *models.Problem
+		for attempt := 0; attempt < problemPickAttempts && (problem == nil || avoided(problem)); attempt++ {
+			var err error
+			problem, err = store.DataStore.GetRandomProblemByTagsAndDifficulties(details.Tags, d)
+			if err != nil {
+				c.log.Error().Err(err).Msg("Failed to get random problem")
+				return nil, err
+			}
+			if problem == nil {
+				c.log.Warn().Msg("No problem found matching preferences")
+				return nil, fmt.Errorf("no problem found matching preferences")
+			}
+		}
+		problems = append(problems, *problem)
 	}
+	return problems, nil
+}
+
+// Starts a session for the players with problems already picked, notifies each of them and
+// returns its ID.
+func (c *connManager) startSession(players []int64, problems []models.Problem, details models.MatchDetails, link models.GameLink) (string, error) {
+	problem := problems[0]
 
 	// start the session
-	sessionID, err := services.GameManager.StartGame(
-		[]int64{p.InviterID, userID},
-		*problem,
-	)
+	sessionID, err := services.GameManager.StartGame(players, problems, details, link)
 	if err != nil {
-		c.log.Error().Err(err).Ints64("players", []int64{p.InviterID, userID}).Msg("Failed to start game")
-		return err
+		c.log.Error().Err(err).Ints64("players", players).Msg("Failed to start game")
+		return "", err
+	}
+	session, err := services.GameManager.GetGame(sessionID)
+	if err != nil || session == nil {
+		c.log.Error().Err(err).Str("session_id", sessionID).Msg("Failed to get started game")
+		return "", fmt.Errorf("could not load started session %s: %w", sessionID, err)
+	}
+
+	// Players still queued would otherwise be paired into a second game
+	for _, playerID := range players {
+		if _, err := services.QueueManager.LeaveQueue(playerID); err != nil {
+			c.log.Error().Err(err).Int64("user_id", playerID).Str("session_id", sessionID).Msg("Failed to take player out of the queue")
+		}
 	}
 
 	c.log.Info().
 		Str("session_id", sessionID).
-		Ints64("players", []int64{p.InviterID, userID}).
+		Ints64("players", players).
 		Str("problem_slug", problem.Slug).
+		Int("problem_count", len(problems)).
 		Msg("Game started successfully")
 
-	problemURL := fmt.Sprintf("https://leetcode.com/problems/%s", problem.Slug)
-
-	// notify accepter
-	startPayload := StartGamePayload{
-		SessionID:  sessionID,
-		ProblemURL: problemURL,
-		OpponentID: p.InviterID,
-	}
-	b, _ := json.Marshal(Message{Type: ServerMsgStartGame, Payload: MarshalPayload(startPayload)})
-	err = ConnManager.SendToUser(userID, b)
-	if err != nil {
-		c.log.Error().Err(err).Int64("user_id", userID).Str("session_id", sessionID).Msg("Failed to notify accepter of game start")
-		return err
-	}
-
-	// notify inviter
-	startPayload.OpponentID = userID
-	b, _ = json.Marshal(Message{Type: ServerMsgStartGame, Payload: MarshalPayload(startPayload)})
-	err = ConnManager.SendToUser(p.InviterID, b)
-	if err != nil {
-		c.log.Error().Err(err).Int64("user_id", p.InviterID).Str("session_id", sessionID).Msg("Failed to notify inviter of game start")
-		return err
+	for _, playerID := range players {
+		opponents := slices.DeleteFunc(slices.Clone(players), func(id int64) bool { return id == playerID })
+		if link.Ghost != nil {
+			opponents = []int64{link.Ghost.PlayerID}
+		}
+		startPayload := StartGamePayload{
+			SessionID:    sessionID,
+			ProblemURL:   problemURL(problem),
+			OpponentID:   opponents[0],
+			OpponentIDs:  opponents,
+			SeriesID:     link.SeriesID,
+			Tournament:   link.Tournament,
+			League:       link.League,
+			Ghost:        link.Ghost,
+			Deadline:     session.Deadline,
+			Languages:    session.Languages,
+			ProblemCount: len(session.Problems),
+		}
+		b, _ := json.Marshal(Message{Type: ServerMsgStartGame, Payload: MarshalPayload(startPayload)})
+		err = ConnManager.SendToUser(playerID, b)
+		if err != nil {
+			c.log.Error().Err(err).Int64("user_id", playerID).Str("session_id", sessionID).Msg("Failed to notify player of game start")
+			return "", err
+		}
 	}
 
-	return nil
+	return sessionID, nil
 }
 
-func (c *connManager) handleDeclineInvitation(p DeclineInvitationPayload) error {
+// Declining a free-for-all invite cancels it for every other invitee too.
+func (c *connManager) handleDeclineInvitation(userID int64, p DeclineInvitationPayload) error {
 	c.log.Info().
 		Int64("inviter_id", p.InviterID).
 		Msg("Processing invitation decline")
@@ -547,6 +855,17 @@ func (c *connManager) handleDeclineInvitation(p DeclineInvitationPayload) error
 		return err
 	}
 
+	canceled, _ := json.Marshal(Message{Type: ServerMsgInvitationCanceled, Payload: MarshalPayload(InvitationCanceledPayload{InviterID: p.InviterID})})
+	for _, inviteeID := range invite.Invitees() {
+		if inviteeID == userID {
+			continue
+		}
+		if err := ConnManager.SendToUser(inviteeID, canceled); err != nil {
+			c.log.Error().Err(err).Int64("invitee_id", inviteeID).Msg("Failed to notify invitee of cancellation")
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -582,33 +901,149 @@ func (c *connManager) handleCancelInvitation(userID int64) error {
 		c.log.Warn().Int64("inviter_id", userID).Msg("Could not cancel invite - already removed")
 
 		b, _ := json.Marshal(Message{Type: ServerMsgInviteDoesNotExist})
-		err = ConnManager.SendToUser(invite.InviteeID, b)
-		if err != nil {
-			c.log.Error().Err(err).Int64("invitee_id", invite.InviteeID).Msg("Failed to send invite does not exist message")
-			return err
+		for _, inviteeID := range invite.Invitees() {
+			err = ConnManager.SendToUser(inviteeID, b)
+			if err != nil {
+				c.log.Error().Err(err).Int64("invitee_id", inviteeID).Msg("Failed to send invite does not exist message")
+				return err
+			}
 		}
 		return nil
 	}
 
 	payload := InvitationCanceledPayload{InviterID: userID}
 	b, _ := json.Marshal(Message{Type: ServerMsgInvitationCanceled, Payload: MarshalPayload(payload)})
-	err = ConnManager.SendToUser(invite.InviteeID, b)
+	for _, inviteeID := range invite.Invitees() {
+		err = ConnManager.SendToUser(inviteeID, b)
+		if err != nil {
+			c.log.Error().Err(err).Int64("invitee_id", inviteeID).Msg("Failed to notify invitee of cancellation")
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *connManager) handleEnterQueue(userID int64, p EnterQueuePayload) error {
+	c.log.Info().
+		Int64("user_id", userID).
+		Strs("difficulties", p.Difficulties).
+		Ints("tags", p.Tags).
+		Msg("Processing queue entry")
+
+	inGame, err := services.GameManager.IsPlayerInGame(userID)
+	if err != nil {
+		c.log.Error().Err(err).Int64("user_id", userID).Msg("Failed to check if user is in-game")
+		return err
+	}
+	if inGame {
+		return &ClientError{"already_in_game", "finish your current game first"}
+	}
+
+	difficulties := make([]models.Difficulty, 0, len(p.Difficulties))
+	for _, d := range p.Difficulties {
+		difficulty, err := models.ParseDifficulty(d)
+		if err != nil {
+			return &ClientError{"invalid_difficulty", fmt.Sprintf("unknown difficulty: %s", d)}
+		}
+		difficulties = append(difficulties, difficulty)
+	}
+	if clientErr := validateLanguages(p.Languages); clientErr != nil {
+		return clientErr
+	}
+
+	rating, err := store.DataStore.GetUserRating(userID)
+	if err != nil {
+		c.log.Error().Err(err).Int64("user_id", userID).Msg("Failed to get user rating")
+		return err
+	}
+	// Players queueing for the same single tag are matched on their rating for that tag
+	var tagRating int
+	if len(p.Tags) == 1 {
+		tagRating, err = services.GetTagRating(userID, p.Tags[0])
+		if err != nil {
+			c.log.Error().Err(err).Int64("user_id", userID).Int("tag_id", p.Tags[0]).Msg("Failed to get tag rating")
+			return err
+		}
+	}
+
+	entry := models.QueueEntry{
+		UserID:       userID,
+		Difficulties: difficulties,
+		Tags:         p.Tags,
+		Languages:    p.Languages,
+		Rating:       rating,
+		TagRating:    tagRating,
+		JoinedAt:     time.Now(),
+	}
+
+	err = services.QueueManager.EnterQueue(entry)
+	if errors.Is(err, services.ErrAlreadyInQueue) {
+		return &ClientError{"already_in_queue", "you are already in the queue"}
+	}
 	if err != nil {
-		c.log.Error().Err(err).Int64("invitee_id", invite.InviteeID).Msg("Failed to notify invitee of cancellation")
+		c.log.Error().Err(err).Int64("user_id", userID).Msg("Failed to enter queue")
 		return err
 	}
 
+	c.log.Info().Int64("user_id", userID).Int("rating", rating).Msg("User is waiting in queue")
 	return nil
 }
 
-func (c *connManager) handleEnterQueue(userID int64, p EnterQueuePayload) error {
-	c.log.Warn().Int64("user_id", userID).Msg("Queue entry not implemented")
-	return fmt.Errorf("unimplemented")
+// Starts a game for two players paired by the matchmaking loop.
+func (c *connManager) startQueueMatch(a, b models.QueueEntry) {
+	c.log.Info().
+		Int64("player_one", a.UserID).
+		Int64("player_two", b.UserID).
+		Int("rating_diff", services.QueueRatingDiff(a, b)).
+		Msg("Queue match found")
+
+	// A player can start another game while queued; the other one goes back to waiting
+	var free []models.QueueEntry
+	for _, entry := range []models.QueueEntry{a, b} {
+		inGame, err := services.GameManager.IsPlayerInGame(entry.UserID)
+		if err != nil {
+			c.log.Error().Err(err).Int64("user_id", entry.UserID).Msg("Failed to check if player is in game")
+			c.sendErrorToUser(a.UserID, "match_start_failed", "could not start matched game, please queue again")
+			c.sendErrorToUser(b.UserID, "match_start_failed", "could not start matched game, please queue again")
+			return
+		}
+		if !inGame {
+			free = append(free, entry)
+		}
+	}
+	if len(free) < 2 {
+		for _, entry := range free {
+			if err := services.QueueManager.EnterQueue(entry); err != nil && !errors.Is(err, services.ErrAlreadyInQueue) {
+				c.log.Error().Err(err).Int64("user_id", entry.UserID).Msg("Failed to put player back in the queue")
+				c.sendErrorToUser(entry.UserID, "match_start_failed", "could not start matched game, please queue again")
+			}
+		}
+		c.log.Info().Int64("player_one", a.UserID).Int64("player_two", b.UserID).Msg("Queue match dropped; a player is already in a game")
+		return
+	}
+
+	details := services.QueueMatchDetails(a, b)
+	_, err := c.startGame([]int64{a.UserID, b.UserID}, details, models.GameLink{})
+	if err != nil {
+		c.log.Error().Err(err).Int64("player_one", a.UserID).Int64("player_two", b.UserID).Msg("Failed to start queue match")
+		c.sendErrorToUser(a.UserID, "match_start_failed", "could not start matched game, please queue again")
+		c.sendErrorToUser(b.UserID, "match_start_failed", "could not start matched game, please queue again")
+	}
 }
 
 func (c *connManager) handleLeaveQueue(userID int64) error {
-	c.log.Warn().Int64("user_id", userID).Msg("Queue leave not implemented")
-	return fmt.Errorf("unimplemented")
+	c.log.Info().Int64("user_id", userID).Msg("Processing queue leave")
+
+	removed, err := services.QueueManager.LeaveQueue(userID)
+	if err != nil {
+		c.log.Error().Err(err).Int64("user_id", userID).Msg("Failed to leave queue")
+		return err
+	}
+	if !removed {
+		c.log.Warn().Int64("user_id", userID).Msg("User attempted to leave queue but was not queued")
+	}
+	return nil
 }
 
 func (c *connManager) handleSubmission(userID int64, p SubmissionPayload) error {
@@ -639,14 +1074,27 @@ func (c *connManager) handleSubmission(userID int64, p SubmissionPayload) error
 		return err
 	}
 
-	if p.ProblemID != session.Problem.ID {
+	problem, playing := session.CurrentProblem(userID)
+	if !playing || p.ProblemID != problem.ID {
 		c.log.Warn().Str("session_id", sessionID).
-			Int("expected_problem_id", session.Problem.ID).
+			Int("expected_problem_id", problem.ID).
 			Int("actual_problem_id", p.ProblemID).
 			Msg("Submission problem ID does not match game problem ID")
 		return nil // Not an error, just ignore.
 	}
 
+	if !session.AllowsLanguage(p.Language) {
+		c.log.Warn().Str("session_id", sessionID).Str("language", string(p.Language)).Msg("Submission language is not allowed")
+		allowed := make([]string, len(session.Languages))
+		for i, lang := range session.Languages {
+			allowed[i] = string(lang)
+		}
+		return &ClientError{
+			Code:    "language_not_allowed",
+			Message: "this match only allows submissions in " + strings.Join(allowed, ", "),
+		}
+	}
+
 	// get leetcode username associated with userID
 	lcUsername, err := store.DataStore.GetLCUsername(userID)
 	if err != nil {
@@ -674,10 +1122,10 @@ func (c *connManager) handleSubmission(userID int64, p SubmissionPayload) error
 			return fmt.Errorf("submission ID does not match last accepted submission, cannot validate submission")
 		}
 
-		if lastSubmission.TitleSlug != session.Problem.Slug {
+		if lastSubmission.TitleSlug != problem.Slug {
 			c.log.Warn().
 				Int64("user_id", userID).
-				Str("expected_slug", session.Problem.Slug).
+				Str("expected_slug", problem.Slug).
 				Str("actual_slug", lastSubmission.TitleSlug).
 				Msg("Submission problem slug does not match game problem")
 			return fmt.Errorf("submission problem slug does not match game problem, cannot validate submission")
@@ -692,6 +1140,7 @@ func (c *connManager) handleSubmission(userID int64, p SubmissionPayload) error
 	submission := models.PlayerSubmission{
 		ID:                submissionID,
 		PlayerID:          userID,
+		ProblemID:         problem.ID,
 		PassedTestCases:   p.PassedTestCases,
 		TotalTestCases:    p.TotalTestCases,
 		Status:            p.Status,
@@ -709,94 +1158,228 @@ func (c *connManager) handleSubmission(userID int64, p SubmissionPayload) error
 		return err
 	}
 
-	opponentID, err := services.GameManager.GetOpponent(sessionID, userID)
-	if err != nil {
-		c.log.Error().Err(err).Int64("user_id", userID).Msg("Failed to get opponent")
-		return err
-	}
+	// Spectators see every submission, including the ones that decide the game
+	session.Submissions = append(session.Submissions, submission)
+	submissionMsg, _ := json.Marshal(Message{
+		Type:    ServerMsgOpponentSubmission,
+		Payload: MarshalPayload(submissionUpdate(session, submission)),
+	})
+	c.broadcastToSpectators(sessionID, submissionMsg)
 
-	if p.Status == models.Accepted {
-		session, err = services.GameManager.CompleteGame(sessionID, userID)
+	// Solving any relay problem but the last moves the player on to the next one
+	if p.Status == models.Accepted && len(session.Problems) > 0 {
+		solvedBefore := slices.IndexFunc(session.Problems, func(p models.Problem) bool { return p.ID == problem.ID })
+		solved, advanced, err := services.GameManager.AdvanceRelay(sessionID, userID, solvedBefore)
 		if err != nil {
-			c.log.Error().Err(err).Int64("user_id", userID).Msg("Failed to complete game")
+			c.log.Error().Err(err).Int64("user_id", userID).Msg("Failed to advance relay")
 			return err
 		}
-
-		duration := submission.Time.Sub(session.StartTime)
-		durationSecs := int64(duration.Seconds())
-
-		reply := GameOverPayload{
-			WinnerID:  userID,
-			SessionID: sessionID,
-			Duration:  durationSecs,
+		if !advanced {
+			return nil // A repeat of a problem they already solved
 		}
-		payload, _ := json.Marshal(reply)
-		msg := Message{Type: ServerMsgGameOver, Payload: payload}
-		b, _ := json.Marshal(msg)
+		if solved < len(session.Problems) {
+			progress := RelayProgressPayload{SessionID: sessionID, PlayerID: userID, Solved: solved, Total: len(session.Problems)}
+			b, _ := json.Marshal(Message{Type: ServerMsgRelayProgress, Payload: MarshalPayload(progress)})
+			c.broadcast(slices.DeleteFunc(slices.Clone(session.Players), func(id int64) bool { return id == userID }), sessionID, b)
+			c.broadcastToSpectators(sessionID, b)
+
+			progress.NextProblemURL = problemURL(session.Problems[solved])
+			b, _ = json.Marshal(Message{Type: ServerMsgRelayProgress, Payload: MarshalPayload(progress)})
+			c.broadcast([]int64{userID}, sessionID, b)
+			return nil
+		}
+	}
 
-		err = ConnManager.SendToUser(userID, b)
+	// Penalty sessions are decided by adjusted time rather than by whoever solves it first
+	if p.Status == models.Accepted && session.ScoringMode == models.ScoringPenalty {
+		decided, err := services.GameManager.RecordPenaltySolve(sessionID)
 		if err != nil {
-			c.log.Error().Err(err).Int64("user_id", userID).Msg("Failed to send game over message to user")
+			c.log.Error().Err(err).Int64("user_id", userID).Msg("Failed to record penalty solve")
 			return err
 		}
-		err = ConnManager.SendToUser(opponentID, b)
-		if err != nil {
-			c.log.Error().Err(err).Int64("user_id", opponentID).Msg("Failed to send game over message to opponent")
-			return err
+		if decided {
+			session, err := services.GameManager.TimeoutGame(sessionID)
+			if err != nil {
+				c.log.Error().Err(err).Int64("user_id", userID).Msg("Failed to complete game")
+				return err
+			}
+			if session == nil {
+				return nil // Already ended
+			}
+			return c.endGame(session, session.EndTime.Sub(session.StartTime), GameOverSolved)
 		}
+	}
 
-		err = store.DataStore.StoreMatch(session)
+	// Optimization duels keep going until the time limit so players can improve on their solutions
+	if p.Status == models.Accepted && session.ScoringMode != models.ScoringOptimize && session.ScoringMode != models.ScoringPenalty {
+		placement, ended, err := services.GameManager.RecordFinish(sessionID, userID)
 		if err != nil {
-			c.log.Error().Err(err).Msg("Failed to store match data")
+			c.log.Error().Err(err).Int64("user_id", userID).Msg("Failed to record finish")
 			return err
 		}
-		return nil
-	}
+		if ended {
+			session, err = services.GameManager.CompleteGame(sessionID)
+			if err != nil {
+				c.log.Error().Err(err).Int64("user_id", userID).Msg("Failed to complete game")
+				return err
+			}
+
+			return c.endGame(session, submission.Time.Sub(session.StartTime), GameOverSolved)
+		}
+		if placement == 0 {
+			return nil // Already placed; later submissions don't change the standings
+		}
 
-	reply := OpponentSubmissionPayload{
-		ID:       p.ID,
-		PlayerID: userID,
-		Status:   p.Status,
-		Language: p.Language,
-		Time:     p.Time,
+		finished := PlayerFinishedPayload{SessionID: sessionID, PlayerID: userID, Placement: placement}
+		b, _ := json.Marshal(Message{Type: ServerMsgPlayerFinished, Payload: MarshalPayload(finished)})
+		c.broadcast(session.Players, sessionID, b)
+		c.broadcastToSpectators(sessionID, b)
+		return nil
 	}
 
-	payload, _ := json.Marshal(reply)
-	msg := Message{Type: ServerMsgOpponentSubmission, Payload: payload}
-	b, _ := json.Marshal(msg)
-	err = ConnManager.SendToUser(opponentID, b)
+	opponentIDs, err := services.GameManager.GetOpponents(sessionID, userID)
 	if err != nil {
-		c.log.Error().Err(err).Int64("user_id", opponentID).Msg("Failed to send game over message to opponent")
+		c.log.Error().Err(err).Int64("user_id", userID).Msg("Failed to get opponents")
 		return err
 	}
 
+	c.broadcast(opponentIDs, sessionID, submissionMsg)
+
 	return nil
 }
 
-func (cm *connManager) handleForfeit(userID int64) error {
-	cm.log.Info().Int64("user_id", userID).Msg("Processing forfeit request")
+// Describes a submission to the other players and spectators. The session's submissions must
+// end with it, so that penalties are counted up to that point.
+func submissionUpdate(session *models.Session, sub models.PlayerSubmission) OpponentSubmissionPayload {
+	update := OpponentSubmissionPayload{
+		ID:       sub.ID,
+		PlayerID: sub.PlayerID,
+		Status:   sub.Status,
+		Language: sub.Lang,
+		Time:     sub.Time,
+	}
+	if session.ScoringMode == models.ScoringPenalty {
+		score := services.ScorePlayer(session, sub.PlayerID)
+		update.Penalties = score.Penalties
+		update.PenaltyTime = score.PenaltyTime
+	}
+	return update
+}
 
-	sessionID, err := services.GameManager.GetSessionIDByPlayer(userID)
-	if err != nil {
-		cm.log.Error().Err(err).Int64("user_id", userID).Msg("Failed to get session ID for forfeiting user")
-		return err
+// Sends a message to each of the given players, logging rather than stopping on failures.
+func (cm *connManager) broadcast(playerIDs []int64, sessionID string, b []byte) {
+	for _, playerID := range playerIDs {
+		if err := ConnManager.SendToUser(playerID, b); err != nil {
+			cm.log.Error().Err(err).Int64("user_id", playerID).Str("session_id", sessionID).Msg("Failed to send game update")
+		}
 	}
-	if sessionID == "" {
-		cm.log.Warn().Int64("user_id", userID).Msg("User attempted to forfeit but is not in a game")
-		return nil
+}
+
+// Sends a message to everyone watching a session, wherever they are connected.
+func (cm *connManager) broadcastToSpectators(sessionID string, b []byte) {
+	spectators, err := services.GameManager.GetSpectators(sessionID)
+	if err != nil {
+		cm.log.Error().Err(err).Str("session_id", sessionID).Msg("Failed to get spectators")
+		return
 	}
+	cm.broadcast(spectators, sessionID, b)
+}
+
+// Subscribes a user to the events of a session they are not playing in. Watching another
+// session stops them watching the first.
+func (cm *connManager) handleSpectate(userID int64, p SpectatePayload) error {
+	cm.log.Info().Int64("user_id", userID).Str("session_id", p.SessionID).Msg("Processing spectate request")
 
-	opponentID, err := services.GameManager.GetOpponent(sessionID, userID)
+	session, err := services.GameManager.GetGame(p.SessionID)
 	if err != nil {
-		cm.log.Error().Err(err).Int64("user_id", userID).Str("session_id", sessionID).Msg("Failed to get opponent for forfeit")
+		cm.log.Error().Err(err).Str("session_id", p.SessionID).Msg("Failed to get game session")
 		return err
 	}
-	if opponentID == 0 {
-		cm.log.Error().Int64("user_id", userID).Str("session_id", sessionID).Msg("Could not find opponent in session")
-		return fmt.Errorf("opponent not found in session %s", sessionID)
+	if session == nil || session.Status != models.MatchActive {
+		cm.sendErrorToUser(userID, "session_not_found", "there is no game in progress with that ID")
+		return nil
+	}
+	if slices.Contains(session.Players, userID) {
+		cm.sendErrorToUser(userID, "cannot_spectate", "players can't spectate their own game")
+		return nil
+	}
+
+	added, err := services.GameManager.AddSpectator(session.ID, userID)
+	if err != nil {
+		cm.log.Error().Err(err).Int64("user_id", userID).Str("session_id", session.ID).Msg("Failed to add spectator")
+		return err
+	}
+	if !added {
+		cm.sendErrorToUser(userID, "session_not_found", "there is no game in progress with that ID")
+		return nil
+	}
+
+	reply := SpectatingPayload{
+		SessionID:    session.ID,
+		Players:      session.Players,
+		ProblemURL:   problemURL(session.Problem),
+		ProblemCount: len(session.Problems),
+		Deadline:     session.Deadline,
+		Submissions:  make([]OpponentSubmissionPayload, 0, len(session.Submissions)),
+	}
+	for i, sub := range session.Submissions {
+		past := *session
+		past.Submissions = session.Submissions[:i+1]
+		reply.Submissions = append(reply.Submissions, submissionUpdate(&past, sub))
 	}
+	b, _ := json.Marshal(Message{Type: ServerMsgSpectating, Payload: MarshalPayload(reply)})
+	return cm.SendToUser(userID, b)
+}
 
-	completedSession, err := services.GameManager.CompleteGame(sessionID, opponentID)
+func (cm *connManager) handleStopSpectating(userID int64) error {
+	sessionID, err := services.GameManager.RemoveSpectator(userID)
+	if err != nil {
+		cm.log.Error().Err(err).Int64("user_id", userID).Msg("Failed to remove spectator")
+		return err
+	}
+	if sessionID != "" {
+		cm.log.Info().Int64("user_id", userID).Str("session_id", sessionID).Msg("User stopped spectating")
+	}
+	return nil
+}
+
+func (cm *connManager) handleForfeit(userID int64) error {
+	cm.log.Info().Int64("user_id", userID).Msg("Processing forfeit request")
+
+	sessionID, err := services.GameManager.GetSessionIDByPlayer(userID)
+	if err != nil {
+		cm.log.Error().Err(err).Int64("user_id", userID).Msg("Failed to get session ID for forfeiting user")
+		return err
+	}
+	if sessionID == "" {
+		cm.log.Warn().Int64("user_id", userID).Msg("User attempted to forfeit but is not in a game")
+		return nil
+	}
+
+	placement, ended, err := services.GameManager.RecordElimination(sessionID, userID)
+	if err != nil {
+		cm.log.Error().Err(err).Int64("user_id", userID).Str("session_id", sessionID).Msg("Failed to record forfeit")
+		return err
+	}
+	if placement == 0 {
+		cm.log.Warn().Int64("user_id", userID).Str("session_id", sessionID).Msg("User attempted to forfeit after being placed")
+		return nil
+	}
+	if !ended {
+		// Everyone else keeps playing for the remaining places
+		forfeited := PlayerForfeitedPayload{SessionID: sessionID, PlayerID: userID}
+		b, _ := json.Marshal(Message{Type: ServerMsgPlayerForfeited, Payload: MarshalPayload(forfeited)})
+		opponentIDs, err := services.GameManager.GetOpponents(sessionID, userID)
+		if err != nil {
+			cm.log.Error().Err(err).Int64("user_id", userID).Str("session_id", sessionID).Msg("Failed to get opponents for forfeit")
+			return err
+		}
+		cm.broadcast(opponentIDs, sessionID, b)
+		cm.broadcastToSpectators(sessionID, b)
+		return nil
+	}
+
+	completedSession, err := services.GameManager.CompleteGame(sessionID)
 	if err != nil {
 		cm.log.Error().Err(err).Int64("user_id", userID).Str("session_id", sessionID).Msg("Failed to complete game after forfeit")
 		return err
@@ -806,38 +1389,291 @@ func (cm *connManager) handleForfeit(userID int64) error {
 		return fmt.Errorf("session %s not found", sessionID)
 	}
 
-	duration := completedSession.EndTime.Sub(completedSession.StartTime)
-	durationSecs := int64(duration.Seconds())
+	cm.log.Info().Str("session_id", sessionID).Int64("winner_id", completedSession.Winner).Int64("loser_id", userID).Msg("Game ended due to forfeit")
+
+	return cm.endGame(completedSession, completedSession.EndTime.Sub(completedSession.StartTime), GameOverForfeit)
+}
+
+func (cm *connManager) handleOfferDraw(userID int64) error {
+	cm.log.Info().Int64("user_id", userID).Msg("Processing draw offer")
+
+	sessionID, err := services.GameManager.GetSessionIDByPlayer(userID)
+	if err != nil {
+		cm.log.Error().Err(err).Int64("user_id", userID).Msg("Failed to get session ID for draw offer")
+		return err
+	}
+	if sessionID == "" {
+		cm.log.Warn().Int64("user_id", userID).Msg("User attempted to offer a draw but is not in a game")
+		return nil
+	}
+
+	offered, agreed, err := services.GameManager.OfferDraw(sessionID, userID)
+	if err != nil {
+		cm.log.Error().Err(err).Int64("user_id", userID).Str("session_id", sessionID).Msg("Failed to record draw offer")
+		return err
+	}
+	if !offered {
+		cm.sendErrorToUser(userID, "draw_unavailable", "a draw can only be agreed before anyone has finished or forfeited, and never with a ghost")
+		return nil
+	}
+	if !agreed {
+		offer := DrawOfferedPayload{SessionID: sessionID, PlayerID: userID}
+		b, _ := json.Marshal(Message{Type: ServerMsgDrawOffered, Payload: MarshalPayload(offer)})
+		opponentIDs, err := services.GameManager.GetOpponents(sessionID, userID)
+		if err != nil {
+			cm.log.Error().Err(err).Int64("user_id", userID).Str("session_id", sessionID).Msg("Failed to get opponents for draw offer")
+			return err
+		}
+		cm.broadcast(opponentIDs, sessionID, b)
+		return nil
+	}
+
+	session, err := services.GameManager.DrawGame(sessionID)
+	if err != nil {
+		cm.log.Error().Err(err).Str("session_id", sessionID).Msg("Failed to end game as a draw")
+		return err
+	}
+	if session == nil {
+		return fmt.Errorf("session %s not found", sessionID)
+	}
+
+	cm.log.Info().Str("session_id", sessionID).Msg("Game ended in an agreed draw")
+	return cm.endGame(session, session.EndTime.Sub(session.StartTime), GameOverDraw)
+}
 
+// Ends a session whose time limit has run out.
+func (cm *connManager) expireGame(sessionID string) {
+	session, err := services.GameManager.TimeoutGame(sessionID)
+	if err != nil {
+		cm.log.Error().Err(err).Str("session_id", sessionID).Msg("Failed to time out game")
+		return
+	}
+	if session == nil {
+		return // Ended before the deadline was processed
+	}
+
+	// Penalty sessions are brought forward once nobody can beat the best adjusted time
+	reason := GameOverTimeout
+	if session.ScoringMode == models.ScoringPenalty && session.EndTime.Before(session.Deadline) {
+		reason = GameOverSolved
+	}
+
+	cm.log.Info().Str("session_id", sessionID).Int64("winner_id", session.Winner).Str("reason", reason).Msg("Game ended by its timer")
+	if err := cm.endGame(session, session.EndTime.Sub(session.StartTime), reason); err != nil {
+		cm.log.Error().Err(err).Str("session_id", sessionID).Msg("Failed to end timed out game")
+	}
+}
+
+// Notifies every player and spectator that a finalized session is over, stores the match and
+// records the result in its series, tournament or league.
+func (cm *connManager) endGame(session *models.Session, duration time.Duration, reason string) error {
 	reply := GameOverPayload{
-		WinnerID:  opponentID,
-		SessionID: sessionID,
-		Duration:  durationSecs,
+		WinnerID:    session.Winner,
+		SessionID:   session.ID,
+		Status:      session.Status,
+		Duration:    int64(duration.Seconds()),
+		Placements:  session.Placements,
+		Reason:      reason,
+		ScoringMode: session.ScoringMode,
+		OptimizeFor: session.OptimizeFor,
+		Scores:      session.Scores,
+	}
+
+	// Each player only hears about their own rating change
+	for _, playerID := range session.Players {
+		reply.RatingChanges = visibleRatingChanges(session.RatingChanges, playerID)
+		b, _ := json.Marshal(Message{Type: ServerMsgGameOver, Payload: MarshalPayload(reply)})
+		err := ConnManager.SendToUser(playerID, b)
+		if err != nil {
+			cm.log.Error().Err(err).Int64("user_id", playerID).Str("session_id", session.ID).Msg("Failed to send game over message")
+			// Continue notifying the remaining players
+		}
 	}
-	payload, _ := json.Marshal(reply)
-	msg := Message{Type: ServerMsgGameOver, Payload: payload}
-	b, _ := json.Marshal(msg)
+	reply.RatingChanges = visibleRatingChanges(session.RatingChanges, 0)
+	b, _ := json.Marshal(Message{Type: ServerMsgGameOver, Payload: MarshalPayload(reply)})
+	cm.broadcastToSpectators(session.ID, b)
+
+	// Ghost races are practice against a match that is already stored
+	if session.Ghost != nil {
+		return nil
+	}
+
+	// A series, tournament or league still moves on without the stored match, since it would
+	// otherwise wait on this game forever
+	if err := store.DataStore.StoreMatch(session); err != nil {
+		cm.log.Error().Err(err).Str("session_id", session.ID).Msg("Failed to store match data")
+	} else if len(session.RatingChanges) > 0 {
+		if err := services.Leaderboard.Sync(session.Players...); err != nil {
+			// Ratings are already saved; the leaderboard catches up on the next rebuild
+			cm.log.Error().Err(err).Str("session_id", session.ID).Msg("Failed to update leaderboard")
+		}
+	}
+
+	if session.SeriesID != "" {
+		return cm.advanceSeries(session)
+	}
+	if session.Tournament != nil {
+		if _, err := services.TournamentManager.RecordResult(session); err != nil {
+			cm.log.Error().Err(err).Int("tournament_id", session.Tournament.TournamentID).Msg("Failed to record tournament result")
+			return err
+		}
+	}
+	if session.League != nil {
+		if _, err := services.LeagueManager.RecordResult(session); err != nil {
+			cm.log.Error().Err(err).Int("league_id", session.League.LeagueID).Msg("Failed to record league result")
+			return err
+		}
+	}
+	return nil
+}
+
+// The rating changes a viewer of a finished session may see. A player only gets their own change,
+// while spectators (viewer 0) get everyone's. Ratings of players in placement are hidden from
+// everyone else, so only how much they moved is shown, and opponent ratings are left out while
+// an opponent is in placement.
+func visibleRatingChanges(changes []models.RatingChange, viewerID int64) []models.RatingChange {
+	provisional := 0
+	for _, c := range changes {
+		if c.Provisional {
+			provisional++
+		}
+	}
+
+	var visible []models.RatingChange
+	for _, c := range changes {
+		if viewerID != 0 && c.PlayerID != viewerID {
+			continue
+		}
+		if c.Provisional && c.PlayerID != viewerID {
+			c.OldRating, c.NewRating, c.Deviation, c.Volatility = 0, 0, 0, 0
+		}
+		if c.Provisional && provisional > 1 || !c.Provisional && provisional > 0 {
+			c.OpponentRating = 0
+		}
+		visible = append(visible, c)
+	}
+	return visible
+}
+
+// Starts the session deciding a tournament match and tells both players their next match is ready.
+func (cm *connManager) startTournamentMatch(t *models.Tournament, match models.TournamentMatch) (string, error) {
+	players := match.Players[:]
+	link := models.GameLink{Tournament: &models.TournamentLink{TournamentID: t.ID, Match: match.Number}}
+	sessionID, err := cm.startGame(players, t.MatchDetails, link)
+	if err != nil {
+		return "", err
+	}
+
+	for i, playerID := range players {
+		ready := TournamentMatchReadyPayload{
+			TournamentID: t.ID,
+			Match:        match.Number,
+			Bracket:      match.Bracket,
+			Round:        match.Round,
+			OpponentID:   players[1-i],
+			SessionID:    sessionID,
+		}
+		b, _ := json.Marshal(Message{Type: ServerMsgTournamentMatch, Payload: MarshalPayload(ready)})
+		if err := cm.SendToUser(playerID, b); err != nil {
+			cm.log.Error().Err(err).Int64("user_id", playerID).Int("tournament_id", t.ID).Msg("Failed to send tournament match")
+		}
+	}
+	return sessionID, nil
+}
 
-	err = ConnManager.SendToUser(userID, b)
+// Starts the session deciding the league fixture an accepted invite was for. Both players are
+// told if the fixture can't be played anymore.
+func (cm *connManager) startLeagueFixture(players []int64, invite *models.Invite) error {
+	_, err := services.LeagueManager.PlayFixture(*invite.League, func() (string, error) {
+		return cm.startGame(players, invite.MatchDetails, models.GameLink{League: invite.League})
+	})
+	if clientErr := fixtureError(err); clientErr != nil {
+		for _, playerID := range players {
+			cm.sendErrorToUser(playerID, clientErr.Code, clientErr.Message)
+		}
+		return nil
+	}
 	if err != nil {
-		cm.log.Error().Err(err).Int64("user_id", userID).Msg("Failed to send game over message to forfeiting user")
-		// Continue to notify opponent
+		cm.log.Error().Err(err).Ints64("players", players).Int("league_id", invite.League.LeagueID).Msg("Failed to start league fixture")
+	}
+	return err
+}
+
+// Tells both players of a newly paired league fixture who they play and by when.
+func (cm *connManager) notifyLeagueFixture(l *models.League, fixture models.LeagueFixture) {
+	for i, playerID := range fixture.Players {
+		paired := LeagueFixturePayload{
+			LeagueID:   l.ID,
+			Fixture:    fixture.Number,
+			Round:      fixture.Round,
+			OpponentID: fixture.Players[1-i],
+			Deadline:   fixture.Deadline,
+		}
+		b, _ := json.Marshal(Message{Type: ServerMsgLeagueFixture, Payload: MarshalPayload(paired)})
+		if err := cm.SendToUser(playerID, b); err != nil {
+			cm.log.Error().Err(err).Int64("user_id", playerID).Int("league_id", l.ID).Msg("Failed to send league fixture")
+		}
+	}
+}
+
+// The error to show a player for a league fixture they can't play, or nil if err isn't about the fixture.
+func fixtureError(err error) *ClientError {
+	switch {
+	case errors.Is(err, services.ErrFixtureNotFound):
+		return &ClientError{"fixture_not_found", "league fixture not found"}
+	case errors.Is(err, services.ErrNotFixturePlayer):
+		return &ClientError{"invalid_fixture", "the fixture is between other players"}
+	case errors.Is(err, services.ErrFixtureClosed):
+		return &ClientError{"fixture_closed", "the fixture can no longer be played"}
+	case errors.Is(err, services.ErrFixtureInProgress):
+		return &ClientError{"fixture_in_progress", "the fixture is already being played"}
 	}
+	return nil
+}
 
-	err = ConnManager.SendToUser(opponentID, b)
+// Credits a finished game to its series and tells the players the score. The series is
+// stored once someone reaches the target; otherwise the next game starts right away.
+func (cm *connManager) advanceSeries(session *models.Session) error {
+	series, err := services.SeriesManager.RecordGame(session.SeriesID, session)
 	if err != nil {
-		cm.log.Error().Err(err).Int64("user_id", opponentID).Msg("Failed to send game over message to opponent (winner)")
-		// Continue to storage
+		cm.log.Error().Err(err).Str("series_id", session.SeriesID).Msg("Failed to record series game")
+		return err
+	}
+	if series == nil {
+		cm.log.Warn().Str("series_id", session.SeriesID).Msg("Series expired before the game ended")
+		return nil
 	}
 
-	cm.log.Info().Str("session_id", sessionID).Int64("winner_id", opponentID).Int64("loser_id", userID).Msg("Game ended due to forfeit")
+	update := SeriesUpdatePayload{
+		SeriesID: series.ID,
+		Target:   series.Target,
+		Scores:   series.Scores,
+		Finished: series.Winner > 0,
+		WinnerID: series.Winner,
+	}
+	b, _ := json.Marshal(Message{Type: ServerMsgSeriesUpdate, Payload: MarshalPayload(update)})
+	cm.broadcast(series.Players, session.ID, b)
+
+	if series.Winner > 0 {
+		if err := store.DataStore.StoreSeries(series); err != nil {
+			cm.log.Error().Err(err).Str("series_id", series.ID).Msg("Failed to store series")
+			return err
+		}
+		cm.log.Info().Str("series_id", series.ID).Int64("winner_id", series.Winner).Msg("Series finished")
+		return services.SeriesManager.EndSeries(series.ID)
+	}
 
-	err = store.DataStore.StoreMatch(completedSession)
+	details, err := services.SeriesManager.MatchDetails(series.ID)
 	if err != nil {
-		cm.log.Error().Err(err).Msg("Failed to store match data after forfeit")
+		cm.log.Error().Err(err).Str("series_id", series.ID).Msg("Failed to get series match details")
 		return err
 	}
-	return nil
+	if details == nil {
+		cm.log.Warn().Str("series_id", series.ID).Msg("Series expired before the next game could start")
+		return nil
+	}
+	_, err = cm.startGame(series.Players, *details, models.GameLink{SeriesID: series.ID})
+	return err
 }
 
 func (cm *connManager) StoreTicket(ctx context.Context, ticket string, userID int64, ttl time.Duration) error {
@@ -865,3 +1701,363 @@ func (cm *connManager) ValidateTicket(ctx context.Context, ticket string) (int64
 
 	return strconv.ParseInt(userIDStr, 10, 64)
 }
+
+func (cm *connManager) handleCreateLobby(userID int64, p CreateLobbyPayload) error {
+	if clientErr := ValidateMatchDetails(p.MatchDetails); clientErr != nil {
+		return clientErr
+	}
+	l, err := services.LobbyManager.CreateLobby(userID, p.MatchDetails)
+	if clientErr := lobbyError(err); clientErr != nil {
+		return clientErr
+	}
+	if err != nil {
+		cm.log.Error().Err(err).Int64("user_id", userID).Msg("Failed to create lobby")
+		return err
+	}
+	cm.log.Info().Int64("host_id", userID).Str("code", l.Code).Msg("Lobby created")
+	cm.broadcastLobby(l)
+	return nil
+}
+
+func (cm *connManager) handleJoinLobby(userID int64, p JoinLobbyPayload) error {
+	l, err := services.LobbyManager.JoinLobby(p.Code, userID)
+	if clientErr := lobbyError(err); clientErr != nil {
+		return clientErr
+	}
+	if err != nil {
+		cm.log.Error().Err(err).Int64("user_id", userID).Str("code", p.Code).Msg("Failed to join lobby")
+		return err
+	}
+	cm.broadcastLobby(l)
+	return nil
+}
+
+func (cm *connManager) handleUpdateLobby(userID int64, p UpdateLobbyPayload) error {
+	if clientErr := ValidateMatchDetails(p.MatchDetails); clientErr != nil {
+		return clientErr
+	}
+	l, err := services.LobbyManager.UpdateLobby(userID, p.MatchDetails)
+	if clientErr := lobbyError(err); clientErr != nil {
+		return clientErr
+	}
+	if err != nil {
+		cm.log.Error().Err(err).Int64("user_id", userID).Msg("Failed to update lobby")
+		return err
+	}
+	cm.broadcastLobby(l)
+	return nil
+}
+
+func (cm *connManager) handleLeaveLobby(userID int64) error {
+	l, err := services.LobbyManager.LeaveLobby(userID)
+	if clientErr := lobbyError(err); clientErr != nil {
+		return clientErr
+	}
+	if err != nil {
+		cm.log.Error().Err(err).Int64("user_id", userID).Msg("Failed to leave lobby")
+		return err
+	}
+	if len(l.Members) > 0 {
+		cm.broadcastLobby(l)
+	}
+	b, _ := json.Marshal(Message{Type: ServerMsgLobbyLeft, Payload: MarshalPayload(LobbyLeftPayload{Code: l.Code})})
+	return cm.SendToUser(userID, b)
+}
+
+// Starts a game between the lobby's connected members, or a series when there are two of them
+// and the host asked for one. The lobby closes once the game has started.
+func (cm *connManager) handleStartLobby(userID int64) error {
+	var code string
+	err := services.LobbyManager.StartLobby(userID, func(l *models.Lobby, players []int64) error {
+		code = l.Code
+		var link models.GameLink
+		if l.MatchDetails.SeriesTarget > 1 {
+			if len(players) != 2 {
+				return &ClientError{"invalid_series", "series are only played between two players"}
+			}
+			var err error
+			link.SeriesID, err = services.SeriesManager.StartSeries(players, l.MatchDetails)
+			if err != nil {
+				return err
+			}
+		}
+		_, err := cm.startGame(players, l.MatchDetails, link)
+		return err
+	})
+	if clientErr := lobbyError(err); clientErr != nil {
+		return clientErr
+	}
+	if err != nil {
+		cm.log.Error().Err(err).Int64("user_id", userID).Msg("Failed to start lobby")
+		return err
+	}
+	cm.log.Info().Int64("host_id", userID).Str("code", code).Msg("Lobby started")
+	return nil
+}
+
+// Marks a user who has disconnected as away in their lobby, if they are in one.
+func (cm *connManager) leaveLobbyAway(userID int64) {
+	l, err := services.LobbyManager.SetAway(userID)
+	if err != nil {
+		cm.log.Error().Err(err).Int64("user_id", userID).Msg("Failed to mark lobby member away")
+		return
+	}
+	if l != nil {
+		cm.broadcastLobby(l)
+	}
+}
+
+// Marks a user who has reconnected as back in their lobby, which also sends them its state.
+func (cm *connManager) returnToLobby(userID int64) {
+	l, err := services.LobbyManager.SetBack(userID)
+	if err != nil {
+		cm.log.Error().Err(err).Int64("user_id", userID).Msg("Failed to mark lobby member back")
+		return
+	}
+	if l != nil {
+		cm.broadcastLobby(l)
+	}
+}
+
+// Sends the lobby's current state to each of its members.
+func (cm *connManager) broadcastLobby(l *models.Lobby) {
+	b, _ := json.Marshal(Message{Type: ServerMsgLobbyUpdate, Payload: MarshalPayload(l)})
+	for _, memberID := range l.MemberIDs() {
+		if err := cm.SendToUser(memberID, b); err != nil {
+			cm.log.Error().Err(err).Int64("user_id", memberID).Str("code", l.Code).Msg("Failed to send lobby update")
+		}
+	}
+}
+
+// The error to show a player for a lobby action they can't take, or nil if err isn't about the lobby.
+func lobbyError(err error) *ClientError {
+	var clientErr *ClientError
+	switch {
+	case errors.As(err, &clientErr):
+		return clientErr
+	case errors.Is(err, services.ErrLobbyNotFound):
+		return &ClientError{"lobby_not_found", "no open lobby has that code"}
+	case errors.Is(err, services.ErrLobbyFull):
+		return &ClientError{"lobby_full", err.Error()}
+	case errors.Is(err, services.ErrAlreadyInLobby):
+		return &ClientError{"already_in_lobby", "leave your current lobby first"}
+	case errors.Is(err, services.ErrNotInLobby):
+		return &ClientError{"not_in_lobby", "you are not in a lobby"}
+	case errors.Is(err, services.ErrNotLobbyHost):
+		return &ClientError{"not_lobby_host", "only the host can do that"}
+	case errors.Is(err, services.ErrTooFewLobbyMembers):
+		return &ClientError{"too_few_players", err.Error()}
+	}
+	return nil
+}
+
+// Records that a player of a game that just ended wants to play it again, telling the others.
+// Once every player agrees, a new game starts with the same players and match details, on a
+// different problem if any of them asked for one.
+func (cm *connManager) handleRematch(userID int64, sessionID string, newProblem, accepting bool) error {
+	session, err := services.GameManager.GetGame(sessionID)
+	if err != nil {
+		cm.log.Error().Err(err).Str("session_id", sessionID).Msg("Failed to get game session")
+		return err
+	}
+	if session == nil || !slices.Contains(session.Players, userID) {
+		return &ClientError{"session_not_found", "you haven't played a game with that ID"}
+	}
+	if session.Status == models.MatchActive {
+		return &ClientError{"game_in_progress", "the game hasn't ended yet"}
+	}
+	if clientErr := ValidateMatchDetails(session.MatchDetails); clientErr != nil {
+		return clientErr
+	}
+
+	var ready, avoid bool
+	if accepting {
+		ready, avoid, err = services.GameManager.AcceptRematch(session, userID)
+	} else {
+		ready, avoid, err = services.GameManager.RequestRematch(session, userID, newProblem)
+	}
+	if clientErr := rematchError(err); clientErr != nil {
+		return clientErr
+	}
+	if err != nil {
+		cm.log.Error().Err(err).Int64("user_id", userID).Str("session_id", sessionID).Msg("Failed to record rematch")
+		return err
+	}
+
+	others := slices.DeleteFunc(slices.Clone(session.Players), func(id int64) bool { return id == userID })
+	if !ready {
+		requested := RematchRequestedPayload{
+			SessionID:  sessionID,
+			PlayerID:   userID,
+			NewProblem: newProblem,
+			ExpiresAt:  session.EndTime.Add(services.RematchWindow),
+		}
+		b, _ := json.Marshal(Message{Type: ServerMsgRematchRequested, Payload: MarshalPayload(requested)})
+		cm.broadcast(others, sessionID, b)
+		return nil
+	}
+
+	// The request is used up, so everyone hears why if the rematch can't start
+	for _, playerID := range session.Players {
+		busy, err := cm.rematchBusy(playerID)
+		if err != nil {
+			return err
+		}
+		if busy != nil {
+			for _, id := range session.Players {
+				cm.sendErrorToUser(id, busy.Code, busy.Message)
+			}
+			return nil
+		}
+	}
+
+	var played []models.Problem
+	if avoid {
+		played = append([]models.Problem{session.Problem}, session.Problems...)
+	}
+	problems, err := cm.pickProblems(session.MatchDetails, played)
+	if err != nil {
+		return err
+	}
+	rematchID, err := cm.startSession(session.Players, problems, session.MatchDetails, models.GameLink{})
+	if err != nil {
+		return err
+	}
+	cm.log.Info().Str("session_id", sessionID).Str("rematch_id", rematchID).Msg("Rematch started")
+	return nil
+}
+
+// Why a player can't be pulled into a rematch: they are in another game, waiting in the queue
+// or in a lobby. Returns nil if they are free.
+func (cm *connManager) rematchBusy(playerID int64) (*ClientError, error) {
+	inGame, err := services.GameManager.IsPlayerInGame(playerID)
+	if err != nil {
+		cm.log.Error().Err(err).Int64("user_id", playerID).Msg("Failed to check if player is in game")
+		return nil, err
+	}
+	if inGame {
+		return &ClientError{"player_in_game", "a player has already started another game"}, nil
+	}
+	queued, err := services.QueueManager.IsQueued(playerID)
+	if err != nil {
+		cm.log.Error().Err(err).Int64("user_id", playerID).Msg("Failed to check if player is queued")
+		return nil, err
+	}
+	if queued {
+		return &ClientError{"player_in_queue", "a player is already waiting for another game"}, nil
+	}
+	inLobby, err := services.LobbyManager.InLobby(playerID)
+	if err != nil {
+		cm.log.Error().Err(err).Int64("user_id", playerID).Msg("Failed to check if player is in a lobby")
+		return nil, err
+	}
+	if inLobby {
+		return &ClientError{"player_in_lobby", "a player has joined a lobby"}, nil
+	}
+	return nil, nil
+}
+
+// The error to show a player for a rematch they can't have, or nil if err isn't about the rematch.
+func rematchError(err error) *ClientError {
+	switch {
+	case errors.Is(err, services.ErrRematchUnavailable):
+		return &ClientError{"rematch_unavailable", err.Error()}
+	case errors.Is(err, services.ErrRematchExpired):
+		return &ClientError{"rematch_expired", err.Error()}
+	case errors.Is(err, services.ErrRematchNotRequested):
+		return &ClientError{"rematch_not_requested", err.Error()}
+	}
+	return nil
+}
+
+// Starts a race against the recorded submissions of one player of a stored match. The player's
+// submissions are replayed to the racer as they were made, and the race ends like a duel.
+func (cm *connManager) handleStartGhostRace(userID int64, p StartGhostRacePayload) error {
+	matchID, err := uuid.Parse(p.MatchID)
+	if err != nil {
+		return &ClientError{"match_not_found", "no stored match has that ID"}
+	}
+	inGame, err := services.GameManager.IsPlayerInGame(userID)
+	if err != nil {
+		cm.log.Error().Err(err).Int64("user_id", userID).Msg("Failed to check if player is in game")
+		return err
+	}
+	if inGame {
+		return &ClientError{"already_in_game", "finish your current game first"}
+	}
+
+	match, err := store.DataStore.GetMatch(matchID)
+	if err != nil {
+		cm.log.Error().Err(err).Str("match_id", p.MatchID).Msg("Failed to get match")
+		return err
+	}
+	if match == nil {
+		return &ClientError{"match_not_found", "no stored match has that ID"}
+	}
+	race, err := services.NewGhostRace(match, p.PlayerID)
+	if clientErr := ghostError(err); clientErr != nil {
+		return clientErr
+	}
+	if err != nil {
+		return err
+	}
+
+	sessionID, err := cm.startSession([]int64{userID}, race.Problems, race.Details, models.GameLink{Ghost: &race.Link})
+	if err != nil {
+		return err
+	}
+	if err := services.GameManager.ScheduleGhostReplay(sessionID, match.StartTime, race.Timeline); err != nil {
+		cm.log.Error().Err(err).Str("session_id", sessionID).Msg("Failed to schedule ghost replay")
+		return err
+	}
+	cm.log.Info().Int64("user_id", userID).Str("match_id", p.MatchID).Int64("ghost_id", p.PlayerID).Str("session_id", sessionID).Msg("Ghost race started")
+	return nil
+}
+
+// Shows the racer a recorded submission as if their opponent had just made it. The race ends
+// once the ghost makes the submission it finished with.
+func (cm *connManager) replayGhostSubmission(sessionID string, index int) {
+	session, err := services.GameManager.GetGame(sessionID)
+	if err != nil {
+		cm.log.Error().Err(err).Str("session_id", sessionID).Msg("Failed to get ghost race")
+		return
+	}
+	if session == nil || session.Ghost == nil || session.Status != models.MatchActive {
+		return // The race ended before the ghost got this far
+	}
+	sub, err := services.GameManager.GhostSubmission(sessionID, index)
+	if err != nil || sub == nil {
+		cm.log.Error().Err(err).Str("session_id", sessionID).Int("index", index).Msg("Failed to get ghost submission")
+		return
+	}
+
+	session.Submissions = append(session.Submissions, *sub)
+	b, _ := json.Marshal(Message{Type: ServerMsgOpponentSubmission, Payload: MarshalPayload(submissionUpdate(session, *sub))})
+	cm.broadcast(session.Players, sessionID, b)
+	cm.broadcastToSpectators(sessionID, b)
+	if index != session.Ghost.Finish {
+		return
+	}
+
+	ended, err := services.GameManager.GhostFinished(sessionID)
+	if err != nil {
+		cm.log.Error().Err(err).Str("session_id", sessionID).Msg("Failed to end ghost race")
+		return
+	}
+	if ended == nil {
+		return // The racer finished first
+	}
+	if err := cm.endGame(ended, ended.EndTime.Sub(ended.StartTime), GameOverSolved); err != nil {
+		cm.log.Error().Err(err).Str("session_id", sessionID).Msg("Failed to end ghost race")
+	}
+}
+
+func ghostError(err error) *ClientError {
+	switch {
+	case errors.Is(err, services.ErrGhostNotFound):
+		return &ClientError{"ghost_not_found", err.Error()}
+	case errors.Is(err, services.ErrGhostUnsupported):
+		return &ClientError{"ghost_unsupported", err.Error()}
+	}
+	return nil
+}
@@ -15,7 +15,18 @@ const (
 	ClientMsgEnterQueue        = "enter_queue"
 	ClientMsgLeaveQueue        = "leave_queue" // No Payload
 	ClientMsgSubmission        = "submission"
-	ClientMsgForfeit           = "forfeit"   // No Payload
+	ClientMsgForfeit           = "forfeit"    // No Payload
+	ClientMsgOfferDraw         = "offer_draw" // No Payload
+	ClientMsgSpectate          = "spectate"
+	ClientMsgStopSpectating    = "stop_spectating" // No Payload
+	ClientMsgCreateLobby       = "create_lobby"
+	ClientMsgJoinLobby         = "join_lobby"
+	ClientMsgUpdateLobby       = "update_lobby" // Host only
+	ClientMsgLeaveLobby        = "leave_lobby"  // No Payload
+	ClientMsgStartLobby        = "start_lobby"  // No Payload, host only
+	ClientMsgRequestRematch    = "request_rematch"
+	ClientMsgAcceptRematch     = "accept_rematch"
+	ClientMsgStartGhostRace    = "start_ghost_race"
 	ClientMsgHeartbeat         = "heartbeat" // No Payload
 )
 
@@ -25,12 +36,32 @@ const (
 	ServerMsgInvitationRequest  = "invitation_request"
 	ServerMsgInvitationCanceled = "invitation_canceled"
 	ServerMsgInvitationDeclined = "invitation_declined"
+	ServerMsgInvitationAccepted = "invitation_accepted" // Sent to the inviter as each free-for-all invitee accepts
 	ServerMsgUserOffline        = "user_offline"
 	ServerMsgInviteDoesNotExist = "invitation_nonexistent" // No Payload
 	ServerMsgStartGame          = "start_game"
 	ServerMsgGameOver           = "game_over"
+	ServerMsgSeriesUpdate       = "series_update" // Sent after each game of a series
 	ServerMsgOpponentSubmission = "opponent_submission"
-	ServerMsgOtherLogon         = "other_logon" // When another device logs into same account
+	ServerMsgPlayerFinished     = "player_finished"   // A player solved the problem but the game goes on
+	ServerMsgPlayerForfeited    = "player_forfeited"  // A player gave up but the game goes on
+	ServerMsgDrawOffered        = "draw_offered"      // A player would accept a draw
+	ServerMsgRelayProgress      = "relay_progress"    // A player solved a relay problem and moved on to the next
+	ServerMsgSpectating         = "spectating"        // The state of a session a spectator started watching
+	ServerMsgTournamentMatch    = "tournament_match"  // A player's next tournament match has started
+	ServerMsgLeagueFixture      = "league_fixture"    // A player has been paired for a league round
+	ServerMsgLobbyUpdate        = "lobby_update"      // The members and details of a player's lobby whenever they change
+	ServerMsgLobbyLeft          = "lobby_left"        // A player is no longer in the lobby they left
+	ServerMsgRematchRequested   = "rematch_requested" // Another player wants to play a game that just ended again
+	ServerMsgOtherLogon         = "other_logon"       // When another device logs into same account
+)
+
+// Why a game ended
+const (
+	GameOverSolved  = "solved"  // Every player but one solved the problem
+	GameOverForfeit = "forfeit" // The remaining players forfeited
+	GameOverTimeout = "timeout" // The time limit ran out
+	GameOverDraw    = "draw"    // Every player agreed to a draw
 )
 
 type Message struct {
@@ -43,9 +74,23 @@ type ErrorPayload struct {
 	Message string `json:"message"`
 }
 
+// An error caused by what the client sent rather than by the server. Handlers return it to have
+// its code sent to the client in place of the generic handler_error.
+type ClientError struct {
+	Code    string
+	Message string
+}
+
+func (e *ClientError) Error() string {
+	return e.Message
+}
+
+// Set InviteeIDs instead of InviteeID to invite several players to a free-for-all
 type SendInvitationPayload struct {
 	InviteeID    int64               `json:"inviteeID"`
-	MatchDetails models.MatchDetails `json:"matchDetails"`
+	InviteeIDs   []int64             `json:"inviteeIDs,omitempty"`
+	MatchDetails models.MatchDetails `json:"matchDetails"`     // Ignored for league fixtures, which use the league's
+	League       *models.LeagueLink  `json:"league,omitempty"` // Set to play a league fixture against its other player
 }
 
 type AcceptInvitationPayload struct {
@@ -57,8 +102,9 @@ type DeclineInvitationPayload struct {
 }
 
 type EnterQueuePayload struct {
-	Difficulties []string `json:"difficulties"`
-	Tags         []int    `json:"tags"`
+	Difficulties []string              `json:"difficulties"`
+	Tags         []int                 `json:"tags"`
+	Languages    []models.LanguageType `json:"languages,omitempty"` // Empty accepts any language
 }
 
 type SubmissionPayload struct {
@@ -75,9 +121,47 @@ type SubmissionPayload struct {
 	Time              time.Time               `json:"time"`
 }
 
+type SpectatePayload struct {
+	SessionID string `json:"sessionID"`
+}
+
+// Asks the other players of a game that just ended to play again with the same match details
+type RequestRematchPayload struct {
+	SessionID  string `json:"sessionID"`
+	NewProblem bool   `json:"newProblem,omitempty"` // Play a different problem from the one just played
+}
+
+type AcceptRematchPayload struct {
+	SessionID string `json:"sessionID"`
+}
+
+// Races the recorded submissions of one player of a stored match, on the same problems
+type StartGhostRacePayload struct {
+	MatchID  string `json:"matchID"`
+	PlayerID int64  `json:"playerID"` // The recorded player to race against
+}
+
+type CreateLobbyPayload struct {
+	MatchDetails models.MatchDetails `json:"matchDetails"`
+}
+
+type JoinLobbyPayload struct {
+	Code string `json:"code"` // Case-insensitive
+}
+
+type UpdateLobbyPayload struct {
+	MatchDetails models.MatchDetails `json:"matchDetails"`
+}
+
 type InvitationRequestPayload struct {
 	InviterID    int64               `json:"inviterID"`
+	InviteeIDs   []int64             `json:"inviteeIDs,omitempty"` // Everyone invited to a free-for-all
 	MatchDetails models.MatchDetails `json:"matchDetails"`
+	League       *models.LeagueLink  `json:"league,omitempty"` // The league fixture the invite is to play
+}
+
+type InvitationAcceptedPayload struct {
+	PlayerID int64 `json:"playerID"`
 }
 
 type InvitationCanceledPayload struct {
@@ -85,24 +169,118 @@ type InvitationCanceledPayload struct {
 }
 
 type StartGamePayload struct {
-	SessionID  string `json:"sessionID"`
-	ProblemURL string `json:"problemURL"`
-	OpponentID int64  `json:"opponentID"`
+	SessionID    string                 `json:"sessionID"`
+	ProblemURL   string                 `json:"problemURL"`
+	OpponentID   int64                  `json:"opponentID"`  // First opponent, kept for one-on-one clients
+	OpponentIDs  []int64                `json:"opponentIDs"` // Every other player in the session
+	SeriesID     string                 `json:"seriesID,omitempty"`
+	Tournament   *models.TournamentLink `json:"tournament,omitempty"`
+	League       *models.LeagueLink     `json:"league,omitempty"`
+	Ghost        *models.GhostLink      `json:"ghost,omitempty"`        // Set for a ghost race, whose opponent is the recorded player
+	Deadline     time.Time              `json:"deadline"`               // The game ends at this time if nobody has won
+	Languages    []models.LanguageType  `json:"languages,omitempty"`    // Languages submissions may use; empty allows any
+	ProblemCount int                    `json:"problemCount,omitempty"` // Problems in a relay; ProblemURL is the first
 }
 
-// Notifies a player about submission their opponent made
+// Notifies a player about a submission their opponent made, or a spectator about either player's
 type OpponentSubmissionPayload struct {
-	ID       int64                   `json:"submissionID"`
-	PlayerID int64                   `json:"playerID"`
-	Status   models.SubmissionStatus `json:"status"`
-	Language models.LanguageType     `json:"language"`
-	Time     time.Time               `json:"time"`
+	ID          int64                   `json:"submissionID"`
+	PlayerID    int64                   `json:"playerID"`
+	Status      models.SubmissionStatus `json:"status"`
+	Language    models.LanguageType     `json:"language"`
+	Time        time.Time               `json:"time"`
+	Penalties   int                     `json:"penalties,omitempty"`   // The player's penalties so far in penalty matches
+	PenaltyTime int64                   `json:"penaltyTime,omitempty"` // Seconds those penalties add to their time
 }
 
-type GameOverPayload struct {
-	WinnerID  int64  `json:"winnerID"`
+// Sent to a new spectator. Afterwards they get the players' opponent_submission, relay_progress,
+// player_finished, player_forfeited and game_over messages.
+type SpectatingPayload struct {
+	SessionID    string                      `json:"sessionID"`
+	Players      []int64                     `json:"players"`
+	ProblemURL   string                      `json:"problemURL"`
+	ProblemCount int                         `json:"problemCount,omitempty"` // Problems in a relay; ProblemURL is the first
+	Deadline     time.Time                   `json:"deadline"`
+	Submissions  []OpponentSubmissionPayload `json:"submissions"` // Every submission so far
+}
+
+type RelayProgressPayload struct {
+	SessionID      string `json:"sessionID"`
+	PlayerID       int64  `json:"playerID"`
+	Solved         int    `json:"solved"`
+	Total          int    `json:"total"`
+	NextProblemURL string `json:"nextProblemURL,omitempty"` // Only sent to the player who solved it
+}
+
+type PlayerFinishedPayload struct {
+	SessionID string `json:"sessionID"`
+	PlayerID  int64  `json:"playerID"`
+	Placement int    `json:"placement"` // 1 for the first player to finish
+}
+
+type DrawOfferedPayload struct {
+	SessionID string `json:"sessionID"`
+	PlayerID  int64  `json:"playerID"`
+}
+
+type PlayerForfeitedPayload struct {
 	SessionID string `json:"sessionID"`
-	Duration  int64  `json:"duration"` // in seconds
+	PlayerID  int64  `json:"playerID"`
+}
+
+type GameOverPayload struct {
+	WinnerID      int64                     `json:"winnerID"` // 0 for a draw
+	SessionID     string                    `json:"sessionID"`
+	Status        models.MatchStatus        `json:"status"`     // Won or Draw
+	Duration      int64                     `json:"duration"`   // in seconds
+	Placements    []int64                   `json:"placements"` // Finishing order, winner first
+	Reason        string                    `json:"reason"`     // One of the GameOver reasons
+	ScoringMode   models.ScoringMode        `json:"scoringMode"`
+	OptimizeFor   models.OptimizationMetric `json:"optimizeFor,omitempty"`   // Percentile an optimization duel was ranked by
+	Scores        []models.PlayerScore      `json:"scores,omitempty"`        // How each player was scored, in placement order
+	RatingChanges []models.RatingChange     `json:"ratingChanges,omitempty"` // A player's own change; spectators get everyone's
+}
+
+// Sent alongside start_game when the game decides a tournament match
+type TournamentMatchReadyPayload struct {
+	TournamentID int                `json:"tournamentID"`
+	Match        int                `json:"match"` // Number of the match in the bracket
+	Bracket      models.BracketSide `json:"bracket"`
+	Round        int                `json:"round"`
+	OpponentID   int64              `json:"opponentID"`
+	SessionID    string             `json:"sessionID"`
+}
+
+// Sent to both players of a fixture when a league round is paired. Either of them plays it by
+// sending the other an invitation with the league link before the deadline.
+type LeagueFixturePayload struct {
+	LeagueID   int       `json:"leagueID"`
+	Fixture    int       `json:"fixture"` // Number of the fixture in the league
+	Round      int       `json:"round"`
+	OpponentID int64     `json:"opponentID"`
+	Deadline   time.Time `json:"deadline"`
+}
+
+// Sent to the other players each time a player asks for or agrees to a rematch. The game starts
+// once every player has, if they do so before ExpiresAt.
+type RematchRequestedPayload struct {
+	SessionID  string    `json:"sessionID"` // The game that ended
+	PlayerID   int64     `json:"playerID"`
+	NewProblem bool      `json:"newProblem,omitempty"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+type LobbyLeftPayload struct {
+	Code string `json:"code"`
+}
+
+// The score of a series after a game. Once Finished, no further games are started.
+type SeriesUpdatePayload struct {
+	SeriesID string               `json:"seriesID"`
+	Target   int                  `json:"target"`
+	Scores   []models.SeriesScore `json:"scores"`
+	Finished bool                 `json:"finished"`
+	WinnerID int64                `json:"winnerID"` // 0 until the series is finished
 }
 
 func MarshalPayload(v any) json.RawMessage {